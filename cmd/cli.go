@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"golang.org/x/term"
+)
+
+// commandContext is canceled by SIGTERM or SIGINT, and attributes audit events to the cli.
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	return audit.WithActor(ctx, audit.ActorCLI), stop
+}
+
+// loadConfig parses the flags of a command, defined in fs, together with the server's.
+func loadConfig(fs *flag.FlagSet, args []string) (config.Config, error) {
+	cfg, err := config.LoadFlags(fs, args, os.Getenv)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("load config: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadDatabaseConfig is loadConfig for commands that only use the database settings.
+func loadDatabaseConfig(fs *flag.FlagSet, args []string) (config.Config, error) {
+	cfg, err := config.LoadDatabaseFlags(fs, args, os.Getenv)
+	if err != nil {
+		return config.Config{}, fmt.Errorf("load config: %w", err)
+	}
+	return cfg, nil
+}
+
+// arg returns the only argument left after the flags.
+func arg(fs *flag.FlagSet, name string) (string, error) {
+	if fs.NArg() != 1 {
+		return "", usageError("usage: %s [flags] <%s>", fs.Name(), name)
+	}
+	return fs.Arg(0), nil
+}
+
+// operator is what commands that manage users need.
+type operator struct {
+	repository  repository.Repository
+	auditSink   audit.AuditSink
+	userService user.Service
+}
+
+func newOperator(cfg config.Config) (operator, error) {
+	repo, err := repository.New(cfg)
+	if err != nil {
+		return operator{}, fmt.Errorf("init Repository: %w", err)
+	}
+	auditSink, err := audit.New(cfg.Audit, repo)
+	if err != nil {
+		repo.Close()
+		return operator{}, fmt.Errorf("init AuditSink: %w", err)
+	}
+	userService, err := user.New(repo, nil, auditSink, cfg)
+	if err != nil {
+		repo.Close()
+		return operator{}, fmt.Errorf("init UserService: %w", err)
+	}
+	return operator{
+		repository:  repo,
+		auditSink:   auditSink,
+		userService: userService,
+	}, nil
+}
+
+func (o operator) Close() error {
+	return o.repository.Close()
+}
+
+// record writes an audit event of an operator acting on email, like the admin endpoints do.
+func (o operator) record(ctx context.Context, eventType, email, reason string, err error) {
+	event := audit.NewEvent(ctx, eventType, email, err)
+	if err == nil {
+		event.Reason = reason
+	}
+	o.auditSink.Write(context.WithoutCancel(ctx), event)
+}
+
+// readPassword reads a password from the first line of r, so it doesn't end up in the shell history.
+// It isn't echoed when r is a terminal, piped passwords are read as a line.
+func readPassword(r io.Reader) (string, error) {
+	fmt.Fprint(os.Stderr, "password: ")
+	if f, ok := r.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		b, err := term.ReadPassword(int(f.Fd()))
+		// the newline typed after the password wasn't echoed either
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if len(b) == 0 {
+			return "", fmt.Errorf("missing password")
+		}
+		return string(b), nil
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("missing password")
+	}
+	return password, nil
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runConfig handles "mimoto config validate", which checks the configuration without starting anything.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return usageError("usage: mimoto config validate [flags]")
+	}
+	fs := flag.NewFlagSet("mimoto config validate", flag.ContinueOnError)
+	if _, err := loadConfig(fs, args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return usageError("usage: %s [flags]", fs.Name())
+	}
+	fmt.Println("config is valid")
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/keys"
+)
+
+const keysUsage = "usage: mimoto keys generate|rotate|list [flags]"
+
+// runKeys handles "mimoto keys <command>", servers only read the keyring at startup so they have to be restarted after a rotation.
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return usageError(keysUsage)
+	}
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("mimoto keys "+command, flag.ContinueOnError)
+
+	switch command {
+	case "generate":
+		// a new SECRET doesn't depend on the configuration
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		key, err := keys.Generate(time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Println(key.Secret)
+		return nil
+	case "rotate":
+		keep := flags.Int("keep", 2, "number of keys kept, including the new one, tokens signed by older keys stop verifying")
+		cfg, err := loadKeysConfig(flags, args)
+		if err != nil {
+			return err
+		}
+		keyring, err := keys.Load(cfg.Tokens.KeysFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		before := keyring.Keys
+		key, err := keyring.Rotate(time.Now(), *keep)
+		if err != nil {
+			return err
+		}
+		if err := keyring.Save(cfg.Tokens.KeysFile); err != nil {
+			return err
+		}
+		for _, old := range before {
+			if _, ok := keyring.Find(old.ID); !ok {
+				fmt.Fprintf(os.Stderr, "dropped key %s\n", old.ID)
+			}
+		}
+		fmt.Printf("added key %s, restart mimoto to sign tokens with it\n", key.ID)
+		return nil
+	case "list":
+		cfg, err := loadKeysConfig(flags, args)
+		if err != nil {
+			return err
+		}
+		keyring, err := keys.Load(cfg.Tokens.KeysFile)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tACTIVE")
+		for i, key := range keyring.Keys {
+			fmt.Fprintf(w, "%s\t%s\t%v\n", key.ID, key.CreatedAt.Format(time.RFC3339), i == 0)
+		}
+		return w.Flush()
+	}
+	return usageError("unknown keys command %q, %s", command, keysUsage)
+}
+
+func loadKeysConfig(flags *flag.FlagSet, args []string) (config.Config, error) {
+	cfg, err := loadConfig(flags, args)
+	if err != nil {
+		return config.Config{}, err
+	}
+	if flags.NArg() != 0 {
+		return config.Config{}, usageError("usage: %s [flags]", flags.Name())
+	}
+	if cfg.Tokens.KeysFile == "" {
+		return config.Config{}, errors.New("missing keyring, set TOKEN_KEYS_FILE or -token-keys-file")
+	}
+	return cfg, nil
+}
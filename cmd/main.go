@@ -1,25 +1,81 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-
-	"github.com/broswen/mimoto/internal/server"
+	"os"
+	"strings"
+	_ "time/tzdata"
 )
 
-func main() {
+const usage = `usage: mimoto <command> [flags] [args]
+
+commands:
+  serve                     run the server, the default without a command
+  migrate up|down|status    change the database schema
+  user create|confirm|disable|delete|list|reset-password
+                            manage users
+  keys generate|rotate|list manage token signing keys
+  token issue|inspect       debug access tokens
+  config validate           check the configuration
 
-	server, err := server.New()
-	if err != nil {
-		log.Fatalf("init server: %v", err)
+Every command takes the server's flags and environment variables.`
+
+// errUsage is returned for unknown commands and missing arguments, it prints the usage instead of a log line.
+var errUsage = errors.New(usage)
+
+func usageError(format string, a ...interface{}) error {
+	return fmt.Errorf("%s\n\n%w", fmt.Sprintf(format, a...), errUsage)
+}
+
+func run(args []string) error {
+	// flags without a command start the server, like before there were commands
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
 	}
 
-	server.Routes()
-	if err != nil {
-		log.Fatalf("server routes: %v", err)
+	command, args := args[0], args[1:]
+	switch command {
+	case "serve":
+		return runServe(args)
+	case "migrate":
+		return runMigrate(args)
+	case "user":
+		return runUser(args)
+	case "keys":
+		return runKeys(args)
+	case "token":
+		return runToken(args)
+	case "config":
+		return runConfig(args)
+	case "help":
+		fmt.Println(usage)
+		return nil
 	}
+	return usageError("unknown command %q", command)
+}
 
-	if err := server.Listen(); err != nil {
-		log.Fatalf("listen server: %v", err)
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		// -h already printed the flags of the command
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		log.Fatalf("%s: %v", commandName(os.Args[1:]), err)
 	}
+}
 
+// commandName is the command and subcommand in args, for error messages.
+func commandName(args []string) string {
+	name := "mimoto"
+	for i := 0; i < len(args) && i < 2 && !strings.HasPrefix(args[i], "-"); i++ {
+		name += " " + args[i]
+	}
+	return name
 }
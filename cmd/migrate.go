@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/broswen/mimoto/internal/migrate"
+	"github.com/broswen/mimoto/internal/repository"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = "usage: mimoto migrate up|down|status [flags]"
+
+// runMigrate handles "mimoto migrate <command> [flags]", the flags are the same as the server's
+// but only the database settings have to be valid, so it runs with nothing but those set.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return usageError(migrateUsage)
+	}
+	command := args[0]
+	switch command {
+	case "up", "down", "status":
+	default:
+		return usageError("unknown migrate command %q, %s", command, migrateUsage)
+	}
+
+	fs := flag.NewFlagSet("mimoto migrate "+command, flag.ContinueOnError)
+	cfg, err := loadDatabaseConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	var db *gorm.DB
+	var dialect string
+	switch cfg.Repository {
+	case "", "postgres":
+		db, err = repository.OpenPostgres(cfg.Postgres)
+		dialect = migrate.Postgres
+	case "sqlite":
+		db, err = repository.OpenSQLite(cfg.SQLite)
+		dialect = migrate.SQLite
+	default:
+		return fmt.Errorf("the %s repository has no schema to migrate", cfg.Repository)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", dialect, err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	migrations, err := migrate.Migrations(dialect)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrate.New(sqlDB, dialect, migrations)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateDatabaseSettingsOnly(t *testing.T) {
+	// an init container only gets the database settings, and HOSTNAME is the pod name
+	t.Setenv("REPOSITORY", "sqlite")
+	t.Setenv("SQLITE_PATH", filepath.Join(t.TempDir(), "mimoto.db"))
+	t.Setenv("HOSTNAME", "mimoto-5d8f7c9b4-x2lqp")
+	t.Setenv("SECRET", "")
+	t.Setenv("BASE_URL", "")
+
+	if err := run([]string{"migrate", "up"}); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+	if err := run([]string{"migrate", "status"}); err != nil {
+		t.Fatalf("migrate status: %v", err)
+	}
+	// the server does need the rest
+	if err := run([]string{"config", "validate"}); err == nil {
+		t.Fatalf("config validate: missing secret didn't fail")
+	}
+}
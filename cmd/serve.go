@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/server"
+)
+
+func runServe(args []string) error {
+	cfg, err := config.Load(args, os.Getenv)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	server, err := server.New(cfg)
+	if err != nil {
+		return fmt.Errorf("init server: %w", err)
+	}
+
+	if err := server.Routes(); err != nil {
+		return fmt.Errorf("server routes: %w", err)
+	}
+
+	// kubernetes sends SIGTERM before killing the pod
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := server.Listen(ctx); err != nil {
+		return fmt.Errorf("listen server: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/golang-jwt/jwt"
+)
+
+const tokenUsage = "usage: mimoto token issue|inspect [flags] <email|token>"
+
+// runToken handles "mimoto token <command>", for debugging clients and the token policies.
+func runToken(args []string) error {
+	if len(args) == 0 {
+		return usageError(tokenUsage)
+	}
+	command, args := args[0], args[1:]
+	fs := flag.NewFlagSet("mimoto token "+command, flag.ContinueOnError)
+
+	switch command {
+	case "issue":
+		audience := fs.String("audience", "", "aud claim of the token, the default audience when it's empty")
+		cfg, err := loadConfig(fs, args)
+		if err != nil {
+			return err
+		}
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		o, err := newOperator(cfg)
+		if err != nil {
+			return err
+		}
+		defer o.Close()
+		ctx, stop := commandContext()
+		defer stop()
+
+		token, err := o.userService.IssueAccessToken(ctx, email, *audience)
+		if err != nil {
+			return err
+		}
+		fmt.Println(token)
+		return nil
+	case "inspect":
+		cfg, err := loadConfig(fs, args)
+		if err != nil {
+			return err
+		}
+		tokenString, err := arg(fs, "token")
+		if err != nil {
+			return err
+		}
+
+		// the claims are shown even if the token doesn't verify, that's usually what's being debugged
+		token, _, err := new(jwt.Parser).ParseUnverified(tokenString, &jwt.MapClaims{})
+		if err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(map[string]interface{}{
+			"header": token.Header,
+			"claims": token.Claims,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+
+		// verifying only needs the keys, not the repository
+		userService, err := user.New(nil, nil, nil, cfg)
+		if err != nil {
+			return err
+		}
+		if _, _, err := userService.ParseToken(tokenString); err != nil {
+			if _, _, refreshErr := userService.ParseRefreshToken(tokenString); refreshErr != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(os.Stderr, "valid")
+		return nil
+	}
+	return usageError("unknown token command %q, %s", command, tokenUsage)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+)
+
+const userUsage = "usage: mimoto user create|confirm|disable|delete|list|reset-password [flags] [email]"
+
+// runUser handles "mimoto user <command>", emails it queues are sent by the server's outbox dispatcher.
+func runUser(args []string) error {
+	if len(args) == 0 {
+		return usageError(userUsage)
+	}
+	command, args := args[0], args[1:]
+	fs := flag.NewFlagSet("mimoto user "+command, flag.ContinueOnError)
+
+	var run func(o operator, fs *flag.FlagSet) error
+	switch command {
+	case "create":
+		run = userCreate(fs)
+	case "confirm":
+		run = userConfirm(fs)
+	case "disable":
+		run = userDisable(fs)
+	case "delete":
+		run = userDelete(fs)
+	case "list":
+		run = userList(fs)
+	case "reset-password":
+		run = userResetPassword(fs)
+	default:
+		return usageError("unknown user command %q, %s", command, userUsage)
+	}
+
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	o, err := newOperator(cfg)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	return run(o, fs)
+}
+
+func userCreate(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	name := fs.String("name", "", "name of the user, required")
+	confirmed := fs.Bool("confirmed", false, "confirm the email without sending a confirmation email")
+	admin := fs.Bool("admin", false, "give the user the admin role")
+	return func(o operator, fs *flag.FlagSet) error {
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		// passwords are never flags, they'd end up in the shell history and process list
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		// roles can't be assigned through the api, only here
+		newUser := user.NewUser{Email: email, Name: *name, Password: password, Confirmed: *confirmed}
+		if *admin {
+			newUser.Role = repository.RoleAdmin
+		}
+		if err := o.userService.CreateUser(ctx, newUser); err != nil {
+			return err
+		}
+		if *confirmed {
+			o.record(ctx, audit.TypeAdminConfirm, email, "", nil)
+		}
+		fmt.Printf("created %s\n", email)
+		return nil
+	}
+}
+
+func userConfirm(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	return func(o operator, fs *flag.FlagSet) error {
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		err = o.userService.ForceConfirm(ctx, email)
+		o.record(ctx, audit.TypeAdminConfirm, email, "", err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("confirmed %s\n", email)
+		return nil
+	}
+}
+
+func userDisable(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	reason := fs.String("reason", "", "why the user is disabled, shown to admins")
+	return func(o operator, fs *flag.FlagSet) error {
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		err = o.userService.DisableUser(ctx, email, *reason)
+		o.record(ctx, audit.TypeAdminDisable, email, *reason, err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("disabled %s\n", email)
+		return nil
+	}
+}
+
+func userDelete(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	return func(o operator, fs *flag.FlagSet) error {
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		err = o.userService.DeleteUser(ctx, email)
+		o.record(ctx, audit.TypeAdminDelete, email, "", err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("deleted %s\n", email)
+		return nil
+	}
+}
+
+func userList(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	var opts repository.ListOptions
+	fs.IntVar(&opts.Offset, "offset", 0, "number of users to skip")
+	fs.IntVar(&opts.Limit, "limit", 50, "most users to list, 0 lists every user")
+	fs.StringVar(&opts.Email, "email", "", "only list emails containing this")
+	fs.StringVar(&opts.Name, "name", "", "only list names containing this")
+	fs.StringVar(&opts.Status, "status", "", "only list users with this status")
+	confirmed := fs.String("confirmed", "", "only list confirmed (true) or unconfirmed (false) users")
+	return func(o operator, fs *flag.FlagSet) error {
+		if fs.NArg() != 0 {
+			return usageError("usage: %s [flags]", fs.Name())
+		}
+		if opts.Offset < 0 {
+			return fmt.Errorf("invalid offset %d, must not be negative", opts.Offset)
+		}
+		if opts.Limit < 0 {
+			return fmt.Errorf("invalid limit %d, must not be negative", opts.Limit)
+		}
+		if *confirmed != "" {
+			c, err := strconv.ParseBool(*confirmed)
+			if err != nil {
+				return fmt.Errorf("invalid confirmed %q, must be true or false", *confirmed)
+			}
+			opts.Confirmed = &c
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		users, total, err := o.userService.ListUsers(ctx, opts)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "EMAIL\tNAME\tROLE\tSTATUS\tCONFIRMED")
+		for _, u := range users {
+			role := u.Role
+			if role == repository.RoleUser {
+				role = "user"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\n", u.Email, u.Name, role, u.EffectiveStatus(time.Now()), u.Confirmed)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d of %d users\n", len(users), total)
+		return nil
+	}
+}
+
+func userResetPassword(fs *flag.FlagSet) func(o operator, fs *flag.FlagSet) error {
+	set := fs.Bool("set", false, "set the password, read from stdin, instead of emailing a reset link")
+	return func(o operator, fs *flag.FlagSet) error {
+		email, err := arg(fs, "email")
+		if err != nil {
+			return err
+		}
+		if !*set {
+			ctx, stop := commandContext()
+			defer stop()
+
+			err := o.userService.SendReset(ctx, email)
+			o.record(ctx, audit.TypeAdminReset, email, "", err)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("queued a password reset email to %s\n", email)
+			return nil
+		}
+
+		password, err := readPassword(os.Stdin)
+		if err != nil {
+			return err
+		}
+		ctx, stop := commandContext()
+		defer stop()
+
+		err = o.userService.SetPassword(ctx, email, password)
+		o.record(ctx, audit.TypeAdminReset, email, "", err)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("set the password of %s\n", email)
+		return nil
+	}
+}
@@ -0,0 +1,242 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	TypeSignup            = "signup"
+	TypeConfirm           = "confirm"
+	TypeLogin             = "login"
+	TypeRefresh           = "refresh"
+	TypeLogout            = "logout"
+	TypeResetRequested    = "reset_requested"
+	TypeResetCompleted    = "reset_completed"
+	TypeDeletionScheduled = "deletion_scheduled"
+	TypeDeletionCanceled  = "deletion_canceled"
+	TypeDeleted           = "deleted"
+
+	TypeAdminConfirm    = "admin.confirm"
+	TypeAdminReset      = "admin.reset"
+	TypeAdminSuspend    = "admin.suspend"
+	TypeAdminDisable    = "admin.disable"
+	TypeAdminEnable     = "admin.enable"
+	TypeAdminLogout     = "admin.logout"
+	TypeAdminDelete     = "admin.delete"
+	TypeAdminUnsuppress = "admin.unsuppress"
+
+	// the subject of webhook events is the subscription or delivery id
+	TypeAdminWebhookCreate = "admin.webhook_create"
+	TypeAdminWebhookDelete = "admin.webhook_delete"
+	TypeAdminWebhookReplay = "admin.webhook_replay"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+const (
+	// ActorSystem is the actor of events caused by background workers.
+	ActorSystem = "system"
+	// ActorCLI is the actor of events caused by operators running mimoto commands.
+	ActorCLI = "cli"
+)
+
+// Event records who did what to which account, events are only ever changed to anonymize deleted accounts.
+type Event struct {
+	ID   string    `json:"id" gorm:"primaryKey"`
+	Time time.Time `json:"time" gorm:"index"`
+	Type string    `json:"type" gorm:"index"`
+	// Actor is the email of whoever made the request, Subject is the email of the account it acted on.
+	Actor     string `json:"actor" gorm:"index"`
+	Subject   string `json:"subject" gorm:"index"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	Outcome   string `json:"outcome"`
+	// Reason explains failures, or why an admin acted.
+	Reason string `json:"reason,omitempty"`
+}
+
+func (Event) TableName() string {
+	return "audit_events"
+}
+
+// AuditSink writes audit events somewhere they can't be changed.
+type AuditSink interface {
+	Write(ctx context.Context, event Event) error
+}
+
+// AuditLog is a sink that can be queried.
+type AuditLog interface {
+	AuditSink
+	// List returns the events matching opts newest first, and how many there are in total.
+	List(ctx context.Context, opts ListOptions) ([]Event, int64, error)
+	// Anonymize replaces email with pseudonym in the events of a deleted account, and clears their IPs and user agents.
+	Anonymize(ctx context.Context, email, pseudonym string) error
+}
+
+// ListOptions filters and paginates the events returned by List.
+// Zero fields are not filtered on.
+type ListOptions struct {
+	Offset  int
+	Limit   int
+	Type    string
+	Actor   string
+	Subject string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+}
+
+func (o ListOptions) matches(event Event) bool {
+	if o.Type != "" && event.Type != o.Type {
+		return false
+	}
+	if o.Actor != "" && event.Actor != o.Actor {
+		return false
+	}
+	if o.Subject != "" && event.Subject != o.Subject {
+		return false
+	}
+	if o.Outcome != "" && event.Outcome != o.Outcome {
+		return false
+	}
+	if !o.Since.IsZero() && event.Time.Before(o.Since) {
+		return false
+	}
+	if !o.Until.IsZero() && !event.Time.Before(o.Until) {
+		return false
+	}
+	return true
+}
+
+// page filters, sorts and paginates events for sinks that can't query.
+func page(events []Event, opts ListOptions) ([]Event, int64) {
+	matched := make([]Event, 0)
+	for _, event := range events {
+		if opts.matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].Time.After(matched[j].Time)
+	})
+
+	total := int64(len(matched))
+	if opts.Offset >= len(matched) {
+		return []Event{}, total
+	}
+	matched = matched[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(matched) {
+		matched = matched[:opts.Limit]
+	}
+	return matched, total
+}
+
+// anonymize reports whether event involved email, and anonymizes it if it did.
+func anonymize(event *Event, email, pseudonym string) bool {
+	if event.Actor != email && event.Subject != email {
+		return false
+	}
+	if event.Actor == email {
+		event.Actor = pseudonym
+	}
+	if event.Subject == email {
+		event.Subject = pseudonym
+	}
+	event.IP = ""
+	event.UserAgent = ""
+	return true
+}
+
+func prepareEvent(event *Event, now time.Time) {
+	if event.ID == "" {
+		id, _ := uuid.NewV4()
+		event.ID = id.String()
+	}
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+}
+
+// Request is what the audit log knows about the request an event happened in.
+type Request struct {
+	// Actor is the authenticated user, events are attributed to their subject when it's empty.
+	Actor     string
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+type requestKey struct{}
+
+// WithRequest returns a context whose events are attributed to request.
+func WithRequest(ctx context.Context, request Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, request)
+}
+
+// WithActor returns a context whose events are attributed to actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	request := RequestFromContext(ctx)
+	request.Actor = actor
+	return WithRequest(ctx, request)
+}
+
+func RequestFromContext(ctx context.Context) Request {
+	request, _ := ctx.Value(requestKey{}).(Request)
+	return request
+}
+
+// NewEvent builds an event of the request in ctx, err is the reason of failed events.
+func NewEvent(ctx context.Context, eventType, subject string, err error) Event {
+	request := RequestFromContext(ctx)
+	event := Event{
+		Type:      eventType,
+		Actor:     request.Actor,
+		Subject:   subject,
+		IP:        request.IP,
+		UserAgent: request.UserAgent,
+		RequestID: request.RequestID,
+		Outcome:   OutcomeSuccess,
+	}
+	if event.Actor == "" {
+		event.Actor = subject
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailure
+		event.Reason = err.Error()
+	}
+	return event
+}
+
+// New builds the sink named in the config.
+// The repository sink stores events in the database of the repository, or in memory for the memory repository.
+func New(cfg config.AuditConfig, repo repository.Repository) (AuditSink, error) {
+	switch cfg.Sink {
+	case "", "repository":
+		switch r := repo.(type) {
+		case repository.PostgresRepository:
+			return NewDatabase(r.DB)
+		case repository.SQLiteRepository:
+			return NewDatabase(r.DB)
+		case repository.MapRepository:
+			return NewMemory()
+		}
+		return nil, fmt.Errorf("repository %T has no audit sink", repo)
+	case "file":
+		return NewFile(cfg.FilePath)
+	case "stdout":
+		return NewWriter(os.Stdout)
+	}
+	return nil, fmt.Errorf("unknown audit sink %q, must be one of: repository, file, stdout", cfg.Sink)
+}
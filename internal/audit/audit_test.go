@@ -0,0 +1,144 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+// testList writes events to sink and checks List filters and pages them newest first.
+func testList(t *testing.T, sink AuditLog) {
+	t.Helper()
+	ctx := context.Background()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Time: start, Type: TypeSignup, Actor: "a@test.com", Subject: "a@test.com", Outcome: OutcomeSuccess},
+		{Time: start.Add(time.Minute), Type: TypeLogin, Actor: "a@test.com", Subject: "a@test.com", Outcome: OutcomeFailure},
+		{Time: start.Add(2 * time.Minute), Type: TypeLogin, Actor: "a@test.com", Subject: "a@test.com", Outcome: OutcomeSuccess},
+		{Time: start.Add(3 * time.Minute), Type: TypeAdminDisable, Actor: "admin@test.com", Subject: "b@test.com", Outcome: OutcomeSuccess},
+	}
+	for _, event := range events {
+		if err := sink.Write(ctx, event); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		opts  ListOptions
+		want  []string
+		total int64
+	}{
+		{"all", ListOptions{}, []string{TypeAdminDisable, TypeLogin, TypeLogin, TypeSignup}, 4},
+		{"page", ListOptions{Offset: 1, Limit: 2}, []string{TypeLogin, TypeLogin}, 4},
+		{"past the end", ListOptions{Offset: 10}, []string{}, 4},
+		{"subject", ListOptions{Subject: "a@test.com", Outcome: OutcomeSuccess}, []string{TypeLogin, TypeSignup}, 2},
+		{"actor and type", ListOptions{Actor: "admin@test.com", Type: TypeAdminDisable}, []string{TypeAdminDisable}, 1},
+		{"time range", ListOptions{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []string{TypeLogin, TypeLogin}, 2},
+	}
+	for _, test := range tests {
+		got, total, err := sink.List(ctx, test.opts)
+		if err != nil {
+			t.Fatalf("List %s: %v", test.name, err)
+		}
+		if total != test.total {
+			t.Fatalf("%s total doesn't match: wanted %v but got %v", test.name, test.total, total)
+		}
+		types := make([]string, 0, len(got))
+		for _, event := range got {
+			if event.ID == "" {
+				t.Fatalf("%s event is missing an id", test.name)
+			}
+			types = append(types, event.Type)
+		}
+		if len(types) != len(test.want) {
+			t.Fatalf("%s events don't match: wanted %v but got %v", test.name, test.want, types)
+		}
+		for i := range types {
+			if types[i] != test.want[i] {
+				t.Fatalf("%s events don't match: wanted %v but got %v", test.name, test.want, types)
+			}
+		}
+	}
+}
+
+// testAnonymize checks Anonymize replaces an account's email and clears its requests, leaving other accounts alone.
+func testAnonymize(t *testing.T, sink AuditLog) {
+	t.Helper()
+	ctx := context.Background()
+	for _, event := range []Event{
+		{Type: TypeLogin, Actor: "c@test.com", Subject: "c@test.com", IP: "10.0.0.1", UserAgent: "test"},
+		{Type: TypeAdminDisable, Actor: "c@test.com", Subject: "d@test.com", IP: "10.0.0.1", UserAgent: "test"},
+		{Type: TypeLogin, Actor: "d@test.com", Subject: "d@test.com", IP: "10.0.0.2", UserAgent: "test"},
+	} {
+		if err := sink.Write(ctx, event); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	if err := sink.Anonymize(ctx, "c@test.com", "deleted:c"); err != nil {
+		t.Fatalf("Anonymize: %v", err)
+	}
+	if _, total, _ := sink.List(ctx, ListOptions{Actor: "c@test.com"}); total != 0 {
+		t.Fatalf("actor events don't match: wanted %v but got %v", 0, total)
+	}
+	events, _, err := sink.List(ctx, ListOptions{Actor: "deleted:c"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("anonymized events don't match: wanted %v but got %v", 2, len(events))
+	}
+	for _, event := range events {
+		if event.IP != "" || event.UserAgent != "" {
+			t.Fatalf("%s event request wasn't cleared: %+v", event.Type, event)
+		}
+	}
+	events, _, _ = sink.List(ctx, ListOptions{Actor: "d@test.com"})
+	if len(events) != 1 || events[0].IP != "10.0.0.2" {
+		t.Fatalf("other account's events changed: %+v", events)
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	ctx := WithRequest(context.Background(), Request{IP: "10.0.0.1", UserAgent: "test", RequestID: "req-1"})
+
+	event := NewEvent(ctx, TypeLogin, "test@test.com", errors.New("wrong password"))
+	want := Event{
+		Type:      TypeLogin,
+		Actor:     "test@test.com",
+		Subject:   "test@test.com",
+		IP:        "10.0.0.1",
+		UserAgent: "test",
+		RequestID: "req-1",
+		Outcome:   OutcomeFailure,
+		Reason:    "wrong password",
+	}
+	if event != want {
+		t.Fatalf("event doesn't match: wanted %+v but got %+v", want, event)
+	}
+
+	event = NewEvent(WithActor(ctx, "admin@test.com"), TypeAdminDisable, "test@test.com", nil)
+	if event.Actor != "admin@test.com" || event.Outcome != OutcomeSuccess || event.IP != "10.0.0.1" {
+		t.Fatalf("admin event doesn't match: got %+v", event)
+	}
+}
+
+func TestNew(t *testing.T) {
+	repo, _ := repository.NewMap()
+	sink, err := New(config.AuditConfig{Sink: "repository"}, repo)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, ok := sink.(MemorySink); !ok {
+		t.Fatalf("memory repository sink doesn't match: wanted %T but got %T", MemorySink{}, sink)
+	}
+
+	if _, err := New(config.AuditConfig{Sink: "syslog"}, repo); err == nil {
+		t.Fatalf("New: unknown sink didn't fail")
+	}
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DatabaseSink stores events in the audit_events table of the repository, it only ever inserts.
+type DatabaseSink struct {
+	DB *gorm.DB
+}
+
+func NewDatabase(db *gorm.DB) (DatabaseSink, error) {
+	return DatabaseSink{DB: db}, nil
+}
+
+func (s DatabaseSink) Write(ctx context.Context, event Event) error {
+	prepareEvent(&event, time.Now())
+	return s.DB.WithContext(ctx).Create(&event).Error
+}
+
+func (s DatabaseSink) List(ctx context.Context, opts ListOptions) ([]Event, int64, error) {
+	query := s.DB.WithContext(ctx).Model(&Event{})
+	if opts.Type != "" {
+		query = query.Where("type = ?", opts.Type)
+	}
+	if opts.Actor != "" {
+		query = query.Where("actor = ?", opts.Actor)
+	}
+	if opts.Subject != "" {
+		query = query.Where("subject = ?", opts.Subject)
+	}
+	if opts.Outcome != "" {
+		query = query.Where("outcome = ?", opts.Outcome)
+	}
+	if !opts.Since.IsZero() {
+		query = query.Where("time >= ?", opts.Since)
+	}
+	if !opts.Until.IsZero() {
+		query = query.Where("time < ?", opts.Until)
+	}
+
+	var total int64
+	if tx := query.Count(&total); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+
+	query = query.Order("time DESC")
+	if opts.Limit > 0 {
+		query = query.Offset(opts.Offset).Limit(opts.Limit)
+	} else if opts.Offset > 0 {
+		// sqlite only accepts an OFFSET after a LIMIT
+		query = query.Offset(opts.Offset).Limit(math.MaxInt32)
+	}
+	events := make([]Event, 0)
+	if tx := query.Find(&events); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+	return events, total, nil
+}
+
+func (s DatabaseSink) Anonymize(ctx context.Context, email, pseudonym string) error {
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// IPs and user agents are cleared from the events where the account was either party
+		err := tx.Model(&Event{}).Where("actor = ? OR subject = ?", email, email).
+			Updates(map[string]interface{}{"ip": "", "user_agent": ""}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&Event{}).Where("actor = ?", email).Update("actor", pseudonym).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Event{}).Where("subject = ?", email).Update("subject", pseudonym).Error
+	})
+}
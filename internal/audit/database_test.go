@@ -0,0 +1,23 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+func TestDatabaseSink(t *testing.T) {
+	r, err := repository.NewSQLite(config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "mimoto.db")})
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	defer r.Close()
+	sink, err := NewDatabase(r.DB)
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	testList(t, sink)
+	testAnonymize(t, sink)
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileSink appends events to a JSON lines file, List reads the whole file so it suits small deployments.
+type FileSink struct {
+	path string
+	mu   *sync.Mutex
+}
+
+func NewFile(path string) (FileSink, error) {
+	if path == "" {
+		return FileSink{}, errors.New("missing audit file path")
+	}
+	// fail at startup rather than on the first event
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return FileSink{}, fmt.Errorf("open audit file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return FileSink{}, fmt.Errorf("close audit file: %w", err)
+	}
+	return FileSink{path: path, mu: &sync.Mutex{}}, nil
+}
+
+func (s FileSink) Write(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	prepareEvent(&event, time.Now())
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	// events must survive a crash right after the request
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s FileSink) List(ctx context.Context, opts ListOptions) ([]Event, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	events, err := readEvents(s.path)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, 0, err
+	}
+	events, total := page(events, opts)
+	return events, total, nil
+}
+
+// Anonymize rewrites the file, the new one replaces it once it's complete so a crash can't lose events.
+func (s FileSink) Anonymize(ctx context.Context, email, pseudonym string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events, err := readEvents(s.path)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range events {
+		if anonymize(&events[i], email, pseudonym) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+func readEvents(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := make([]Event, 0)
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial last line was cut off mid write
+			return events, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("read audit file: %w", err)
+		}
+		events = append(events, event)
+	}
+}
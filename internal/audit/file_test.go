@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFile(path)
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	testList(t, sink)
+
+	// events written before a restart can still be listed
+	reopened, _ := NewFile(path)
+	_, total, err := reopened.List(context.Background(), ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 4 {
+		t.Fatalf("total doesn't match: wanted %v but got %v", 4, total)
+	}
+	testAnonymize(t, reopened)
+}
+
+func TestFileSinkPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, _ := NewFile(path)
+	if err := sink.Write(context.Background(), Event{Type: TypeLogin}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString(`{"id":"cut`)
+	f.Close()
+
+	events, _, err := sink.List(context.Background(), ListOptions{})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("events don't match: wanted %v but got %v", 1, len(events))
+	}
+}
+
+func TestNewFile(t *testing.T) {
+	if _, err := NewFile(filepath.Join(t.TempDir(), "missing", "audit.jsonl")); err == nil {
+		t.Fatalf("NewFile: missing directory didn't fail")
+	}
+}
@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemorySink keeps events in memory, it goes with the memory repository.
+// Its events are lost on restart, they aren't in the repository's snapshots.
+type MemorySink struct {
+	mu     *sync.Mutex
+	events *[]Event
+}
+
+func NewMemory() (MemorySink, error) {
+	return MemorySink{mu: &sync.Mutex{}, events: &[]Event{}}, nil
+}
+
+func (s MemorySink) Write(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	prepareEvent(&event, time.Now())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.events = append(*s.events, event)
+	return nil
+}
+
+func (s MemorySink) List(ctx context.Context, opts ListOptions) ([]Event, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	s.mu.Lock()
+	events := append([]Event{}, *s.events...)
+	s.mu.Unlock()
+	events, total := page(events, opts)
+	return events, total, nil
+}
+
+func (s MemorySink) Anonymize(ctx context.Context, email, pseudonym string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range *s.events {
+		anonymize(&(*s.events)[i], email, pseudonym)
+	}
+	return nil
+}
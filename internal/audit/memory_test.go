@@ -0,0 +1,19 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMemorySink(t *testing.T) {
+	sink, _ := NewMemory()
+	testList(t, sink)
+	testAnonymize(t, sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sink.Write(ctx, Event{Type: TypeLogin}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Write error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+}
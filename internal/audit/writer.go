@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// WriterSink writes events as JSON lines to w, for shipping stdout to a log pipeline.
+// It can't be queried.
+type WriterSink struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func NewWriter(w io.Writer) (WriterSink, error) {
+	return WriterSink{w: w, mu: &sync.Mutex{}}, nil
+}
+
+func (s WriterSink) Write(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	prepareEvent(&event, time.Now())
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
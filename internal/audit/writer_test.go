@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriterSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink, _ := NewWriter(&buf)
+	if err := sink.Write(context.Background(), Event{Type: TypeLogout, Subject: "test@test.com"}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	var event Event
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if event.Type != TypeLogout || event.ID == "" || event.Time.IsZero() {
+		t.Fatalf("event doesn't match: got %+v", event)
+	}
+	if _, ok := interface{}(sink).(AuditLog); ok {
+		t.Fatalf("writer sink can be queried")
+	}
+}
@@ -0,0 +1,609 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting mimoto reads at startup.
+type Config struct {
+	Port   string `yaml:"port" toml:"port"`
+	Secret string `yaml:"secret" toml:"secret"`
+	// BaseURL is the base url of the links in emails.
+	BaseURL             string         `yaml:"baseUrl" toml:"baseUrl"`
+	Repository          string         `yaml:"repository" toml:"repository"`
+	DeletionGracePeriod time.Duration  `yaml:"deletionGracePeriod" toml:"deletionGracePeriod"`
+	HTTP                HTTPConfig     `yaml:"http" toml:"http"`
+	Tokens              TokensConfig   `yaml:"tokens" toml:"tokens"`
+	Postgres            PostgresConfig `yaml:"postgres" toml:"postgres"`
+	SQLite              SQLiteConfig   `yaml:"sqlite" toml:"sqlite"`
+	Memory              MemoryConfig   `yaml:"memory" toml:"memory"`
+	Email               EmailConfig    `yaml:"email" toml:"email"`
+	Tracing             TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Audit               AuditConfig    `yaml:"audit" toml:"audit"`
+	Webhooks            WebhooksConfig `yaml:"webhooks" toml:"webhooks"`
+}
+
+// HTTPConfig tunes the HTTP server, zero timeouts are unlimited.
+type HTTPConfig struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout" toml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" toml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout" toml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout" toml:"idleTimeout"`
+	MaxHeaderBytes    int           `yaml:"maxHeaderBytes" toml:"maxHeaderBytes"`
+	// RequestTimeout cancels the queries and emails of slow requests.
+	RequestTimeout time.Duration `yaml:"requestTimeout" toml:"requestTimeout"`
+	// ShutdownTimeout is how long requests and background workers get to finish after SIGTERM or SIGINT.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" toml:"shutdownTimeout"`
+	// TLSCertFile and TLSKeyFile serve HTTPS when set, the certificate is reloaded when they change.
+	TLSCertFile string `yaml:"tlsCertFile" toml:"tlsCertFile"`
+	TLSKeyFile  string `yaml:"tlsKeyFile" toml:"tlsKeyFile"`
+	// TrustedProxies are the IPs and CIDRs of the proxies whose X-Forwarded-For and X-Real-IP headers are used for the client IP.
+	TrustedProxies []string `yaml:"trustedProxies" toml:"trustedProxies"`
+}
+
+// TracingConfig selects where OpenTelemetry spans are exported.
+type TracingConfig struct {
+	// Exporter is otlp, stdout or none.
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Endpoint is the url of the OTLP/HTTP collector, the OTEL_EXPORTER_OTLP_* variables are used when it's empty.
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`
+	ServiceName string  `yaml:"serviceName" toml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio" toml:"sampleRatio"`
+}
+
+// AuditConfig selects where audit events are written.
+type AuditConfig struct {
+	// Sink is repository, file or stdout, repository stores events next to the users.
+	Sink string `yaml:"sink" toml:"sink"`
+	// FilePath is the JSON lines file of the file sink.
+	FilePath string `yaml:"filePath" toml:"filePath"`
+}
+
+// WebhooksConfig limits where webhook deliveries are sent.
+type WebhooksConfig struct {
+	// AllowedNetworks are the IPs and CIDRs of private, loopback and link-local addresses that subscriptions can still be delivered to.
+	AllowedNetworks []string `yaml:"allowedNetworks" toml:"allowedNetworks"`
+}
+
+// TokenPolicy is how long the tokens issued to an audience last.
+type TokenPolicy struct {
+	AccessTTL  time.Duration `yaml:"accessTtl" toml:"accessTtl"`
+	RefreshTTL time.Duration `yaml:"refreshTtl" toml:"refreshTtl"`
+	// MaxSessionLifetime is how long after login refreshing stops working, zero is unlimited.
+	MaxSessionLifetime time.Duration `yaml:"maxSessionLifetime" toml:"maxSessionLifetime"`
+	// IdleTimeout ends sessions that haven't refreshed for that long, zero never ends them.
+	IdleTimeout time.Duration `yaml:"idleTimeout" toml:"idleTimeout"`
+}
+
+type TokensConfig struct {
+	Issuer string `yaml:"issuer" toml:"issuer"`
+	// DefaultAudience is used by clients that don't ask for an audience.
+	DefaultAudience string `yaml:"defaultAudience" toml:"defaultAudience"`
+	// TokenPolicy is the policy of the default audience.
+	TokenPolicy `yaml:",inline"`
+	// Audiences are the policies of other audiences, zero fields use the default policy.
+	Audiences map[string]TokenPolicy `yaml:"audiences" toml:"audiences"`
+	// KeysFile is a keyring managed by "mimoto keys rotate", its newest key signs tokens instead of the secret.
+	KeysFile string `yaml:"keysFile" toml:"keysFile"`
+}
+
+// Policy returns the policy of audience, or false if it isn't configured.
+func (c TokensConfig) Policy(audience string) (TokenPolicy, bool) {
+	if audience == c.DefaultAudience {
+		return c.TokenPolicy, true
+	}
+	policy, ok := c.Audiences[audience]
+	if !ok {
+		return TokenPolicy{}, false
+	}
+	if policy.AccessTTL == 0 {
+		policy.AccessTTL = c.AccessTTL
+	}
+	if policy.RefreshTTL == 0 {
+		policy.RefreshTTL = c.RefreshTTL
+	}
+	if policy.MaxSessionLifetime == 0 {
+		policy.MaxSessionLifetime = c.MaxSessionLifetime
+	}
+	if policy.IdleTimeout == 0 {
+		policy.IdleTimeout = c.IdleTimeout
+	}
+	return policy, true
+}
+
+// ValidAudience reports whether tokens for audience can be issued and accepted.
+func (c TokensConfig) ValidAudience(audience string) bool {
+	_, ok := c.Policy(audience)
+	return ok
+}
+
+type PostgresConfig struct {
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	DB       string `yaml:"db" toml:"db"`
+}
+
+type SQLiteConfig struct {
+	// Path is the database file, it's created if it doesn't exist.
+	Path string `yaml:"path" toml:"path"`
+}
+
+// MemoryConfig persists the memory repository, it only keeps users across restarts with a SnapshotPath.
+type MemoryConfig struct {
+	// SnapshotPath is the file the repository is restored from at startup and written to at shutdown.
+	SnapshotPath string `yaml:"snapshotPath" toml:"snapshotPath"`
+	// SnapshotInterval is how often snapshots are written while running, 0 only writes them at shutdown.
+	SnapshotInterval time.Duration `yaml:"snapshotInterval" toml:"snapshotInterval"`
+}
+
+type EmailConfig struct {
+	Provider string `yaml:"provider" toml:"provider"`
+	// From is the address every email is sent from.
+	From                     string     `yaml:"from" toml:"from"`
+	TemplatesDir             string     `yaml:"templatesDir" toml:"templatesDir"`
+	SendGridAPIKey           string     `yaml:"sendgridApiKey" toml:"sendgridApiKey"`
+	SendGridWebhookPublicKey string     `yaml:"sendgridWebhookPublicKey" toml:"sendgridWebhookPublicKey"`
+	SMTP                     SMTPConfig `yaml:"smtp" toml:"smtp"`
+	FilePath                 string     `yaml:"filePath" toml:"filePath"`
+	WebhookURL               string     `yaml:"webhookUrl" toml:"webhookUrl"`
+	WebhookToken             string     `yaml:"webhookToken" toml:"webhookToken"`
+}
+
+type SMTPConfig struct {
+	Host            string `yaml:"host" toml:"host"`
+	Port            int    `yaml:"port" toml:"port"`
+	Username        string `yaml:"username" toml:"username"`
+	Password        string `yaml:"password" toml:"password"`
+	TLS             string `yaml:"tls" toml:"tls"`
+	Auth            string `yaml:"auth" toml:"auth"`
+	ListUnsubscribe string `yaml:"listUnsubscribe" toml:"listUnsubscribe"`
+}
+
+// Default returns the settings used for anything that isn't configured.
+func Default() Config {
+	return Config{
+		Port:                "8080",
+		Repository:          "postgres",
+		DeletionGracePeriod: 30 * 24 * time.Hour,
+		HTTP: HTTPConfig{
+			ReadTimeout:       10 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			RequestTimeout:    15 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Tokens: TokensConfig{
+			Issuer:          "mimoto",
+			DefaultAudience: "mimoto",
+			TokenPolicy: TokenPolicy{
+				AccessTTL:  24 * time.Hour,
+				RefreshTTL: 30 * 24 * time.Hour,
+			},
+		},
+		SQLite: SQLiteConfig{
+			Path: "mimoto.db",
+		},
+		Memory: MemoryConfig{
+			SnapshotInterval: time.Minute,
+		},
+		Postgres: PostgresConfig{
+			Host: "localhost",
+			Port: "5432",
+		},
+		Email: EmailConfig{
+			Provider: "sendgrid",
+			SMTP: SMTPConfig{
+				Port: 587,
+			},
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "mimoto",
+			SampleRatio: 1,
+		},
+		Audit: AuditConfig{
+			Sink: "repository",
+		},
+	}
+}
+
+type setting struct {
+	// env is the environment variable, the flag is its lower case with dashes.
+	env   string
+	usage string
+	// secret settings aren't flags, so they don't show up in the process list,
+	// and can be read from the file named by env+"_FILE".
+	secret bool
+	value  func(c *Config) flag.Value
+}
+
+var settings = []setting{
+	{env: "PORT", usage: "port to listen on", value: func(c *Config) flag.Value { return (*stringValue)(&c.Port) }},
+	{env: "SECRET", usage: "key used to sign tokens", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Secret) }},
+	{env: "BASE_URL", usage: "base url of the links in emails", value: func(c *Config) flag.Value { return (*stringValue)(&c.BaseURL) }},
+	{env: "REPOSITORY", usage: "where users are stored: postgres, sqlite or memory", value: func(c *Config) flag.Value { return (*stringValue)(&c.Repository) }},
+	{env: "DELETION_GRACE_PERIOD", usage: "how long deleted accounts can be restored", value: func(c *Config) flag.Value { return (*durationValue)(&c.DeletionGracePeriod) }},
+
+	{env: "HTTP_READ_TIMEOUT", usage: "how long reading a request can take", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.ReadTimeout) }},
+	{env: "HTTP_READ_HEADER_TIMEOUT", usage: "how long reading request headers can take", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.ReadHeaderTimeout) }},
+	{env: "HTTP_WRITE_TIMEOUT", usage: "how long writing a response can take", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.WriteTimeout) }},
+	{env: "HTTP_IDLE_TIMEOUT", usage: "how long idle keep-alive connections stay open", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.IdleTimeout) }},
+	{env: "HTTP_MAX_HEADER_BYTES", usage: "max size of request headers", value: func(c *Config) flag.Value { return (*intValue)(&c.HTTP.MaxHeaderBytes) }},
+	{env: "HTTP_REQUEST_TIMEOUT", usage: "how long handling a request can take", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.RequestTimeout) }},
+	{env: "SHUTDOWN_TIMEOUT", usage: "how long requests and workers get to finish on shutdown", value: func(c *Config) flag.Value { return (*durationValue)(&c.HTTP.ShutdownTimeout) }},
+	{env: "TLS_CERT_FILE", usage: "certificate file, serves https with TLS_KEY_FILE", value: func(c *Config) flag.Value { return (*stringValue)(&c.HTTP.TLSCertFile) }},
+	{env: "TLS_KEY_FILE", usage: "private key file of TLS_CERT_FILE", value: func(c *Config) flag.Value { return (*stringValue)(&c.HTTP.TLSKeyFile) }},
+	{env: "TRUSTED_PROXIES", usage: "comma separated IPs and CIDRs of the proxies in front of the server", value: func(c *Config) flag.Value { return (*listValue)(&c.HTTP.TrustedProxies) }},
+
+	{env: "TOKEN_ISSUER", usage: "iss claim of issued tokens", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tokens.Issuer) }},
+	{env: "TOKEN_AUDIENCE", usage: "aud claim of tokens for clients that don't ask for an audience", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tokens.DefaultAudience) }},
+	{env: "ACCESS_TOKEN_TTL", usage: "lifetime of access tokens", value: func(c *Config) flag.Value { return (*durationValue)(&c.Tokens.AccessTTL) }},
+	{env: "REFRESH_TOKEN_TTL", usage: "lifetime of refresh tokens", value: func(c *Config) flag.Value { return (*durationValue)(&c.Tokens.RefreshTTL) }},
+	{env: "SESSION_MAX_LIFETIME", usage: "how long after login refreshing stops working, 0 is unlimited", value: func(c *Config) flag.Value { return (*durationValue)(&c.Tokens.MaxSessionLifetime) }},
+	{env: "TOKEN_KEYS_FILE", usage: "keyring of token signing keys, replaces SECRET", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tokens.KeysFile) }},
+	{env: "SESSION_IDLE_TIMEOUT", usage: "how long sessions last without refreshing, 0 is unlimited", value: func(c *Config) flag.Value { return (*durationValue)(&c.Tokens.IdleTimeout) }},
+
+	{env: "POSTGRES_HOST", usage: "postgres host", value: func(c *Config) flag.Value { return (*stringValue)(&c.Postgres.Host) }},
+	{env: "POSTGRES_PORT", usage: "postgres port", value: func(c *Config) flag.Value { return (*stringValue)(&c.Postgres.Port) }},
+	{env: "POSTGRES_USER", usage: "postgres user", value: func(c *Config) flag.Value { return (*stringValue)(&c.Postgres.User) }},
+	{env: "POSTGRES_PASS", usage: "postgres password", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Postgres.Password) }},
+	{env: "POSTGRES_DB", usage: "postgres database", value: func(c *Config) flag.Value { return (*stringValue)(&c.Postgres.DB) }},
+	{env: "SQLITE_PATH", usage: "database file of the sqlite repository", value: func(c *Config) flag.Value { return (*stringValue)(&c.SQLite.Path) }},
+	{env: "MEMORY_SNAPSHOT_PATH", usage: "file the memory repository is persisted to", value: func(c *Config) flag.Value { return (*stringValue)(&c.Memory.SnapshotPath) }},
+	{env: "MEMORY_SNAPSHOT_INTERVAL", usage: "how often the memory repository is persisted, 0 is only at shutdown", value: func(c *Config) flag.Value { return (*durationValue)(&c.Memory.SnapshotInterval) }},
+
+	{env: "EMAIL_PROVIDER", usage: "how emails are delivered", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.Provider) }},
+	{env: "NOREPLY_EMAIL", usage: "address emails are sent from", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.From) }},
+	{env: "EMAIL_TEMPLATES_DIR", usage: "directory of email template overrides", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.TemplatesDir) }},
+	{env: "SENDGRID_API_KEY", usage: "sendgrid api key", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SendGridAPIKey) }},
+	{env: "SENDGRID_WEBHOOK_PUBLIC_KEY", usage: "verification key of the sendgrid event webhook", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SendGridWebhookPublicKey) }},
+	{env: "SMTP_HOST", usage: "smtp host", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.Host) }},
+	{env: "SMTP_PORT", usage: "smtp port", value: func(c *Config) flag.Value { return (*intValue)(&c.Email.SMTP.Port) }},
+	{env: "SMTP_USERNAME", usage: "smtp username", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.Username) }},
+	{env: "SMTP_PASSWORD", usage: "smtp password", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.Password) }},
+	{env: "SMTP_TLS", usage: "smtp tls mode: starttls, implicit or none", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.TLS) }},
+	{env: "SMTP_AUTH", usage: "smtp auth mechanism: plain, login, cram-md5 or empty", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.Auth) }},
+	{env: "SMTP_LIST_UNSUBSCRIBE", usage: "List-Unsubscribe header of smtp emails", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.SMTP.ListUnsubscribe) }},
+	{env: "EMAIL_FILE_PATH", usage: "mbox file of the file provider", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.FilePath) }},
+	{env: "EMAIL_WEBHOOK_URL", usage: "url of the webhook provider", value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.WebhookURL) }},
+	{env: "EMAIL_WEBHOOK_TOKEN", usage: "bearer token of the webhook provider", secret: true, value: func(c *Config) flag.Value { return (*stringValue)(&c.Email.WebhookToken) }},
+
+	{env: "TRACING_EXPORTER", usage: "where spans are exported: otlp, stdout or none", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tracing.Exporter) }},
+	{env: "TRACING_ENDPOINT", usage: "url of the OTLP/HTTP collector", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tracing.Endpoint) }},
+	{env: "TRACING_SERVICE_NAME", usage: "service.name of exported spans", value: func(c *Config) flag.Value { return (*stringValue)(&c.Tracing.ServiceName) }},
+	{env: "TRACING_SAMPLE_RATIO", usage: "fraction of new traces that are sampled, from 0 to 1", value: func(c *Config) flag.Value { return (*floatValue)(&c.Tracing.SampleRatio) }},
+
+	{env: "AUDIT_SINK", usage: "where audit events are written: repository, file or stdout", value: func(c *Config) flag.Value { return (*stringValue)(&c.Audit.Sink) }},
+	{env: "AUDIT_FILE_PATH", usage: "JSON lines file of the file audit sink", value: func(c *Config) flag.Value { return (*stringValue)(&c.Audit.FilePath) }},
+
+	{env: "WEBHOOK_ALLOWED_NETWORKS", usage: "comma separated internal IPs and CIDRs that webhooks can be delivered to", value: func(c *Config) flag.Value { return (*listValue)(&c.Webhooks.AllowedNetworks) }},
+}
+
+func flagName(env string) string {
+	return strings.ToLower(strings.ReplaceAll(env, "_", "-"))
+}
+
+// Load reads the configuration from, in increasing priority, the defaults, the YAML or TOML file
+// in the -config flag or CONFIG_FILE, environment variables and flags, then validates it.
+func Load(args []string, getenv func(string) string) (Config, error) {
+	return LoadFlags(flag.NewFlagSet("mimoto", flag.ContinueOnError), args, getenv)
+}
+
+// LoadFlags is Load with the flags of a command already defined in fs,
+// the arguments after the flags are left in fs.Args().
+func LoadFlags(fs *flag.FlagSet, args []string, getenv func(string) string) (Config, error) {
+	cfg, err := parse(fs, args, getenv)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// LoadDatabaseFlags is LoadFlags for commands that only connect to the database,
+// like migrations, it only validates the repository settings.
+func LoadDatabaseFlags(fs *flag.FlagSet, args []string, getenv func(string) string) (Config, error) {
+	cfg, err := parse(fs, args, getenv)
+	if err != nil {
+		return Config{}, err
+	}
+	if problems := cfg.databaseProblems(); len(problems) > 0 {
+		return Config{}, errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return cfg, nil
+}
+
+func parse(fs *flag.FlagSet, args []string, getenv func(string) string) (Config, error) {
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "YAML or TOML config file")
+	parsed := Default()
+	bySetting := make(map[string]setting)
+	for _, s := range settings {
+		if s.secret {
+			continue
+		}
+		fs.Var(s.value(&parsed), flagName(s.env), s.usage)
+		bySetting[flagName(s.env)] = s
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := loadEnv(getenv, &cfg); err != nil {
+		return Config{}, err
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if s, ok := bySetting[f.Name]; ok && err == nil {
+			err = s.value(&cfg).Set(f.Value.String())
+		}
+	})
+	if err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(b))
+		decoder.KnownFields(true)
+		// an empty file decodes to io.EOF
+		if err := decoder.Decode(cfg); err != nil && len(bytes.TrimSpace(b)) > 0 {
+			return fmt.Errorf("parse config file: %w", err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), cfg)
+		if err != nil {
+			return fmt.Errorf("parse config file: %w", err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse config file: unknown key %s", undecoded[0])
+		}
+	default:
+		return fmt.Errorf("unknown config file format %q, must be .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	return nil
+}
+
+func loadEnv(getenv func(string) string, cfg *Config) error {
+	for _, s := range settings {
+		v := getenv(s.env)
+		if s.secret {
+			if path := getenv(s.env + "_FILE"); path != "" {
+				if v != "" {
+					return fmt.Errorf("%s and %s_FILE are both set", s.env, s.env)
+				}
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return fmt.Errorf("read %s_FILE: %w", s.env, err)
+				}
+				// secret mounts and editors often end files with a newline
+				v = strings.TrimRight(string(b), "\r\n")
+			}
+		}
+		if v == "" {
+			continue
+		}
+		if err := s.value(cfg).Set(v); err != nil {
+			return fmt.Errorf("parse %s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the settings that would otherwise fail, or silently misbehave, after startup.
+func (c Config) Validate() error {
+	problems := c.databaseProblems()
+	if c.Secret == "" && c.Tokens.KeysFile == "" {
+		problems = append(problems, "missing secret, set SECRET, SECRET_FILE or TOKEN_KEYS_FILE")
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("invalid port %q", c.Port))
+	}
+	if c.BaseURL != "" {
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid base url %q, must be an http or https url", c.BaseURL))
+		}
+	}
+	if c.Memory.SnapshotInterval < 0 {
+		problems = append(problems, "memory snapshot interval can't be negative")
+	}
+	if c.DeletionGracePeriod <= 0 {
+		problems = append(problems, "deletion grace period must be positive")
+	}
+	if c.HTTP.ReadTimeout < 0 || c.HTTP.ReadHeaderTimeout < 0 || c.HTTP.WriteTimeout < 0 || c.HTTP.IdleTimeout < 0 || c.HTTP.RequestTimeout < 0 {
+		problems = append(problems, "http timeouts can't be negative")
+	}
+	if c.HTTP.MaxHeaderBytes <= 0 {
+		problems = append(problems, "http max header bytes must be positive")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdown timeout must be positive")
+	}
+	if (c.HTTP.TLSCertFile == "") != (c.HTTP.TLSKeyFile == "") {
+		problems = append(problems, "tls needs both TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			problems = append(problems, fmt.Sprintf("invalid trusted proxy %q, must be an IP or CIDR", proxy))
+		}
+	}
+	for _, network := range c.Webhooks.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(network); err != nil && net.ParseIP(network) == nil {
+			problems = append(problems, fmt.Sprintf("invalid webhook allowed network %q, must be an IP or CIDR", network))
+		}
+	}
+	if c.Tokens.Issuer == "" {
+		problems = append(problems, "missing token issuer")
+	}
+	if c.Tokens.DefaultAudience == "" {
+		problems = append(problems, "missing default token audience")
+	}
+	audiences := []string{c.Tokens.DefaultAudience}
+	for audience := range c.Tokens.Audiences {
+		audiences = append(audiences, audience)
+	}
+	sort.Strings(audiences[1:])
+	for _, audience := range audiences {
+		policy, _ := c.Tokens.Policy(audience)
+		if policy.AccessTTL <= 0 || policy.RefreshTTL <= 0 {
+			problems = append(problems, fmt.Sprintf("token ttls of audience %q must be positive", audience))
+		}
+		if policy.MaxSessionLifetime < 0 || policy.IdleTimeout < 0 {
+			problems = append(problems, fmt.Sprintf("session limits of audience %q can't be negative", audience))
+		}
+	}
+	if c.Email.SMTP.Port < 1 || c.Email.SMTP.Port > 65535 {
+		problems = append(problems, fmt.Sprintf("invalid smtp port %d", c.Email.SMTP.Port))
+	}
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("unknown tracing exporter %q, must be one of: otlp, stdout, none", c.Tracing.Exporter))
+	}
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid tracing endpoint %q, must be an http or https url", c.Tracing.Endpoint))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		problems = append(problems, "tracing sample ratio must be between 0 and 1")
+	}
+	switch c.Audit.Sink {
+	case "repository", "stdout":
+	case "file":
+		if c.Audit.FilePath == "" {
+			problems = append(problems, "the file audit sink needs AUDIT_FILE_PATH")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown audit sink %q, must be one of: repository, file, stdout", c.Audit.Sink))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// databaseProblems validates the settings of the repository.
+func (c Config) databaseProblems() []string {
+	problems := make([]string, 0)
+	switch c.Repository {
+	case "", "postgres", "memory":
+	case "sqlite":
+		if c.SQLite.Path == "" {
+			problems = append(problems, "the sqlite repository needs SQLITE_PATH")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown repository %q, must be one of: postgres, sqlite, memory", c.Repository))
+	}
+	return problems
+}
+
+type stringValue string
+
+func (s *stringValue) Set(v string) error {
+	*s = stringValue(v)
+	return nil
+}
+
+func (s *stringValue) String() string {
+	return string(*s)
+}
+
+type listValue []string
+
+func (l *listValue) Set(v string) error {
+	*l = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+type intValue int
+
+func (i *intValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*i = intValue(n)
+	return nil
+}
+
+func (i *intValue) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+type floatValue float64
+
+func (f *floatValue) Set(v string) error {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*f = floatValue(n)
+	return nil
+}
+
+func (f *floatValue) String() string {
+	return strconv.FormatFloat(float64(*f), 'g', -1, 64)
+}
+
+type durationValue time.Duration
+
+func (d *durationValue) Set(v string) error {
+	duration, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*d = durationValue(duration)
+	return nil
+}
+
+func (d *durationValue) String() string {
+	return time.Duration(*d).String()
+}
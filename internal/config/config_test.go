@@ -0,0 +1,262 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func getenv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	// docker and kubernetes set HOSTNAME to the container name, it isn't a setting
+	cfg, err := Load(nil, getenv(map[string]string{"SECRET": "secret", "HOSTNAME": "mimoto-5d8f7c9b4-x2lqp"}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := Default()
+	want.Secret = "secret"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Fatalf("config doesn't match: wanted %+v but got %+v", want, cfg)
+	}
+}
+
+func TestLoadPriority(t *testing.T) {
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{"mimoto.yaml", `
+port: "8081"
+secret: file
+deletionGracePeriod: 24h
+postgres:
+  host: db
+email:
+  provider: smtp
+  smtp:
+    host: mail
+    port: 2525
+`},
+		{"mimoto.toml", `
+port = "8081"
+secret = "file"
+deletionGracePeriod = "24h"
+
+[postgres]
+host = "db"
+
+[email]
+provider = "smtp"
+
+[email.smtp]
+host = "mail"
+port = 2525
+`},
+	} {
+		path := writeFile(t, file.name, file.content)
+		env := map[string]string{
+			"CONFIG_FILE": path,
+			"SECRET":      "env",
+			"SMTP_HOST":   "env-mail",
+			"PORT":        "8082",
+		}
+		cfg, err := Load([]string{"-port", "8083"}, getenv(env))
+		if err != nil {
+			t.Fatalf("%s: Load: %v", file.name, err)
+		}
+
+		if cfg.Port != "8083" {
+			t.Fatalf("%s: flag port doesn't match: wanted %v but got %v", file.name, "8083", cfg.Port)
+		}
+		if cfg.Secret != "env" || cfg.Email.SMTP.Host != "env-mail" {
+			t.Fatalf("%s: env doesn't override file: %+v", file.name, cfg)
+		}
+		if cfg.DeletionGracePeriod != 24*time.Hour || cfg.Postgres.Host != "db" || cfg.Email.Provider != "smtp" || cfg.Email.SMTP.Port != 2525 {
+			t.Fatalf("%s: file wasn't loaded: %+v", file.name, cfg)
+		}
+		// unset settings keep their defaults
+		if cfg.Postgres.Port != "5432" || cfg.Repository != "postgres" {
+			t.Fatalf("%s: defaults were overwritten: %+v", file.name, cfg)
+		}
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	secret := writeFile(t, "secret", "from-file\n")
+	cfg, err := Load(nil, getenv(map[string]string{"SECRET_FILE": secret}))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Secret != "from-file" {
+		t.Fatalf("secret doesn't match: wanted %q but got %q", "from-file", cfg.Secret)
+	}
+
+	_, err = Load(nil, getenv(map[string]string{"SECRET_FILE": secret, "SECRET": "env"}))
+	if err == nil {
+		t.Fatalf("Load: wanted error when SECRET and SECRET_FILE are both set")
+	}
+
+	_, err = Load(nil, getenv(map[string]string{"SECRET_FILE": filepath.Join(t.TempDir(), "missing")}))
+	if err == nil {
+		t.Fatalf("Load: wanted error for a missing secret file")
+	}
+
+	// secrets aren't flags
+	_, err = Load([]string{"-secret", "flag"}, getenv(map[string]string{"SECRET": "env"}))
+	if err == nil {
+		t.Fatalf("Load: wanted error for a secret flag")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"empty secret", nil, map[string]string{}, "missing secret"},
+		{"invalid port", []string{"-port", "http"}, map[string]string{"SECRET": "secret"}, "invalid port"},
+		{"invalid base url", nil, map[string]string{"SECRET": "secret", "BASE_URL": "mimoto"}, "invalid base url"},
+		{"invalid duration", nil, map[string]string{"SECRET": "secret", "DELETION_GRACE_PERIOD": "month"}, "DELETION_GRACE_PERIOD"},
+		{"negative duration", nil, map[string]string{"SECRET": "secret", "DELETION_GRACE_PERIOD": "-1h"}, "deletion grace period"},
+		{"negative timeout", nil, map[string]string{"SECRET": "secret", "HTTP_WRITE_TIMEOUT": "-1s"}, "http timeouts"},
+		{"negative snapshot interval", nil, map[string]string{"SECRET": "secret", "MEMORY_SNAPSHOT_INTERVAL": "-1m"}, "memory snapshot interval"},
+		{"invalid trusted proxy", nil, map[string]string{"SECRET": "secret", "TRUSTED_PROXIES": "10.0.0.0/8, ingress"}, "invalid trusted proxy \"ingress\""},
+		{"invalid webhook allowed network", nil, map[string]string{"SECRET": "secret", "WEBHOOK_ALLOWED_NETWORKS": "10.0.0.0/33"}, "invalid webhook allowed network"},
+		{"tls without key", nil, map[string]string{"SECRET": "secret", "TLS_CERT_FILE": "cert.pem"}, "TLS_KEY_FILE"},
+		{"unknown tracing exporter", nil, map[string]string{"SECRET": "secret", "TRACING_EXPORTER": "jaeger"}, "tracing exporter"},
+		{"invalid sample ratio", []string{"-tracing-sample-ratio", "2"}, map[string]string{"SECRET": "secret"}, "sample ratio"},
+		{"unknown repository", nil, map[string]string{"SECRET": "secret", "REPOSITORY": "mysql"}, "unknown repository"},
+		{"unknown audit sink", nil, map[string]string{"SECRET": "secret", "AUDIT_SINK": "syslog"}, "audit sink"},
+		{"file audit sink without path", []string{"-audit-sink", "file"}, map[string]string{"SECRET": "secret"}, "AUDIT_FILE_PATH"},
+		{"unknown file key", nil, map[string]string{"SECRET": "secret", "CONFIG_FILE": writeFile(t, "mimoto.yaml", "prot: 8080\n")}, "prot"},
+		{"unknown file format", nil, map[string]string{"SECRET": "secret", "CONFIG_FILE": writeFile(t, "mimoto.json", "{}")}, "unknown config file format"},
+	}
+	for _, test := range tests {
+		_, err := Load(test.args, getenv(test.env))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf("%s: error doesn't match: wanted %q but got %v", test.name, test.want, err)
+		}
+	}
+}
+
+func TestTokenPolicies(t *testing.T) {
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{"mimoto.yaml", `
+secret: secret
+tokens:
+  issuer: https://auth.mimoto.test
+  accessTtl: 1h
+  audiences:
+    web:
+      accessTtl: 15m
+      idleTimeout: 24h
+    mobile:
+      refreshTtl: 2160h
+`},
+		{"mimoto.toml", `
+secret = "secret"
+
+[tokens]
+issuer = "https://auth.mimoto.test"
+accessTtl = "1h"
+
+[tokens.audiences.web]
+accessTtl = "15m"
+idleTimeout = "24h"
+
+[tokens.audiences.mobile]
+refreshTtl = "2160h"
+`},
+	} {
+		cfg, err := Load(nil, getenv(map[string]string{"CONFIG_FILE": writeFile(t, file.name, file.content)}))
+		if err != nil {
+			t.Fatalf("%s: Load: %v", file.name, err)
+		}
+		tokens := cfg.Tokens
+		if tokens.Issuer != "https://auth.mimoto.test" {
+			t.Fatalf("%s: issuer doesn't match: wanted %v but got %v", file.name, "https://auth.mimoto.test", tokens.Issuer)
+		}
+
+		want := map[string]TokenPolicy{
+			"mimoto": {AccessTTL: time.Hour, RefreshTTL: 30 * 24 * time.Hour},
+			"web":    {AccessTTL: 15 * time.Minute, RefreshTTL: 30 * 24 * time.Hour, IdleTimeout: 24 * time.Hour},
+			"mobile": {AccessTTL: time.Hour, RefreshTTL: 90 * 24 * time.Hour},
+		}
+		for audience, policy := range want {
+			got, ok := tokens.Policy(audience)
+			if !ok || got != policy {
+				t.Fatalf("%s: %s policy doesn't match: wanted %+v but got %+v", file.name, audience, policy, got)
+			}
+		}
+		if tokens.ValidAudience("desktop") {
+			t.Fatalf("%s: unknown audience is valid", file.name)
+		}
+	}
+
+	_, err := Load(nil, getenv(map[string]string{"SECRET": "secret", "ACCESS_TOKEN_TTL": "0s"}))
+	if err == nil || !strings.Contains(err.Error(), "must be positive") {
+		t.Fatalf("Load error doesn't match: wanted %q but got %v", "must be positive", err)
+	}
+}
+
+func TestLoadFlags(t *testing.T) {
+	fs := flag.NewFlagSet("mimoto user create", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the user")
+	cfg, err := LoadFlags(fs, []string{"-name", "Test", "-port", "8081", "test@example.com"}, getenv(map[string]string{"TOKEN_KEYS_FILE": "keys.json"}))
+	if err != nil {
+		t.Fatalf("LoadFlags: %v", err)
+	}
+	if *name != "Test" {
+		t.Fatalf("name doesn't match: wanted %v but got %v", "Test", *name)
+	}
+	if cfg.Port != "8081" {
+		t.Fatalf("port doesn't match: wanted %v but got %v", "8081", cfg.Port)
+	}
+	// a keyring replaces the secret
+	if cfg.Tokens.KeysFile != "keys.json" {
+		t.Fatalf("keys file doesn't match: wanted %v but got %v", "keys.json", cfg.Tokens.KeysFile)
+	}
+	if args := fs.Args(); len(args) != 1 || args[0] != "test@example.com" {
+		t.Fatalf("args don't match: wanted %v but got %v", []string{"test@example.com"}, args)
+	}
+}
+
+func TestLoadDatabaseFlags(t *testing.T) {
+	// migrations run with only the database settings, everything else can be missing or invalid
+	env := map[string]string{"POSTGRES_HOST": "mimoto-postgres", "POSTGRES_DB": "mimoto", "BASE_URL": "mimoto"}
+	cfg, err := LoadDatabaseFlags(flag.NewFlagSet("mimoto migrate up", flag.ContinueOnError), nil, getenv(env))
+	if err != nil {
+		t.Fatalf("LoadDatabaseFlags: %v", err)
+	}
+	if cfg.Postgres.Host != "mimoto-postgres" || cfg.Postgres.DB != "mimoto" {
+		t.Fatalf("postgres config doesn't match: got %+v", cfg.Postgres)
+	}
+
+	_, err = LoadDatabaseFlags(flag.NewFlagSet("mimoto migrate up", flag.ContinueOnError), []string{"-repository", "sqlite", "-sqlite-path", ""}, getenv(env))
+	if err == nil || !strings.Contains(err.Error(), "SQLITE_PATH") {
+		t.Fatalf("error doesn't match: wanted %q but got %v", "SQLITE_PATH", err)
+	}
+}
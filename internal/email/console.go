@@ -0,0 +1,28 @@
+package email
+
+import (
+	"context"
+	"fmt"
+)
+
+// ConsoleSender prints messages to stdout instead of delivering them.
+type ConsoleSender struct {
+	from string
+}
+
+func NewConsole(from string) (ConsoleSender, error) {
+	return ConsoleSender{
+		from: from,
+	}, nil
+}
+
+func (cs ConsoleSender) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	from := fmt.Sprintf("noreply <%s>", cs.from)
+	to := fmt.Sprintf("%s <%s>", msg.Name, msg.Email)
+	fmt.Println(from, to, msg.Subject)
+	fmt.Println(msg.Text)
+	return nil
+}
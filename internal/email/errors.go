@@ -0,0 +1,60 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+var (
+	// ErrPermanent is matched by delivery failures that won't succeed when retried.
+	ErrPermanent = errors.New("permanent delivery failure")
+	// ErrTemporary is matched by delivery failures that may succeed when retried.
+	ErrTemporary = errors.New("temporary delivery failure")
+	// ErrSuppressed is returned for recipients on the suppression list.
+	ErrSuppressed = errors.New("recipient is suppressed")
+)
+
+// ProviderError is a failed delivery reported by an email provider.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Message    string
+	Permanent  bool
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s responded %d: %s", e.Provider, e.StatusCode, e.Message)
+}
+
+func (e *ProviderError) Is(target error) bool {
+	return (target == ErrPermanent && e.Permanent) || (target == ErrTemporary && !e.Permanent)
+}
+
+// httpError returns the ProviderError for an HTTP API response, or nil for 2xx responses.
+// Rate limits and server errors are temporary, other client errors are permanent.
+func httpError(provider string, statusCode int, body string) error {
+	if statusCode >= 200 && statusCode <= 299 {
+		return nil
+	}
+	return &ProviderError{
+		Provider:   provider,
+		StatusCode: statusCode,
+		Message:    body,
+		Permanent:  statusCode >= 400 && statusCode <= 499 && statusCode != 429,
+	}
+}
+
+// smtpError returns the ProviderError for an SMTP reply, 5xx replies are permanent.
+func smtpError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return &ProviderError{
+			Provider:   "smtp",
+			StatusCode: tpErr.Code,
+			Message:    tpErr.Msg,
+			Permanent:  tpErr.Code >= 500,
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrTemporary, err)
+}
@@ -0,0 +1,43 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+)
+
+func TestHTTPError(t *testing.T) {
+	tests := map[int]error{
+		200: nil,
+		202: nil,
+		400: ErrPermanent,
+		401: ErrPermanent,
+		429: ErrTemporary,
+		500: ErrTemporary,
+		503: ErrTemporary,
+	}
+	for statusCode, want := range tests {
+		err := httpError("test", statusCode, "body")
+		if want == nil {
+			if err != nil {
+				t.Fatalf("%d: wanted no error but got %v", statusCode, err)
+			}
+			continue
+		}
+		if !errors.Is(err, want) {
+			t.Fatalf("%d: error doesn't match: wanted %v but got %v", statusCode, want, err)
+		}
+	}
+}
+
+func TestSMTPError(t *testing.T) {
+	if err := smtpError(&textproto.Error{Code: 550, Msg: "no such user"}); !errors.Is(err, ErrPermanent) {
+		t.Fatalf("550 error doesn't match: wanted %v but got %v", ErrPermanent, err)
+	}
+	if err := smtpError(&textproto.Error{Code: 451, Msg: "try again later"}); !errors.Is(err, ErrTemporary) {
+		t.Fatalf("451 error doesn't match: wanted %v but got %v", ErrTemporary, err)
+	}
+	if err := smtpError(errors.New("connection reset")); !errors.Is(err, ErrTemporary) {
+		t.Fatalf("network error doesn't match: wanted %v but got %v", ErrTemporary, err)
+	}
+}
@@ -0,0 +1,120 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	EventDelivered  = "delivered"
+	EventBounce     = "bounce"
+	EventDropped    = "dropped"
+	EventSpamReport = "spamreport"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Event is a delivery event reported by an email provider.
+type Event struct {
+	Provider string
+	// ID is the provider's id for the event, used to ignore duplicate deliveries.
+	ID        string
+	Email     string
+	Type      string
+	Reason    string
+	Hard      bool
+	Timestamp time.Time
+}
+
+// Suppresses reports whether the recipient of the event should no longer be emailed.
+func (e Event) Suppresses() bool {
+	switch e.Type {
+	case EventBounce:
+		return e.Hard
+	case EventDropped, EventSpamReport:
+		return true
+	}
+	return false
+}
+
+type sendGridEvent struct {
+	Email     string `json:"email"`
+	Timestamp int64  `json:"timestamp"`
+	Event     string `json:"event"`
+	EventID   string `json:"sg_event_id"`
+	Reason    string `json:"reason"`
+	Type      string `json:"type"`
+}
+
+// ParseSendGridEvents returns the delivered, bounce, dropped and spamreport events in an event webhook body.
+func ParseSendGridEvents(body []byte) ([]Event, error) {
+	sgEvents := make([]sendGridEvent, 0)
+	if err := json.Unmarshal(body, &sgEvents); err != nil {
+		return nil, fmt.Errorf("decode sendgrid events: %w", err)
+	}
+
+	events := make([]Event, 0, len(sgEvents))
+	for _, e := range sgEvents {
+		switch e.Event {
+		case EventDelivered, EventBounce, EventDropped, EventSpamReport:
+		default:
+			continue
+		}
+		events = append(events, Event{
+			Provider:  "sendgrid",
+			ID:        e.EventID,
+			Email:     e.Email,
+			Type:      e.Event,
+			Reason:    e.Reason,
+			Hard:      e.Event == EventBounce && e.Type != "blocked",
+			Timestamp: time.Unix(e.Timestamp, 0).UTC(),
+		})
+	}
+	return events, nil
+}
+
+// ParseSendGridPublicKey parses the base64 verification key of a signed event webhook.
+func ParseSendGridPublicKey(key string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decode sendgrid public key: %w", err)
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse sendgrid public key: %w", err)
+	}
+	ecdsaKey, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("sendgrid public key isn't an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// VerifySendGridSignature checks the X-Twilio-Email-Event-Webhook-Signature and -Timestamp headers
+// of an event webhook, rejecting timestamps older than maxAge.
+func VerifySendGridSignature(publicKey *ecdsa.PublicKey, signature, timestamp string, body []byte, maxAge time.Duration) error {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if age := time.Since(time.Unix(unix, 0)); age > maxAge || age < -maxAge {
+		return fmt.Errorf("%w: timestamp is too old", ErrInvalidSignature)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	if !ecdsa.VerifyASN1(publicKey, digest[:], sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSendGridSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	pub, err := ParseSendGridPublicKey(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		t.Fatalf("ParseSendGridPublicKey: %v", err)
+	}
+
+	sign := func(timestamp string, body []byte) string {
+		digest := sha256.Sum256(append([]byte(timestamp), body...))
+		sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("SignASN1: %v", err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	body := []byte(`[{"email":"test@test.com","event":"delivered"}]`)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	err = VerifySendGridSignature(pub, sign(timestamp, body), timestamp, body, time.Minute)
+	if err != nil {
+		t.Fatalf("VerifySendGridSignature: %v", err)
+	}
+
+	err = VerifySendGridSignature(pub, sign(timestamp, body), timestamp, []byte(`[]`), time.Minute)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("tampered body error doesn't match: wanted %v but got %v", ErrInvalidSignature, err)
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	err = VerifySendGridSignature(pub, sign(old, body), old, body, time.Minute)
+	if !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("old timestamp error doesn't match: wanted %v but got %v", ErrInvalidSignature, err)
+	}
+}
+
+func TestParseSendGridEvents(t *testing.T) {
+	body := []byte(`[
+		{"email":"a@test.com","timestamp":1600000000,"event":"delivered","sg_event_id":"1"},
+		{"email":"b@test.com","timestamp":1600000000,"event":"bounce","type":"bounce","reason":"550 no such user","sg_event_id":"2"},
+		{"email":"c@test.com","timestamp":1600000000,"event":"bounce","type":"blocked","sg_event_id":"3"},
+		{"email":"d@test.com","timestamp":1600000000,"event":"spamreport","sg_event_id":"4"},
+		{"email":"e@test.com","timestamp":1600000000,"event":"open","sg_event_id":"5"}
+	]`)
+	events, err := ParseSendGridEvents(body)
+	if err != nil {
+		t.Fatalf("ParseSendGridEvents: %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("wanted %v events but got %v", 4, len(events))
+	}
+
+	suppresses := map[string]bool{"a@test.com": false, "b@test.com": true, "c@test.com": false, "d@test.com": true}
+	for _, e := range events {
+		if e.Suppresses() != suppresses[e.Email] {
+			t.Fatalf("%s suppresses doesn't match: wanted %v but got %v", e.Email, suppresses[e.Email], e.Suppresses())
+		}
+		if e.Provider != "sendgrid" || e.Timestamp.Unix() != 1600000000 {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	}
+
+	_, err = ParseSendGridEvents([]byte(`{`))
+	if err == nil {
+		t.Fatalf("ParseSendGridEvents: wanted an error for malformed json")
+	}
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSender appends messages to a file in mbox format, so they can be read with a mail client.
+type FileSender struct {
+	path string
+	from string
+	mu   *sync.Mutex
+}
+
+func NewFile(path, from string) (FileSender, error) {
+	if path == "" {
+		return FileSender{}, fmt.Errorf("missing email file path")
+	}
+	return FileSender{
+		path: path,
+		from: from,
+		mu:   &sync.Mutex{},
+	}, nil
+}
+
+func (fs FileSender) Send(ctx context.Context, msg Message) error {
+	data, err := buildMIME(fs.from, "", msg)
+	if err != nil {
+		return err
+	}
+
+	entry := bytes.Buffer{}
+	fmt.Fprintf(&entry, "From %s %s\n", fs.from, time.Now().UTC().Format(time.ANSIC))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		// escape lines that would be read as the start of the next message
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		entry.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	entry.WriteString("\n")
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	// a message is written whole or not at all, so only check before writing
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(entry.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Ping checks the directory of the file exists.
+func (fs FileSender) Ping(ctx context.Context) error {
+	dir := filepath.Dir(fs.path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s isn't a directory", dir)
+	}
+	return nil
+}
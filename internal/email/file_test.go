@@ -0,0 +1,83 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSender(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mbox")
+	fs, err := NewFile(path, "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		err = fs.Send(ctx, Message{
+			Name:    "test",
+			Email:   "test@test.com",
+			Subject: "Email Confirmation",
+			Text:    "From here, confirm your account.",
+			HTML:    "<p>confirm your account</p>",
+		})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	mbox := string(b)
+	if n := strings.Count(mbox, "\nFrom noreply@mimoto.test ") + 1; !strings.HasPrefix(mbox, "From noreply@mimoto.test ") || n != 2 {
+		t.Fatalf("wanted %v messages in mbox but got %v:\n%s", 2, n, mbox)
+	}
+	if !strings.Contains(mbox, "\n>From here, confirm your account.") {
+		t.Fatalf("From line in body wasn't escaped:\n%s", mbox)
+	}
+	if strings.Contains(mbox, "\r") {
+		t.Fatalf("mbox contains CRLF line endings")
+	}
+}
+
+func TestFileSenderPing(t *testing.T) {
+	fs, err := NewFile(filepath.Join(t.TempDir(), "mbox"), "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	if err := fs.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	fs, err = NewFile(filepath.Join(t.TempDir(), "missing", "mbox"), "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+	if err := fs.Ping(context.Background()); err == nil {
+		t.Fatalf("Ping: wanted error for missing directory")
+	}
+}
+
+func TestFileSenderCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mbox")
+	fs, err := NewFile(path, "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewFile: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = fs.Send(ctx, Message{Email: "test@test.com"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("canceled message was written: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// buildMIME formats msg as a multipart/alternative message with text and html parts.
+func buildMIME(from, listUnsubscribe string, msg Message) ([]byte, error) {
+	messageID, err := newMessageID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make(textproto.MIMEHeader)
+	for k, v := range msg.Headers {
+		header.Set(k, v)
+	}
+	header.Set("From", (&mail.Address{Name: "noreply", Address: from}).String())
+	header.Set("To", (&mail.Address{Name: msg.Name, Address: msg.Email}).String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID)
+	header.Set("MIME-Version", "1.0")
+	if listUnsubscribe != "" {
+		header.Set("List-Unsubscribe", "<"+listUnsubscribe+">")
+	}
+
+	body := bytes.Buffer{}
+	mw := multipart.NewWriter(&body)
+	header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	data := bytes.Buffer{}
+	for _, k := range keys {
+		for _, v := range header[k] {
+			fmt.Fprintf(&data, "%s: %s\r\n", k, v)
+		}
+	}
+	data.WriteString("\r\n")
+	data.Write(body.Bytes())
+	return data.Bytes(), nil
+}
+
+func newMessageID(from string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	domain := "mimoto"
+	if i := strings.LastIndex(from, "@"); i != -1 {
+		domain = from[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain), nil
+}
@@ -0,0 +1,73 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/broswen/mimoto/internal/config"
+)
+
+// SenderFactory builds a Sender from the email configuration.
+type SenderFactory func(cfg config.EmailConfig) (Sender, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]SenderFactory{
+		"console": func(cfg config.EmailConfig) (Sender, error) {
+			return NewConsole(cfg.From)
+		},
+		"sendgrid": func(cfg config.EmailConfig) (Sender, error) {
+			return NewSendGrid(cfg.SendGridAPIKey, cfg.From)
+		},
+		"smtp": func(cfg config.EmailConfig) (Sender, error) {
+			return NewSMTP(SMTPConfig{
+				Host:            cfg.SMTP.Host,
+				Port:            cfg.SMTP.Port,
+				Username:        cfg.SMTP.Username,
+				Password:        cfg.SMTP.Password,
+				TLS:             cfg.SMTP.TLS,
+				Auth:            cfg.SMTP.Auth,
+				From:            cfg.From,
+				ListUnsubscribe: cfg.SMTP.ListUnsubscribe,
+			})
+		},
+		"file": func(cfg config.EmailConfig) (Sender, error) {
+			return NewFile(cfg.FilePath, cfg.From)
+		},
+		"webhook": func(cfg config.EmailConfig) (Sender, error) {
+			return NewWebhook(cfg.WebhookURL, cfg.WebhookToken, cfg.From)
+		},
+	}
+)
+
+// RegisterProvider makes a Sender available to NewSender by name, replacing any provider with the same name.
+func RegisterProvider(name string, factory SenderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// Providers returns the names of the registered providers.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSender builds the Sender of the provider named in the config.
+func NewSender(cfg config.EmailConfig) (Sender, error) {
+	providersMu.RLock()
+	factory, ok := providers[cfg.Provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown email provider %q, must be one of: %s", cfg.Provider, strings.Join(Providers(), ", "))
+	}
+	return factory(cfg)
+}
@@ -0,0 +1,60 @@
+package email
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/config"
+)
+
+func TestNewSender(t *testing.T) {
+	cfg := config.Default().Email
+	cfg.From = "noreply@mimoto.test"
+	cfg.SendGridAPIKey = "key"
+	cfg.SMTP.Host = "localhost"
+	cfg.SMTP.Port = 2525
+	cfg.FilePath = filepath.Join(t.TempDir(), "mbox")
+	cfg.WebhookURL = "http://localhost/email"
+
+	for _, name := range []string{"console", "sendgrid", "smtp", "file", "webhook"} {
+		cfg.Provider = name
+		_, err := NewSender(cfg)
+		if err != nil {
+			t.Fatalf("NewSender %s: %v", name, err)
+		}
+	}
+
+	cfg.Provider = "none"
+	_, err := NewSender(cfg)
+	if err == nil {
+		t.Fatalf("NewSender: wanted error for unknown provider")
+	}
+
+	cfg.Provider = "sendgrid"
+	cfg.SendGridAPIKey = ""
+	_, err = NewSender(cfg)
+	if err == nil {
+		t.Fatalf("NewSender: wanted error for missing sendgrid api key")
+	}
+}
+
+func TestRegisterProvider(t *testing.T) {
+	ctx := context.Background()
+	messages := make([]Message, 0)
+	RegisterProvider("recording", func(cfg config.EmailConfig) (Sender, error) {
+		return recordingSender{&messages}, nil
+	})
+
+	sender, err := NewSender(config.EmailConfig{Provider: "recording"})
+	if err != nil {
+		t.Fatalf("NewSender: %v", err)
+	}
+	err = sender.Send(ctx, Message{Email: "test@test.com"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("wanted %v messages but got %v", 1, len(messages))
+	}
+}
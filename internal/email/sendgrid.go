@@ -0,0 +1,63 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// sendGridAPI is the base url of the SendGrid API.
+const sendGridAPI = "https://api.sendgrid.com"
+
+type SendGridSender struct {
+	sgClient *sendgrid.Client
+	apiKey   string
+	from     string
+}
+
+func NewSendGrid(apiKey, from string) (SendGridSender, error) {
+	if apiKey == "" {
+		return SendGridSender{}, errors.New("missing sendgrid api key")
+	}
+	sgClient := sendgrid.NewSendClient(apiKey)
+	return SendGridSender{
+		sgClient: sgClient,
+		apiKey:   apiKey,
+		from:     from,
+	}, nil
+}
+
+func (s SendGridSender) Send(ctx context.Context, msg Message) error {
+	from := mail.NewEmail("noreply", s.from)
+	to := mail.NewEmail(msg.Name, msg.Email)
+	message := mail.NewSingleEmail(from, msg.Subject, to, msg.Text, msg.HTML)
+	for k, v := range msg.Headers {
+		message.SetHeader(k, v)
+	}
+	response, err := s.sgClient.SendWithContext(ctx, message)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	return httpError("sendgrid", response.StatusCode, response.Body)
+}
+
+// Ping checks SendGrid is reachable and accepts the api key.
+func (s SendGridSender) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sendGridAPI+"/v3/scopes", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTemporary, err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return httpError("sendgrid", res.StatusCode, string(b))
+}
@@ -1,90 +1,174 @@
 package email
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"net/url"
+	"time"
+)
+
+// Kinds of email, each rendered from the template with the same name.
+const (
+	KindConfirmation        = "confirmation"
+	KindConfirmationSuccess = "confirmation_success"
+	KindReset               = "reset"
 
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	KindNewDeviceLogin    = "new_device_login"
+	KindPasswordChanged   = "password_changed"
+	KindAccountLocked     = "account_locked"
+	KindRefreshTokenReuse = "refresh_token_reuse"
 )
 
-type EmailService interface {
-	Send(name, email, subject, text, html string) error
-	SendConfirmation(name, email, code string) error
-	SendConfirmationSuccess(name, email string) error
-	SendReset(name, email, code string) error
+// SecurityKinds are the kinds of security notification.
+var SecurityKinds = []string{
+	KindNewDeviceLogin,
+	KindPasswordChanged,
+	KindAccountLocked,
+	KindRefreshTokenReuse,
 }
 
-type ConsoleService struct {
+// IsSecurityKind reports whether kind is one of SecurityKinds.
+func IsSecurityKind(kind string) bool {
+	for _, k := range SecurityKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
 }
 
-func NewConsole() (ConsoleService, error) {
-	return ConsoleService{}, nil
+type Recipient struct {
+	Name   string
+	Email  string
+	Locale string
+	// Timezone is used to format times, UTC if it's empty or unknown.
+	Timezone string
 }
 
-func (cs ConsoleService) Send(name, email, subject, text, html string) error {
-	from := fmt.Sprintf("noreply <%s>", os.Getenv("NOREPLY_EMAIL"))
-	to := fmt.Sprintf("%s <%s>", name, email)
-	fmt.Println(from, to, text)
-	return nil
+// Activity is when and where a security event happened, IP and UserAgent are empty for events without a request.
+type Activity struct {
+	Time      time.Time
+	IP        string
+	UserAgent string
 }
 
-func (cs ConsoleService) SendConfirmation(name, email, code string) error {
-	text := fmt.Sprintf("Please click this link to confirm your account.\n%s/confirm?email=%s&code=%s", os.Getenv("HOSTNAME"), email, code)
-
-	return cs.Send(name, email, "Email Confirmation", text, text)
+type Message struct {
+	Name    string
+	Email   string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the message by senders that support custom headers.
+	Headers map[string]string
 }
 
-func (cs ConsoleService) SendConfirmationSuccess(name, email string) error {
-	text := fmt.Sprintf("Your email was successfully confirmed!")
+// Sender delivers a rendered message through an email provider.
+type Sender interface {
+	// Send gives up when ctx is done, returning an error wrapping ctx.Err().
+	Send(ctx context.Context, msg Message) error
+}
 
-	return cs.Send(name, email, "Email Confirmation", text, text)
+type EmailService interface {
+	SendConfirmation(ctx context.Context, to Recipient, code string) error
+	SendConfirmationSuccess(ctx context.Context, to Recipient) error
+	SendReset(ctx context.Context, to Recipient, code string) error
+	SendSecurityNotification(ctx context.Context, to Recipient, kind string, activity Activity) error
 }
 
-func (cs ConsoleService) SendReset(name, email, code string) error {
-	text := fmt.Sprintf("Please click this link to reset your account password.\n%s/reset?email=%s&code=%s", os.Getenv("HOSTNAME"), email, code)
+// Pinger is implemented by senders that can check their provider is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
 
-	return cs.Send(name, email, "Reset Password", text, text)
+// SuppressionList holds the recipients that must not be emailed, e.g. after a hard bounce.
+type SuppressionList interface {
+	IsSuppressed(ctx context.Context, email string) (bool, error)
 }
 
-type SendGridService struct {
-	sgClient *sendgrid.Client
+type Service struct {
+	sender       Sender
+	templates    *Templates
+	suppressions SuppressionList
+	baseURL      string
 }
 
-func NewSendGrid() (SendGridService, error) {
-	sgClient := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
-	return SendGridService{
-		sgClient: sgClient,
+// New builds a Service that checks suppressions before every send, if it isn't nil.
+// Links in emails start with baseURL.
+func New(sender Sender, templates *Templates, suppressions SuppressionList, baseURL string) (Service, error) {
+	return Service{
+		sender:       sender,
+		templates:    templates,
+		suppressions: suppressions,
+		baseURL:      baseURL,
 	}, nil
 }
 
-func (s SendGridService) Send(name, email, subject, text, html string) error {
-	from := mail.NewEmail("noreply", os.Getenv("NOREPLY_EMAIL"))
-	to := mail.NewEmail(name, email)
-	message := mail.NewSingleEmail(from, subject, to, text, html)
-	response, err := s.sgClient.Send(message)
-	log.Println(response)
+// Ping checks the sender's provider is reachable, senders that can't be checked always are.
+func (s Service) Ping(ctx context.Context) error {
+	pinger, ok := s.sender.(Pinger)
+	if !ok {
+		return nil
+	}
+	return pinger.Ping(ctx)
+}
+
+func (s Service) send(ctx context.Context, to Recipient, name string, data Data) error {
+	if s.suppressions != nil {
+		suppressed, err := s.suppressions.IsSuppressed(ctx, to.Email)
+		if err != nil {
+			return fmt.Errorf("check suppression list: %w", err)
+		}
+		if suppressed {
+			return ErrSuppressed
+		}
+	}
+
+	data.Name = to.Name
+	data.Email = to.Email
+	rendered, err := s.templates.Render(name, to.Locale, data)
 	if err != nil {
-		return err
+		return fmt.Errorf("render %s: %w", name, err)
 	}
-	return nil
+	return s.sender.Send(ctx, Message{
+		Name:    to.Name,
+		Email:   to.Email,
+		Subject: rendered.Subject,
+		Text:    rendered.Text,
+		HTML:    rendered.HTML,
+	})
 }
 
-func (s SendGridService) SendConfirmation(name, email, code string) error {
-	text := fmt.Sprintf("Please click this link to confirm your account.\n%s/confirm?email=%s&code=%s", os.Getenv("HOSTNAME"), email, code)
+func (s Service) link(path, email, code string) string {
+	query := url.Values{}
+	query.Set("email", email)
+	query.Set("code", code)
+	return fmt.Sprintf("%s%s?%s", s.baseURL, path, query.Encode())
+}
 
-	return s.Send(name, email, "Email Confirmation", text, text)
+func (s Service) SendConfirmation(ctx context.Context, to Recipient, code string) error {
+	return s.send(ctx, to, KindConfirmation, Data{Link: s.link("/confirm", to.Email, code)})
 }
 
-func (s SendGridService) SendConfirmationSuccess(name, email string) error {
-	text := fmt.Sprintf("Your email was successfully confirmed!")
+func (s Service) SendConfirmationSuccess(ctx context.Context, to Recipient) error {
+	return s.send(ctx, to, KindConfirmationSuccess, Data{})
+}
 
-	return s.Send(name, email, "Email Confirmation", text, text)
+func (s Service) SendReset(ctx context.Context, to Recipient, code string) error {
+	return s.send(ctx, to, KindReset, Data{Link: s.link("/reset", to.Email, code)})
 }
 
-func (s SendGridService) SendReset(name, email, code string) error {
-	text := fmt.Sprintf("Please click this link to reset your account password.\n%s/reset?email=%s&code=%s", os.Getenv("HOSTNAME"), email, code)
+func (s Service) SendSecurityNotification(ctx context.Context, to Recipient, kind string, activity Activity) error {
+	if !IsSecurityKind(kind) {
+		return fmt.Errorf("unknown security notification: %s", kind)
+	}
 
-	return s.Send(name, email, "Reset Password", text, text)
+	loc, err := time.LoadLocation(to.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return s.send(ctx, to, kind, Data{
+		Time:      activity.Time.In(loc).Format("2006-01-02 15:04 MST"),
+		IP:        activity.IP,
+		UserAgent: activity.UserAgent,
+	})
 }
@@ -1,25 +1,152 @@
 package email
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingSender struct {
+	messages *[]Message
+}
+
+func (rs recordingSender) Send(ctx context.Context, msg Message) error {
+	*rs.messages = append(*rs.messages, msg)
+	return nil
+}
+
+type suppressionList map[string]bool
+
+func (sl suppressionList) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	return sl[email], nil
+}
 
 func TestConsoleService(t *testing.T) {
-	cs, err := NewConsole()
+	ctx := context.Background()
+	cs, err := NewConsole("noreply@mimoto.test")
 	if err != nil {
 		t.Fatalf("NewConsole: %v", err)
 	}
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+	es, err := New(cs, templates, nil, "https://mimoto.test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
 
-	err = cs.SendConfirmation("test", "test@test.com", "12345")
+	to := Recipient{Name: "test", Email: "test@test.com"}
+	err = es.SendConfirmation(ctx, to, "12345")
 	if err != nil {
 		t.Fatalf("SendConfirmation: %v", err)
 	}
 
-	err = cs.SendConfirmationSuccess("test", "test@test.com")
+	err = es.SendConfirmationSuccess(ctx, to)
 	if err != nil {
 		t.Fatalf("SendConfirmationSuccess: %v", err)
 	}
 
-	err = cs.SendReset("test", "test@test.com", "12345")
+	err = es.SendReset(ctx, to, "12345")
 	if err != nil {
 		t.Fatalf("SendReset: %v", err)
 	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	err = es.SendReset(canceled, to, "12345")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("SendReset error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestServiceLocale(t *testing.T) {
+	ctx := context.Background()
+	messages := make([]Message, 0)
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+	es, err := New(recordingSender{&messages}, templates, nil, "https://mimoto.test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	err = es.SendReset(ctx, Recipient{Name: "test", Email: "test+1@test.com", Locale: "es-MX"}, "12345")
+	if err != nil {
+		t.Fatalf("SendReset: %v", err)
+	}
+
+	if len(messages) != 1 {
+		t.Fatalf("wanted %v messages but got %v", 1, len(messages))
+	}
+	if messages[0].Subject != "Restablecer contraseña" {
+		t.Fatalf("subject doesn't match: wanted %v but got %v", "Restablecer contraseña", messages[0].Subject)
+	}
+	if messages[0].Text == messages[0].HTML {
+		t.Fatalf("text and html bodies are the same")
+	}
+	if !strings.Contains(messages[0].Text, "https://mimoto.test/reset?") {
+		t.Fatalf("text doesn't contain the reset link:\n%s", messages[0].Text)
+	}
+}
+
+func TestServiceSuppression(t *testing.T) {
+	ctx := context.Background()
+	messages := make([]Message, 0)
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+	es, err := New(recordingSender{&messages}, templates, suppressionList{"bounced@test.com": true}, "https://mimoto.test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	err = es.SendReset(ctx, Recipient{Name: "test", Email: "bounced@test.com"}, "12345")
+	if !errors.Is(err, ErrSuppressed) {
+		t.Fatalf("SendReset error doesn't match: wanted %v but got %v", ErrSuppressed, err)
+	}
+	err = es.SendReset(ctx, Recipient{Name: "test", Email: "test@test.com"}, "12345")
+	if err != nil {
+		t.Fatalf("SendReset: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("wanted %v messages but got %v", 1, len(messages))
+	}
+}
+
+func TestSecurityNotification(t *testing.T) {
+	ctx := context.Background()
+	messages := make([]Message, 0)
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+	es, err := New(recordingSender{&messages}, templates, nil, "https://mimoto.test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	to := Recipient{Name: "test", Email: "test@test.com", Timezone: "America/New_York"}
+	activity := Activity{Time: time.Date(2021, 9, 1, 16, 0, 0, 0, time.UTC), IP: "203.0.113.1", UserAgent: "laptop"}
+	err = es.SendSecurityNotification(ctx, to, KindPasswordChanged, activity)
+	if err != nil {
+		t.Fatalf("SendSecurityNotification: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("wanted %v messages but got %v", 1, len(messages))
+	}
+	for _, want := range []string{"2021-09-01 12:00 EDT", "203.0.113.1", "laptop"} {
+		if !strings.Contains(messages[0].Text, want) {
+			t.Fatalf("text doesn't contain %q:\n%s", want, messages[0].Text)
+		}
+	}
+
+	err = es.SendSecurityNotification(ctx, to, KindReset, activity)
+	if err == nil {
+		t.Fatalf("SendSecurityNotification: wanted an error for a non-security kind")
+	}
 }
@@ -0,0 +1,290 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "implicit"
+
+	SMTPAuthNone    = ""
+	SMTPAuthPlain   = "plain"
+	SMTPAuthLogin   = "login"
+	SMTPAuthCRAMMD5 = "cram-md5"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// TLS is one of SMTPTLSNone, SMTPTLSStartTLS or SMTPTLSImplicit.
+	TLS string
+	// Auth is one of SMTPAuthNone, SMTPAuthPlain, SMTPAuthLogin or SMTPAuthCRAMMD5.
+	Auth string
+	// TLSConfig is optional, ServerName defaults to Host.
+	TLSConfig *tls.Config
+	Timeout   time.Duration
+	From      string
+	// ListUnsubscribe is the url or mailto: address added as the List-Unsubscribe header.
+	ListUnsubscribe string
+}
+
+// SMTPSender delivers messages to an SMTP server, reusing its connection between messages.
+type SMTPSender struct {
+	config SMTPConfig
+	conn   *smtpConn
+}
+
+type smtpConn struct {
+	mu     sync.Mutex
+	client *smtp.Client
+	// conn is the connection of client, kept to interrupt it.
+	conn net.Conn
+}
+
+// close ends the connection without waiting for the server.
+func (c *smtpConn) close() {
+	if c.client != nil {
+		c.client.Close()
+	}
+	c.client = nil
+	c.conn = nil
+}
+
+// interruptOnDone interrupts reads and writes of conn when ctx is done, until the returned func is called.
+func interruptOnDone(ctx context.Context, conn net.Conn) func() {
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	return func() {
+		stop()
+		conn.SetDeadline(time.Time{})
+	}
+}
+
+func NewSMTP(config SMTPConfig) (SMTPSender, error) {
+	if config.Host == "" {
+		return SMTPSender{}, errors.New("missing smtp host")
+	}
+	if config.From == "" {
+		return SMTPSender{}, errors.New("missing smtp from address")
+	}
+	if config.Port == 0 {
+		config.Port = 587
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	switch config.TLS {
+	case "":
+		config.TLS = SMTPTLSStartTLS
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+	default:
+		return SMTPSender{}, fmt.Errorf("unknown smtp tls mode: %s", config.TLS)
+	}
+	switch config.Auth {
+	case SMTPAuthNone, SMTPAuthPlain, SMTPAuthLogin, SMTPAuthCRAMMD5:
+	default:
+		return SMTPSender{}, fmt.Errorf("unknown smtp auth mechanism: %s", config.Auth)
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TLSConfig != nil {
+		tlsConfig = config.TLSConfig.Clone()
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = config.Host
+	}
+	config.TLSConfig = tlsConfig
+
+	return SMTPSender{
+		config: config,
+		conn:   &smtpConn{},
+	}, nil
+}
+
+func (s SMTPSender) Send(ctx context.Context, msg Message) error {
+	data, err := buildMIME(s.config.From, s.config.ListUnsubscribe, msg)
+	if err != nil {
+		return err
+	}
+
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err = s.connect(ctx)
+	if err == nil {
+		stop := interruptOnDone(ctx, s.conn.conn)
+		err = s.deliver(s.conn.client, msg.Email, data)
+		stop()
+		if err != nil {
+			s.conn.close()
+		}
+	}
+	// errors caused by the cancellation aren't the server's fault
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("smtp: %w", ctx.Err())
+	}
+	return err
+}
+
+// connect reuses the open connection if the server hasn't closed it, or dials a new one.
+func (s SMTPSender) connect(ctx context.Context) error {
+	if s.conn.client != nil {
+		stop := interruptOnDone(ctx, s.conn.conn)
+		err := s.conn.client.Noop()
+		stop()
+		if err == nil {
+			return nil
+		}
+		s.conn.close()
+	}
+	client, conn, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	s.conn.client = client
+	s.conn.conn = conn
+	return nil
+}
+
+// Ping checks the server accepts the connection and credentials,
+// keeping the connection open for the next message.
+func (s SMTPSender) Ping(ctx context.Context) error {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	return s.connect(ctx)
+}
+
+// Close ends the open connection, if there is one.
+func (s SMTPSender) Close() error {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+	if s.conn.client == nil {
+		return nil
+	}
+	err := s.conn.client.Quit()
+	s.conn.close()
+	return err
+}
+
+// dial connects and authenticates to the server, giving up when ctx is done or the timeout passes.
+func (s SMTPSender) dial(ctx context.Context) (*smtp.Client, net.Conn, error) {
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if s.config.TLS == SMTPTLSImplicit {
+		dialer := &tls.Dialer{Config: s.config.TLSConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		dialer := &net.Dialer{}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("dial smtp: %w", smtpError(err))
+	}
+
+	// the greeting, STARTTLS and auth are interrupted like the dial
+	defer interruptOnDone(ctx, conn)()
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("smtp greeting: %w", smtpError(err))
+	}
+
+	if s.config.TLS == SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, nil, errors.New("smtp server doesn't support STARTTLS")
+		}
+		if err := client.StartTLS(s.config.TLSConfig); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if auth := s.auth(); auth != nil {
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, nil, fmt.Errorf("smtp auth: %w", smtpError(err))
+		}
+	}
+	return client, conn, nil
+}
+
+func (s SMTPSender) auth() smtp.Auth {
+	switch s.config.Auth {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	case SMTPAuthLogin:
+		return loginAuth{username: s.config.Username, password: s.config.Password}
+	case SMTPAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(s.config.Username, s.config.Password)
+	}
+	return nil
+}
+
+func (s SMTPSender) deliver(client *smtp.Client, to string, data []byte) error {
+	if err := client.Mail(s.config.From); err != nil {
+		return fmt.Errorf("smtp mail: %w", smtpError(err))
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp rcpt: %w", smtpError(err))
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", smtpError(err))
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("smtp data: %w", smtpError(err))
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", smtpError(err))
+	}
+	return nil
+}
+
+// loginAuth implements the LOGIN mechanism, which net/smtp doesn't provide.
+// Like smtp.PlainAuth it refuses to send credentials without TLS unless the server is local.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+}
@@ -0,0 +1,242 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email/smtptest"
+)
+
+func TestSMTPSender(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name   string
+		server smtptest.Config
+		tls    string
+		auth   string
+	}{
+		{"plain text without auth", smtptest.Config{}, SMTPTLSNone, SMTPAuthNone},
+		{"starttls with plain auth", smtptest.Config{Username: "user", Password: "pass", STARTTLS: true}, SMTPTLSStartTLS, SMTPAuthPlain},
+		{"starttls with login auth", smtptest.Config{Username: "user", Password: "pass", STARTTLS: true}, SMTPTLSStartTLS, SMTPAuthLogin},
+		{"implicit tls with cram-md5 auth", smtptest.Config{Username: "user", Password: "pass", ImplicitTLS: true}, SMTPTLSImplicit, SMTPAuthCRAMMD5},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := smtptest.NewServer(tc.server)
+			if err != nil {
+				t.Fatalf("NewServer: %v", err)
+			}
+			defer server.Close()
+
+			sender, err := NewSMTP(SMTPConfig{
+				Host:            server.Host(),
+				Port:            server.Port(),
+				Username:        "user",
+				Password:        "pass",
+				TLS:             tc.tls,
+				Auth:            tc.auth,
+				TLSConfig:       server.ClientTLSConfig(),
+				From:            "noreply@mimoto.test",
+				ListUnsubscribe: "mailto:unsubscribe@mimoto.test",
+			})
+			if err != nil {
+				t.Fatalf("NewSMTP: %v", err)
+			}
+			defer sender.Close()
+
+			for i := 0; i < 2; i++ {
+				err = sender.Send(ctx, Message{
+					Name:    "Tëst",
+					Email:   "test@test.com",
+					Subject: "Réinitialiser",
+					Text:    "text body",
+					HTML:    "<p>html body</p>",
+					Headers: map[string]string{"X-Idempotency-Key": "12345"},
+				})
+				if err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+			}
+
+			if server.Connections() != 1 {
+				t.Fatalf("connection wasn't reused: wanted %v connections but got %v", 1, server.Connections())
+			}
+
+			messages := server.Messages()
+			if len(messages) != 2 {
+				t.Fatalf("wanted %v messages but got %v", 2, len(messages))
+			}
+			msg := messages[0]
+			if msg.From != "noreply@mimoto.test" || len(msg.To) != 1 || msg.To[0] != "test@test.com" {
+				t.Fatalf("unexpected envelope: %v %v", msg.From, msg.To)
+			}
+			to, err := msg.Header.AddressList("To")
+			if err != nil || to[0].Name != "Tëst" {
+				t.Fatalf("unexpected To header: %v", msg.Header.Get("To"))
+			}
+			if msg.Header.Get("Message-ID") == "" || messages[1].Header.Get("Message-ID") == msg.Header.Get("Message-ID") {
+				t.Fatalf("message ids aren't unique: %v", msg.Header.Get("Message-ID"))
+			}
+			if msg.Header.Get("List-Unsubscribe") != "<mailto:unsubscribe@mimoto.test>" {
+				t.Fatalf("unexpected List-Unsubscribe header: %v", msg.Header.Get("List-Unsubscribe"))
+			}
+			if msg.Header.Get("X-Idempotency-Key") != "12345" {
+				t.Fatalf("unexpected X-Idempotency-Key header: %v", msg.Header.Get("X-Idempotency-Key"))
+			}
+			if !strings.Contains(msg.Header.Get("Content-Type"), "multipart/alternative") {
+				t.Fatalf("unexpected Content-Type header: %v", msg.Header.Get("Content-Type"))
+			}
+			if msg.Text != "text body" || msg.HTML != "<p>html body</p>" {
+				t.Fatalf("unexpected body: %q %q", msg.Text, msg.HTML)
+			}
+		})
+	}
+}
+
+func TestSMTPSenderReconnect(t *testing.T) {
+	ctx := context.Background()
+	server, err := smtptest.NewServer(smtptest.Config{})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	sender, err := NewSMTP(SMTPConfig{
+		Host: server.Host(),
+		Port: server.Port(),
+		TLS:  SMTPTLSNone,
+		From: "noreply@mimoto.test",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+
+	err = sender.Send(ctx, Message{Email: "test@test.com", Subject: "first"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	server.DropConnections()
+
+	err = sender.Send(ctx, Message{Email: "test@test.com", Subject: "second"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if server.Connections() != 2 {
+		t.Fatalf("wanted %v connections but got %v", 2, server.Connections())
+	}
+
+	server.Close()
+	err = sender.Send(ctx, Message{Email: "test@test.com", Subject: "third"})
+	if err == nil {
+		t.Fatalf("Send: wanted error after server closed")
+	}
+}
+
+func TestSMTPSenderAuthFailure(t *testing.T) {
+	ctx := context.Background()
+	server, err := smtptest.NewServer(smtptest.Config{Username: "user", Password: "pass"})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	sender, err := NewSMTP(SMTPConfig{
+		Host:     server.Host(),
+		Port:     server.Port(),
+		Username: "user",
+		Password: "wrong",
+		TLS:      SMTPTLSNone,
+		Auth:     SMTPAuthPlain,
+		From:     "noreply@mimoto.test",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+
+	err = sender.Send(ctx, Message{Email: "test@test.com"})
+	if err == nil {
+		t.Fatalf("Send: wanted auth error")
+	}
+	if len(server.Messages()) != 0 {
+		t.Fatalf("message was delivered without auth")
+	}
+}
+
+func TestSMTPSenderPing(t *testing.T) {
+	ctx := context.Background()
+	server, err := smtptest.NewServer(smtptest.Config{})
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer server.Close()
+
+	sender, err := NewSMTP(SMTPConfig{
+		Host: server.Host(),
+		Port: server.Port(),
+		TLS:  SMTPTLSNone,
+		From: "noreply@mimoto.test",
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+
+	// pinging keeps the connection for sending
+	if err := sender.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := sender.Send(ctx, Message{Email: "test@test.com"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if server.Connections() != 1 {
+		t.Fatalf("wanted %v connections but got %v", 1, server.Connections())
+	}
+
+	server.Close()
+	if err := sender.Ping(context.Background()); err == nil {
+		t.Fatalf("Ping: wanted error after server closed")
+	}
+}
+
+func TestSMTPSenderCancel(t *testing.T) {
+	// a server that accepts connections but never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	sender, err := NewSMTP(SMTPConfig{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		TLS:     SMTPTLSNone,
+		From:    "noreply@mimoto.test",
+		Timeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = sender.Send(ctx, Message{Email: "test@test.com"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send error doesn't match: wanted %v but got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Send took %v after its context was done", elapsed)
+	}
+}
@@ -0,0 +1,421 @@
+// Package smtptest provides an in-process SMTP server for testing email delivery.
+package smtptest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Username and Password require clients to authenticate with PLAIN, LOGIN or CRAM-MD5.
+	Username string
+	Password string
+	// STARTTLS advertises the STARTTLS extension.
+	STARTTLS bool
+	// ImplicitTLS wraps every connection in TLS.
+	ImplicitTLS bool
+}
+
+// Message is a message delivered to the server.
+type Message struct {
+	From   string
+	To     []string
+	Data   []byte
+	Header mail.Header
+	// Text and HTML are the decoded parts of a multipart/alternative message,
+	// or the whole body in Text for other messages.
+	Text string
+	HTML string
+}
+
+type Server struct {
+	config      Config
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	certificate *x509.Certificate
+
+	mu          sync.Mutex
+	messages    []Message
+	connections int
+	open        map[net.Conn]struct{}
+	wg          sync.WaitGroup
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer(config Config) (*Server, error) {
+	tlsConfig, certificate, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	if config.ImplicitTLS {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	s := &Server{
+		config:      config,
+		listener:    listener,
+		tlsConfig:   tlsConfig,
+		certificate: certificate,
+		open:        make(map[net.Conn]struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.listener.Addr().String())
+	return host
+}
+
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// ClientTLSConfig trusts the server's self-signed certificate.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.certificate)
+	return &tls.Config{
+		RootCAs:    pool,
+		ServerName: s.Host(),
+	}
+}
+
+// Messages returns the messages delivered so far.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Connections returns the number of connections accepted so far.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// DropConnections closes open connections without a reply, like a server timing out idle clients.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.open {
+		conn.Close()
+	}
+}
+
+// Close stops accepting connections and closes open connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.connections++
+		s.open[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.open, conn)
+				s.mu.Unlock()
+				conn.Close()
+			}()
+			s.handle(conn)
+		}()
+	}
+}
+
+type session struct {
+	conn          net.Conn
+	text          *textproto.Conn
+	tls           bool
+	authenticated bool
+	from          string
+	to            []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+	sess := &session{
+		conn: conn,
+		text: textproto.NewConn(conn),
+		tls:  s.config.ImplicitTLS,
+	}
+	sess.reply(220, "smtptest ESMTP")
+
+	for {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i != -1 {
+			verb, arg = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			extensions := []string{"smtptest", "8BITMIME"}
+			if s.config.STARTTLS && !sess.tls {
+				extensions = append(extensions, "STARTTLS")
+			}
+			if s.config.Username != "" {
+				extensions = append(extensions, "AUTH PLAIN LOGIN CRAM-MD5")
+			}
+			sess.replyLines(250, extensions)
+		case "STARTTLS":
+			if !s.config.STARTTLS || sess.tls {
+				sess.reply(502, "5.5.1 STARTTLS not available")
+				continue
+			}
+			sess.reply(220, "2.0.0 Ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			sess = &session{conn: tlsConn, text: textproto.NewConn(tlsConn), tls: true}
+		case "AUTH":
+			if s.authenticate(sess, arg) {
+				sess.authenticated = true
+				sess.reply(235, "2.7.0 Authentication successful")
+			} else {
+				sess.reply(535, "5.7.8 Authentication failed")
+			}
+		case "MAIL":
+			if s.config.Username != "" && !sess.authenticated {
+				sess.reply(530, "5.7.0 Authentication required")
+				continue
+			}
+			sess.from = address(arg)
+			sess.to = nil
+			sess.reply(250, "2.1.0 OK")
+		case "RCPT":
+			if sess.from == "" {
+				sess.reply(503, "5.5.1 MAIL first")
+				continue
+			}
+			sess.to = append(sess.to, address(arg))
+			sess.reply(250, "2.1.5 OK")
+		case "DATA":
+			if len(sess.to) == 0 {
+				sess.reply(503, "5.5.1 RCPT first")
+				continue
+			}
+			sess.reply(354, "Start mail input; end with <CRLF>.<CRLF>")
+			data, err := io.ReadAll(sess.text.DotReader())
+			if err != nil {
+				return
+			}
+			s.deliver(sess.from, sess.to, data)
+			sess.from, sess.to = "", nil
+			sess.reply(250, "2.0.0 OK")
+		case "RSET":
+			sess.from, sess.to = "", nil
+			sess.reply(250, "2.0.0 OK")
+		case "NOOP":
+			sess.reply(250, "2.0.0 OK")
+		case "QUIT":
+			sess.reply(221, "2.0.0 Bye")
+			return
+		default:
+			sess.reply(502, "5.5.2 Command not recognized")
+		}
+	}
+}
+
+func (sess *session) reply(code int, msg string) {
+	sess.text.PrintfLine("%d %s", code, msg)
+}
+
+func (sess *session) replyLines(code int, lines []string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		sess.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+// challenge sends a 334 challenge and returns the decoded response.
+func (sess *session) challenge(challenge string) (string, bool) {
+	sess.reply(334, base64.StdEncoding.EncodeToString([]byte(challenge)))
+	line, err := sess.text.ReadLine()
+	if err != nil {
+		return "", false
+	}
+	return decode(line)
+}
+
+func (s *Server) authenticate(sess *session, arg string) bool {
+	mechanism, initial := arg, ""
+	if i := strings.Index(arg, " "); i != -1 {
+		mechanism, initial = arg[:i], arg[i+1:]
+	}
+
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		response, ok := decode(initial)
+		if initial == "" {
+			response, ok = sess.challenge("")
+		}
+		parts := strings.Split(response, "\x00")
+		return ok && len(parts) == 3 && parts[1] == s.config.Username && parts[2] == s.config.Password
+	case "LOGIN":
+		username, ok := sess.challenge("Username:")
+		if !ok {
+			return false
+		}
+		password, ok := sess.challenge("Password:")
+		return ok && username == s.config.Username && password == s.config.Password
+	case "CRAM-MD5":
+		challenge := fmt.Sprintf("<%d.%d@smtptest>", time.Now().UnixNano(), s.Port())
+		response, ok := sess.challenge(challenge)
+		parts := strings.Split(response, " ")
+		if !ok || len(parts) != 2 || parts[0] != s.config.Username {
+			return false
+		}
+		mac := hmac.New(md5.New, []byte(s.config.Password))
+		mac.Write([]byte(challenge))
+		return hmac.Equal([]byte(parts[1]), []byte(hex.EncodeToString(mac.Sum(nil))))
+	}
+	return false
+}
+
+func (s *Server) deliver(from string, to []string, data []byte) {
+	msg := Message{
+		From: from,
+		To:   to,
+		Data: data,
+	}
+	if parsed, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		msg.Header = parsed.Header
+		msg.Text, msg.HTML = parseBody(parsed)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+}
+
+func parseBody(msg *mail.Message) (string, string) {
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		body, _ := io.ReadAll(msg.Body)
+		return string(body), ""
+	}
+
+	var text, html string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		var r io.Reader = part
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			r = quotedprintable.NewReader(part)
+		}
+		content, _ := io.ReadAll(bufio.NewReader(r))
+		switch {
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain"):
+			text = string(content)
+		case strings.HasPrefix(part.Header.Get("Content-Type"), "text/html"):
+			html = string(content)
+		}
+	}
+	return text, html
+}
+
+// address returns the address in a FROM:<address> or TO:<address> argument.
+func address(arg string) string {
+	start := strings.Index(arg, "<")
+	end := strings.Index(arg, ">")
+	if start == -1 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+func decode(s string) (string, bool) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+func newTLSConfig() (*tls.Config, *x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}},
+	}, certificate, nil
+}
@@ -0,0 +1,289 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// DefaultLocale is used when a template doesn't exist for the recipient's locale.
+const DefaultLocale = "en"
+
+// Data is passed to every template.
+// Locale and Subject are set by Render.
+type Data struct {
+	Name    string
+	Email   string
+	Link    string
+	Locale  string
+	Subject string
+	// Time, IP and UserAgent describe the activity in security notifications.
+	Time      string
+	IP        string
+	UserAgent string
+}
+
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type localeTemplates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// Templates renders emails from a template directory with the layout:
+//
+//	layouts/base.txt, layouts/base.html  wrap every email, and must call the "content" and "footer" templates
+//	partials/*.txt, partials/*.html                    shared templates available to every locale
+//	<locale>/partials/*.txt, <locale>/partials/*.html  templates shared by every email in a locale, such as "footer"
+//	<locale>/<name>.txt                                defines the "subject" and "content" of the text body
+//	<locale>/<name>.html                               defines the "content" of the html body
+type Templates struct {
+	locales map[string]localeTemplates
+}
+
+// NewTemplates loads the embedded templates.
+// Files in override replace the embedded file with the same path, and can add locales or templates.
+func NewTemplates(override fs.FS) (*Templates, error) {
+	var fsys fs.FS
+	fsys, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		fsys = layeredFS{upper: override, lower: fsys}
+	}
+
+	partials, err := readFiles(fsys, "partials")
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	t := &Templates{
+		locales: make(map[string]localeTemplates),
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == "layouts" || entry.Name() == "partials" {
+			continue
+		}
+		locale := entry.Name()
+		lt, err := loadLocale(fsys, locale, partials)
+		if err != nil {
+			return nil, fmt.Errorf("load %s templates: %w", locale, err)
+		}
+		t.locales[locale] = lt
+	}
+	if _, ok := t.locales[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("missing templates for default locale %s", DefaultLocale)
+	}
+	return t, nil
+}
+
+func loadLocale(fsys fs.FS, locale string, partials []string) (localeTemplates, error) {
+	shared, err := readFiles(fsys, path.Join(locale, "partials"))
+	if err != nil {
+		return localeTemplates{}, err
+	}
+	files, err := readFiles(fsys, locale)
+	if err != nil {
+		return localeTemplates{}, err
+	}
+
+	lt := localeTemplates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+	for _, file := range files {
+		if path.Ext(file) != ".txt" {
+			continue
+		}
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		text, err := parseText(fsys, withExt(append(append([]string{"layouts/base.txt"}, partials...), shared...), ".txt"), file)
+		if err != nil {
+			return localeTemplates{}, err
+		}
+		if text.Lookup("subject") == nil {
+			return localeTemplates{}, fmt.Errorf("%s doesn't define a subject", file)
+		}
+		html, err := parseHTML(fsys, withExt(append(append([]string{"layouts/base.html"}, partials...), shared...), ".html"), path.Join(locale, name+".html"))
+		if err != nil {
+			return localeTemplates{}, err
+		}
+		lt.text[name] = text
+		lt.html[name] = html
+	}
+	return lt, nil
+}
+
+func parseText(fsys fs.FS, files []string, file string) (*texttemplate.Template, error) {
+	var t *texttemplate.Template
+	for _, f := range append(files, file) {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			t = texttemplate.New(f)
+		} else {
+			t = t.New(f)
+		}
+		if _, err := t.Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return t.Lookup(files[0]), nil
+}
+
+func parseHTML(fsys fs.FS, files []string, file string) (*htmltemplate.Template, error) {
+	var t *htmltemplate.Template
+	for _, f := range append(files, file) {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			t = htmltemplate.New(f)
+		} else {
+			t = t.New(f)
+		}
+		if _, err := t.Parse(string(b)); err != nil {
+			return nil, err
+		}
+	}
+	return t.Lookup(files[0]), nil
+}
+
+// readFiles returns the paths of the files in dir.
+func readFiles(fsys fs.FS, dir string) ([]string, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, path.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+func withExt(files []string, ext string) []string {
+	filtered := make([]string, 0, len(files))
+	for _, file := range files {
+		if path.Ext(file) == ext {
+			filtered = append(filtered, file)
+		}
+	}
+	return filtered
+}
+
+// Render renders the named email for the first locale in the fallback chain that has it,
+// e.g. pt-BR falls back to pt and then DefaultLocale.
+func (t *Templates) Render(name, locale string, data Data) (Rendered, error) {
+	for _, l := range fallbackLocales(locale) {
+		lt, ok := t.locales[l]
+		if !ok {
+			continue
+		}
+		text, ok := lt.text[name]
+		if !ok {
+			continue
+		}
+
+		data.Locale = l
+		subject := bytes.Buffer{}
+		if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return Rendered{}, err
+		}
+		data.Subject = strings.TrimSpace(subject.String())
+
+		textBody := bytes.Buffer{}
+		if err := text.Execute(&textBody, data); err != nil {
+			return Rendered{}, err
+		}
+		htmlBody := bytes.Buffer{}
+		if err := lt.html[name].Execute(&htmlBody, data); err != nil {
+			return Rendered{}, err
+		}
+		return Rendered{
+			Subject: data.Subject,
+			Text:    strings.TrimSpace(textBody.String()) + "\n",
+			HTML:    htmlBody.String(),
+		}, nil
+	}
+	return Rendered{}, fmt.Errorf("template %s not found", name)
+}
+
+func fallbackLocales(locale string) []string {
+	locales := make([]string, 0, 3)
+	if tag, err := language.Parse(locale); err == nil {
+		locales = append(locales, tag.String())
+		if base, confidence := tag.Base(); confidence != language.No && base.String() != tag.String() {
+			locales = append(locales, base.String())
+		}
+	}
+	return append(locales, DefaultLocale)
+}
+
+// layeredFS reads files from upper, falling back to lower.
+type layeredFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	f, err := l.upper.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l.lower.Open(name)
+	}
+	return f, err
+}
+
+// ReadDir merges the entries of both layers, preferring upper.
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, upperErr := fs.ReadDir(l.upper, name)
+	lower, lowerErr := fs.ReadDir(l.lower, name)
+	if upperErr != nil && lowerErr != nil {
+		return nil, lowerErr
+	}
+
+	merged := make(map[string]fs.DirEntry)
+	for _, entry := range lower {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range upper {
+		merged[entry.Name()] = entry
+	}
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
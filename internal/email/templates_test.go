@@ -0,0 +1,127 @@
+package email
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestTemplatesGolden(t *testing.T) {
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+
+	data := Data{
+		Name:  "Test <User>",
+		Email: "test@test.com",
+		Link:  "https://mimoto.test/confirm?code=12345&email=test%40test.com",
+
+		Time:      "2021-09-01 12:00 UTC",
+		IP:        "203.0.113.1",
+		UserAgent: "Mozilla/5.0 <script>",
+	}
+	for locale, lt := range templates.locales {
+		for name := range lt.text {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				rendered, err := templates.Render(name, locale, data)
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+
+				golden := filepath.Join("testdata", "golden", locale, name)
+				assertGolden(t, golden+".subject", rendered.Subject)
+				assertGolden(t, golden+".txt", rendered.Text)
+				assertGolden(t, golden+".html", rendered.HTML)
+			})
+		}
+	}
+}
+
+func assertGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if got != string(want) {
+		t.Fatalf("%s doesn't match golden file:\n%s", path, got)
+	}
+}
+
+func TestTemplatesFallback(t *testing.T) {
+	templates, err := NewTemplates(nil)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+
+	for locale, subject := range map[string]string{
+		"":        "Reset Password",
+		"invalid": "Reset Password",
+		"fr":      "Reset Password",
+		"es":      "Restablecer contraseña",
+		"es-MX":   "Restablecer contraseña",
+	} {
+		rendered, err := templates.Render("reset", locale, Data{})
+		if err != nil {
+			t.Fatalf("Render: %v", err)
+		}
+		if rendered.Subject != subject {
+			t.Fatalf("subject for %q doesn't match: wanted %v but got %v", locale, subject, rendered.Subject)
+		}
+	}
+
+	_, err = templates.Render("none", "en", Data{})
+	if err == nil {
+		t.Fatalf("Render: wanted error for missing template")
+	}
+}
+
+func TestTemplatesOverride(t *testing.T) {
+	override := fstest.MapFS{
+		"en/reset.txt":            {Data: []byte(`{{define "subject"}}Custom Reset{{end}}{{define "content"}}Reset at {{.Link}}{{end}}`)},
+		"fr/partials/common.txt":  {Data: []byte(`{{define "footer"}}mimoto{{end}}`)},
+		"fr/partials/common.html": {Data: []byte(`{{define "footer"}}mimoto{{end}}`)},
+		"fr/reset.txt":            {Data: []byte(`{{define "subject"}}Réinitialiser le mot de passe{{end}}{{define "content"}}{{.Link}}{{end}}`)},
+		"fr/reset.html":           {Data: []byte(`{{define "content"}}<a href="{{.Link}}">{{.Link}}</a>{{end}}`)},
+	}
+	templates, err := NewTemplates(override)
+	if err != nil {
+		t.Fatalf("NewTemplates: %v", err)
+	}
+
+	rendered, err := templates.Render("reset", "en", Data{Link: "https://mimoto.test/reset"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if rendered.Subject != "Custom Reset" || !strings.Contains(rendered.Text, "Reset at https://mimoto.test/reset") {
+		t.Fatalf("override wasn't used: %+v", rendered)
+	}
+	// the html template isn't overridden
+	if !strings.Contains(rendered.HTML, "Reset password") {
+		t.Fatalf("embedded html template wasn't used: %v", rendered.HTML)
+	}
+
+	rendered, err = templates.Render("reset", "fr-CA", Data{})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if rendered.Subject != "Réinitialiser le mot de passe" {
+		t.Fatalf("subject doesn't match: wanted %v but got %v", "Réinitialiser le mot de passe", rendered.Subject)
+	}
+}
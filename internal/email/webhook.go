@@ -0,0 +1,104 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookSender posts messages as JSON to an HTTP endpoint that delivers them.
+type WebhookSender struct {
+	url    string
+	token  string
+	from   string
+	client *http.Client
+}
+
+type webhookRecipient struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type webhookPayload struct {
+	From    string            `json:"from"`
+	To      webhookRecipient  `json:"to"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	HTML    string            `json:"html"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// NewWebhook sends requests with token as a bearer token, if it isn't empty.
+func NewWebhook(url, token, from string) (WebhookSender, error) {
+	if url == "" {
+		return WebhookSender{}, fmt.Errorf("missing email webhook url")
+	}
+	return WebhookSender{
+		url:    url,
+		token:  token,
+		from:   from,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (ws WebhookSender) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(webhookPayload{
+		From: ws.from,
+		To: webhookRecipient{
+			Name:  msg.Name,
+			Email: msg.Email,
+		},
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Headers: msg.Headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ws.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ws.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ws.token)
+	}
+
+	res, err := ws.client.Do(req)
+	if err != nil {
+		// wrapping err too keeps cancellations detectable with errors.Is
+		return fmt.Errorf("%w: %w", ErrTemporary, err)
+	}
+	defer res.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return httpError("webhook", res.StatusCode, string(b))
+}
+
+// Ping checks the webhook's host accepts connections, without posting a message.
+func (ws WebhookSender) Ping(ctx context.Context) error {
+	u, err := url.Parse(ws.url)
+	if err != nil {
+		return err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTemporary, err)
+	}
+	return conn.Close()
+}
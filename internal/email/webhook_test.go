@@ -0,0 +1,100 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSender(t *testing.T) {
+	ctx := context.Background()
+	payloads := make([]webhookPayload, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		payload := webhookPayload{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, payload)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	ws, err := NewWebhook(server.URL, "token", "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+
+	err = ws.Send(ctx, Message{Name: "test", Email: "test@test.com", Subject: "Reset Password", Text: "text", HTML: "html"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("wanted %v payloads but got %v", 1, len(payloads))
+	}
+	if payloads[0].From != "noreply@mimoto.test" || payloads[0].To.Email != "test@test.com" || payloads[0].Subject != "Reset Password" {
+		t.Fatalf("unexpected payload: %+v", payloads[0])
+	}
+
+	ws, _ = NewWebhook(server.URL, "wrong", "noreply@mimoto.test")
+	err = ws.Send(ctx, Message{Email: "test@test.com"})
+	if !errors.Is(err, ErrPermanent) {
+		t.Fatalf("Send error doesn't match: wanted %v but got %v", ErrPermanent, err)
+	}
+}
+
+func TestWebhookSenderPing(t *testing.T) {
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer server.Close()
+
+	ws, err := NewWebhook(server.URL, "token", "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+	if err := ws.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if posts != 0 {
+		t.Fatalf("Ping posted to the webhook")
+	}
+
+	server.Close()
+	if err := ws.Ping(context.Background()); !errors.Is(err, ErrTemporary) {
+		t.Fatalf("Ping error doesn't match: wanted %v but got %v", ErrTemporary, err)
+	}
+}
+
+func TestWebhookSenderCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ws, err := NewWebhook(server.URL, "token", "noreply@mimoto.test")
+	if err != nil {
+		t.Fatalf("NewWebhook: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	err = ws.Send(ctx, Message{Email: "test@test.com"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/render"
+	"github.com/golang-jwt/jwt"
+)
+
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+func (pr *PasswordRequest) Bind(r *http.Request) error {
+	if pr.Password == "" {
+		return errors.New("missing password")
+	}
+	return nil
+}
+
+type DeleteAccountResponse struct {
+	DeletionAt time.Time `json:"deletionAt"`
+}
+
+func (dar *DeleteAccountResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func DeleteAccountHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+		data := PasswordRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		deletionAt, err := userService.ScheduleDeletion(r.Context(), claims.Subject, data.Password)
+		if errors.Is(err, user.ErrInvalidCredentials) {
+			render.Render(w, r, ErrForbidden(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		render.Status(r, http.StatusAccepted)
+		render.Render(w, r, &DeleteAccountResponse{
+			DeletionAt: deletionAt,
+		})
+	}
+}
+
+// CancelDeletionHandler isn't behind JWTAuthorizer because accounts pending deletion can't use their tokens.
+// limiter caps the attempts on each email, on top of the per IP limit of the route.
+func CancelDeletionHandler(userService user.UserService, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := LoginRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+		if !limiter.Allow(strings.ToLower(strings.TrimSpace(data.Email))) {
+			limiter.reject(w, r)
+			return
+		}
+
+		err := userService.CancelDeletion(r.Context(), data.Email, data.Password)
+		if errors.Is(err, user.ErrInvalidCredentials) {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func ExportAccountHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+
+		export, err := userService.ExportUser(r.Context(), claims.Subject)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="mimoto-export.json"`)
+		render.JSON(w, r, export)
+	}
+}
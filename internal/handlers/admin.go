@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+type UserResponse struct {
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	Role            string     `json:"role,omitempty"`
+	Confirmed       bool       `json:"confirmed"`
+	Status          string     `json:"status"`
+	StatusReason    string     `json:"statusReason,omitempty"`
+	StatusChangedAt time.Time  `json:"statusChangedAt"`
+	SuspendedUntil  *time.Time `json:"suspendedUntil,omitempty"`
+}
+
+func (ur *UserResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func NewUserResponse(u repository.User) *UserResponse {
+	return &UserResponse{
+		Email:           u.Email,
+		Name:            u.Name,
+		Role:            u.Role,
+		Confirmed:       u.Confirmed,
+		Status:          u.EffectiveStatus(time.Now()),
+		StatusReason:    u.StatusReason,
+		StatusChangedAt: u.StatusChangedAt,
+		SuspendedUntil:  u.SuspendedUntil,
+	}
+}
+
+type UserListResponse struct {
+	Users  []*UserResponse `json:"users"`
+	Total  int64           `json:"total"`
+	Offset int             `json:"offset"`
+	Limit  int             `json:"limit"`
+}
+
+func (ulr *UserListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// AdminAuthorizer must run after JWTAuthorizer and only lets through users with the admin role.
+func AdminAuthorizer(userService user.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(jwt.StandardClaims)
+
+			admin, err := userService.IsAdmin(r.Context(), claims.Subject)
+			if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+				render.Render(w, r, ErrInternalServer(err))
+				return
+			}
+			if !admin {
+				render.Render(w, r, ErrForbidden(errors.New("admin role required")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parsePage reads the offset and limit params, limit defaults to defaultLimit.
+func parsePage(q url.Values, defaultLimit int) (int, int, error) {
+	offset, limit := 0, defaultLimit
+	if v := q.Get("offset"); v != "" {
+		var err error
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset param: %s", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, fmt.Errorf("invalid limit param: %s", v)
+		}
+	}
+	return offset, limit, nil
+}
+
+func parseListOptions(r *http.Request) (repository.ListOptions, error) {
+	q := r.URL.Query()
+	opts := repository.ListOptions{
+		Email: q.Get("email"),
+		Name:  q.Get("name"),
+	}
+
+	var err error
+	opts.Offset, opts.Limit, err = parsePage(q, defaultPageLimit)
+	if err != nil {
+		return opts, err
+	}
+	if v := q.Get("confirmed"); v != "" {
+		confirmed, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid confirmed param: %s", v)
+		}
+		opts.Confirmed = &confirmed
+	}
+	switch v := q.Get("status"); v {
+	case "", repository.StatusActive, repository.StatusSuspended, repository.StatusDisabled, repository.StatusPendingDeletion:
+		opts.Status = v
+	default:
+		return opts, fmt.Errorf("invalid status param: %s", v)
+	}
+	return opts, nil
+}
+
+func renderUserError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, repository.ErrUserNotFound) {
+		render.Render(w, r, ErrNotFound(err))
+		return
+	}
+	render.Render(w, r, ErrBadRequest(err))
+}
+
+func ListUsersHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseListOptions(r)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		users, total, err := userService.ListUsers(r.Context(), opts)
+		if err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+
+		response := &UserListResponse{
+			Users:  make([]*UserResponse, 0, len(users)),
+			Total:  total,
+			Offset: opts.Offset,
+			Limit:  opts.Limit,
+		}
+		for _, u := range users {
+			response.Users = append(response.Users, NewUserResponse(u))
+		}
+		render.Render(w, r, response)
+	}
+}
+
+func GetUserHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := userService.GetUser(r.Context(), chi.URLParam(r, "email"))
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, NewUserResponse(u))
+	}
+}
+
+// recordAdminAction writes an audit event of the admin acting on email, reason is why they did it.
+func recordAdminAction(r *http.Request, auditSink audit.AuditSink, eventType, email, reason string, err error) {
+	event := audit.NewEvent(r.Context(), eventType, email, err)
+	if err == nil {
+		event.Reason = reason
+	}
+	// the event is written even if the request was cancelled
+	auditSink.Write(context.WithoutCancel(r.Context()), event)
+}
+
+// AdminActionHandler runs a userService action against the user in the email url param
+// and records it as eventType.
+func AdminActionHandler(auditSink audit.AuditSink, eventType string, action func(ctx context.Context, email string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		email := chi.URLParam(r, "email")
+		err := action(r.Context(), email)
+		recordAdminAction(r, auditSink, eventType, email, "", err)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type StatusRequest struct {
+	Reason string     `json:"reason"`
+	Until  *time.Time `json:"until"`
+}
+
+func (sr *StatusRequest) Bind(r *http.Request) error {
+	if sr.Reason == "" {
+		return errors.New("missing reason")
+	}
+	return nil
+}
+
+func SuspendUserHandler(userService user.UserService, auditSink audit.AuditSink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := StatusRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		email := chi.URLParam(r, "email")
+		err := userService.SuspendUser(r.Context(), email, data.Reason, data.Until)
+		recordAdminAction(r, auditSink, audit.TypeAdminSuspend, email, data.Reason, err)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func DisableUserHandler(userService user.UserService, auditSink audit.AuditSink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := StatusRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		email := chi.URLParam(r, "email")
+		err := userService.DisableUser(r.Context(), email, data.Reason)
+		recordAdminAction(r, auditSink, audit.TypeAdminDisable, email, data.Reason, err)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+type EmailEventListResponse struct {
+	Events []repository.EmailEvent `json:"events"`
+}
+
+func (elr *EmailEventListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func ListEmailEventsHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		events, err := userService.ListEmailEvents(r.Context(), chi.URLParam(r, "email"))
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, &EmailEventListResponse{Events: events})
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+	"github.com/golang-jwt/jwt"
+)
+
+const defaultActivityLimit = 20
+
+// AuditRequest attributes the audit events of requests to their client,
+// it must run after the middleware that sets the request id.
+func AuditRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := audit.WithRequest(r.Context(), audit.Request{
+			IP:        clientIP(r),
+			UserAgent: r.UserAgent(),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+type AuditEventListResponse struct {
+	Events []audit.Event `json:"events"`
+	Total  int64         `json:"total"`
+	Offset int           `json:"offset"`
+	Limit  int           `json:"limit"`
+}
+
+func (alr *AuditEventListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func parseAuditListOptions(r *http.Request) (audit.ListOptions, error) {
+	q := r.URL.Query()
+	opts := audit.ListOptions{
+		Type:    q.Get("type"),
+		Actor:   q.Get("actor"),
+		Subject: q.Get("subject"),
+	}
+
+	var err error
+	opts.Offset, opts.Limit, err = parsePage(q, defaultPageLimit)
+	if err != nil {
+		return opts, err
+	}
+	switch v := q.Get("outcome"); v {
+	case "", audit.OutcomeSuccess, audit.OutcomeFailure:
+		opts.Outcome = v
+	default:
+		return opts, fmt.Errorf("invalid outcome param: %s", v)
+	}
+	if v := q.Get("since"); v != "" {
+		if opts.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return opts, fmt.Errorf("invalid since param: %s", v)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if opts.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return opts, fmt.Errorf("invalid until param: %s", v)
+		}
+	}
+	return opts, nil
+}
+
+func renderAuditEvents(w http.ResponseWriter, r *http.Request, auditLog audit.AuditLog, opts audit.ListOptions) {
+	events, total, err := auditLog.List(r.Context(), opts)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		return
+	}
+
+	render.Render(w, r, &AuditEventListResponse{
+		Events: events,
+		Total:  total,
+		Offset: opts.Offset,
+		Limit:  opts.Limit,
+	})
+}
+
+// ListAuditEventsHandler lets admins page through the audit log, newest first.
+func ListAuditEventsHandler(auditLog audit.AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := parseAuditListOptions(r)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		renderAuditEvents(w, r, auditLog, opts)
+	}
+}
+
+// ActivityHandler returns the recent audit events of the user's own account.
+func ActivityHandler(auditLog audit.AuditLog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+		offset, limit, err := parsePage(r.URL.Query(), defaultActivityLimit)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		renderAuditEvents(w, r, auditLog, audit.ListOptions{
+			Subject: claims.Subject,
+			Offset:  offset,
+			Limit:   limit,
+		})
+	}
+}
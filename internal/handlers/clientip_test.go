@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	middleware, err := ClientIP([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("ClientIP: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer with headers", "203.0.113.7:1234", map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.4.5.6, 192.168.1.1"}, "198.51.100.1"},
+		{"spoofed hop", "10.1.2.3:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"real ip", "192.168.1.1:1234", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without headers", "10.1.2.3:1234", nil, "10.1.2.3"},
+	}
+	for _, test := range tests {
+		var got string
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = clientIP(r)
+		}))
+		r := httptest.NewRequest(http.MethodPost, "/confirm/resend", nil)
+		r.RemoteAddr = test.remote
+		for key, value := range test.headers {
+			r.Header.Set(key, value)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != test.want {
+			t.Fatalf("%s: client ip doesn't match: wanted %v but got %v", test.name, test.want, got)
+		}
+	}
+
+	if _, err := ClientIP([]string{"proxy"}); err == nil {
+		t.Fatalf("ClientIP: wanted error for an invalid trusted proxy")
+	}
+}
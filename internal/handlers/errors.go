@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/go-chi/render"
@@ -16,6 +18,11 @@ type ErrResponse struct {
 }
 
 func (e *ErrResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	// running out of time isn't the client's fault, whichever error the handler picked
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		e.HTTPStatusCode = http.StatusGatewayTimeout
+		e.StatusText = "Gateway Timeout"
+	}
 	render.Status(r, e.HTTPStatusCode)
 	return nil
 }
@@ -55,3 +62,21 @@ func ErrNotFound(err error) render.Renderer {
 		ErrorText:      err.Error(),
 	}
 }
+
+func ErrForbidden(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusForbidden,
+		StatusText:     "Forbidden",
+		ErrorText:      err.Error(),
+	}
+}
+
+func ErrTooManyRequests(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: http.StatusTooManyRequests,
+		StatusText:     "Too Many Requests",
+		ErrorText:      err.Error(),
+	}
+}
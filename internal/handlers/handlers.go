@@ -4,10 +4,11 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/broswen/mimoto/internal/audit"
 	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/httplog"
 	"github.com/go-chi/render"
 	"github.com/golang-jwt/jwt"
 )
@@ -39,7 +40,7 @@ func SignupHandler(userService user.UserService) http.HandlerFunc {
 			return
 		}
 
-		err := userService.Signup(data.Email, data.Name, data.Password)
+		err := userService.Signup(r.Context(), data.Email, data.Name, data.Password)
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -62,7 +63,7 @@ func ConfirmHandler(userService user.UserService) http.HandlerFunc {
 			return
 		}
 
-		err := userService.Confirm(email, code)
+		err := userService.Confirm(r.Context(), email, code)
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -72,9 +73,35 @@ func ConfirmHandler(userService user.UserService) http.HandlerFunc {
 	}
 }
 
+// ResendConfirmationHandler responds the same way whether or not the email has an account.
+// limiter caps the resends to each email, on top of the per IP limit of the route.
+func ResendConfirmationHandler(userService user.UserService, limiter *RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := EmailRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+		if !limiter.Allow(strings.ToLower(strings.TrimSpace(data.Email))) {
+			limiter.reject(w, r)
+			return
+		}
+
+		err := userService.ResendConfirmation(r.Context(), data.Email)
+		if err != nil {
+			oplog := httplog.LogEntry(r.Context())
+			oplog.Error().Err(err).Msg("resend confirmation")
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// Audience selects the token policy, the default audience if it's empty.
+	Audience string `json:"audience"`
 }
 
 func (sr *LoginRequest) Bind(r *http.Request) error {
@@ -98,7 +125,13 @@ func LoginHandler(userService user.UserService) http.HandlerFunc {
 			return
 		}
 
-		token, refreshToken, err := userService.Login(data.Email, data.Password)
+		client := clientFromRequest(r)
+		client.Audience = data.Audience
+		token, refreshToken, err := userService.Login(r.Context(), data.Email, data.Password, client)
+		if errors.Is(err, user.ErrInvalidCredentials) {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -112,27 +145,42 @@ func LoginHandler(userService user.UserService) http.HandlerFunc {
 }
 
 type RefreshResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
 }
 
 func (sr *RefreshResponse) Render(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// RefreshHandler takes the refresh token as the bearer token, it's the only route that accepts refresh tokens.
 func RefreshHandler(userService user.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// refreshToken := r.Context().Value("token").(*jwt.Token)
-		claims := r.Context().Value("claims").(jwt.StandardClaims)
-		refreshTokenString := r.Context().Value("tokenString").(string)
+		refreshTokenString, err := bearerToken(r)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+		_, claims, err := userService.ParseRefreshToken(refreshTokenString)
+		if err != nil {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
+		ctx := audit.WithActor(r.Context(), claims.Subject)
 
-		token, err := userService.Refresh(claims.Subject, refreshTokenString)
+		token, refreshToken, err := userService.Refresh(ctx, claims.Subject, refreshTokenString, clientFromRequest(r))
+		if errors.Is(err, user.ErrRefreshTokenReuse) || errors.Is(err, user.ErrSessionExpired) || errors.Is(err, user.ErrTokenRevoked) {
+			render.Render(w, r, ErrUnauthorized(err))
+			return
+		}
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
 		}
 
 		render.Render(w, r, &RefreshResponse{
-			Token: token,
+			Token:        token,
+			RefreshToken: refreshToken,
 		})
 	}
 }
@@ -141,7 +189,7 @@ func LogoutHandler(userService user.UserService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims := r.Context().Value("claims").(jwt.StandardClaims)
 
-		err := userService.Logout(claims.Subject)
+		err := userService.Logout(r.Context(), claims.Subject)
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -170,7 +218,7 @@ func SendResetHandler(userService user.UserService) http.HandlerFunc {
 			return
 		}
 
-		err := userService.SendReset(data.Email)
+		err := userService.SendReset(r.Context(), data.Email)
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -209,7 +257,7 @@ func ResetHandler(userService user.UserService) http.HandlerFunc {
 			return
 		}
 
-		err := userService.ResetPassword(email, data.Password, code)
+		err := userService.ResetPassword(r.Context(), email, data.Password, code, clientFromRequest(r))
 		if err != nil {
 			render.Render(w, r, ErrBadRequest(err))
 			return
@@ -219,29 +267,53 @@ func ResetHandler(userService user.UserService) http.HandlerFunc {
 	}
 }
 
-func JWTAuthorizer(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		parts := strings.Split(r.Header.Get("authorization"), " ")
-		if len(parts) != 2 {
-			render.Render(w, r, ErrBadRequest(errors.New("malformed authorization header")))
-			return
-		}
-		tokenString := parts[1]
-		if tokenString == "" {
-			render.Render(w, r, ErrBadRequest(errors.New("missing jwt")))
-			return
-		}
-		claims := jwt.StandardClaims{}
-		token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("SECRET")), nil
+// bearerToken returns the token in the authorization header.
+func bearerToken(r *http.Request) (string, error) {
+	parts := strings.Split(r.Header.Get("authorization"), " ")
+	if len(parts) != 2 {
+		return "", errors.New("malformed authorization header")
+	}
+	if parts[1] == "" {
+		return "", errors.New("missing jwt")
+	}
+	return parts[1], nil
+}
+
+// JWTAuthorizer validates the bearer access token and rejects revoked tokens and users that aren't allowed to authenticate.
+func JWTAuthorizer(userService user.UserService) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, err := bearerToken(r)
+			if err != nil {
+				render.Render(w, r, ErrBadRequest(err))
+				return
+			}
+			token, claims, err := userService.ParseToken(tokenString)
+			if err != nil {
+				render.Render(w, r, ErrUnauthorized(err))
+				return
+			}
+			err = userService.CheckToken(r.Context(), claims)
+			if errors.Is(err, user.ErrTokenRevoked) {
+				render.Render(w, r, ErrUnauthorized(err))
+				return
+			}
+			if err != nil {
+				render.Render(w, r, ErrForbidden(err))
+				return
+			}
+			ctx := context.WithValue(r.Context(), "tokenString", tokenString)
+			ctx = context.WithValue(ctx, "token", token)
+			ctx = context.WithValue(ctx, "claims", claims.StandardClaims)
+			ctx = audit.WithActor(ctx, claims.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
 		})
-		if err != nil {
-			render.Render(w, r, ErrUnauthorized(err))
-			return
-		}
-		ctx := context.WithValue(r.Context(), "tokenString", tokenString)
-		ctx = context.WithValue(ctx, "token", token)
-		ctx = context.WithValue(ctx, "claims", claims)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	}
+}
+
+func clientFromRequest(r *http.Request) user.Client {
+	return user.Client{
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+	}
 }
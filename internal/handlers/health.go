@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/broswen/mimoto/internal/health"
+	"github.com/go-chi/render"
+)
+
+// LivenessHandler responds while the process can serve requests, without checking dependencies.
+func LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}
+}
+
+// ReadinessHandler responds with the result of every check, and 503 Service Unavailable if any failed.
+func ReadinessHandler(checker health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Run(r.Context())
+		if report.Status != health.StatusOK {
+			render.Status(r, http.StatusServiceUnavailable)
+		}
+		render.JSON(w, r, report)
+	}
+}
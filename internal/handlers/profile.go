@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/render"
+	"github.com/golang-jwt/jwt"
+)
+
+type ProfileResponse struct {
+	user.Profile
+}
+
+func (pr *ProfileResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type UpdateProfileRequest struct {
+	Name      *string         `json:"name"`
+	Locale    *string         `json:"locale"`
+	Timezone  *string         `json:"timezone"`
+	AvatarURL *string         `json:"avatarUrl"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+func (upr *UpdateProfileRequest) Bind(r *http.Request) error {
+	if upr.Name == nil && upr.Locale == nil && upr.Timezone == nil && upr.AvatarURL == nil && upr.Metadata == nil {
+		return errors.New("missing profile fields")
+	}
+	return nil
+}
+
+func GetProfileHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+
+		profile, err := userService.GetProfile(r.Context(), claims.Subject)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, &ProfileResponse{profile})
+	}
+}
+
+func UpdateProfileHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+		data := UpdateProfileRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		profile, err := userService.UpdateProfile(r.Context(), claims.Subject, user.ProfileUpdate{
+			Name:      data.Name,
+			Locale:    data.Locale,
+			Timezone:  data.Timezone,
+			AvatarURL: data.AvatarURL,
+			Metadata:  data.Metadata,
+		})
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, &ProfileResponse{profile})
+	}
+}
+
+// NotificationPreferencesResponse maps every security notification kind to whether it's sent.
+type NotificationPreferencesResponse map[string]bool
+
+func (npr NotificationPreferencesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type UpdateNotificationPreferencesRequest map[string]bool
+
+func (unpr UpdateNotificationPreferencesRequest) Bind(r *http.Request) error {
+	if len(unpr) == 0 {
+		return errors.New("missing notification preferences")
+	}
+	return nil
+}
+
+func GetNotificationPreferencesHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+
+		prefs, err := userService.GetNotificationPreferences(r.Context(), claims.Subject)
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, NotificationPreferencesResponse(prefs))
+	}
+}
+
+func UpdateNotificationPreferencesHandler(userService user.UserService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(jwt.StandardClaims)
+		data := UpdateNotificationPreferencesRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		prefs, err := userService.UpdateNotificationPreferences(r.Context(), claims.Subject, user.NotificationPreferences(data))
+		if err != nil {
+			renderUserError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, NotificationPreferencesResponse(prefs))
+	}
+}
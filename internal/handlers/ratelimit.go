@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+const (
+	// rateLimiterMaxKeys caps the memory of a limiter, requests from new keys are rejected while it's full.
+	rateLimiterMaxKeys = 100000
+	// rateLimiterPruneEvery is how many new keys are added between removing the expired ones,
+	// a full limiter removes them at most every rateLimiterFullPruneInterval.
+	rateLimiterPruneEvery        = 1000
+	rateLimiterFullPruneInterval = time.Second
+)
+
+// RateLimiter allows limit requests per key, like a client IP, in each fixed window.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	clients map[string]*rateWindow
+	maxKeys int
+	// added counts the keys added since the last prune at pruned.
+	added  int
+	pruned time.Time
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		clients: make(map[string]*rateWindow),
+		maxKeys: rateLimiterMaxKeys,
+	}
+}
+
+// Allow records a request from key and reports whether it's within the limit.
+func (rl *RateLimiter) Allow(key string) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	w, ok := rl.clients[key]
+	if ok && now.Sub(w.start) >= rl.window {
+		*w = rateWindow{start: now}
+	}
+	if !ok {
+		full := len(rl.clients) >= rl.maxKeys
+		if rl.added >= rateLimiterPruneEvery || (full && now.Sub(rl.pruned) >= rateLimiterFullPruneInterval) {
+			rl.prune(now)
+		}
+		if len(rl.clients) >= rl.maxKeys {
+			return false
+		}
+		w = &rateWindow{start: now}
+		rl.clients[key] = w
+		rl.added++
+	}
+	w.count++
+	return w.count <= rl.limit
+}
+
+// prune removes the keys whose window ended, it walks every key so Allow only runs it now and then.
+func (rl *RateLimiter) prune(now time.Time) {
+	rl.added = 0
+	rl.pruned = now
+	for key, w := range rl.clients {
+		if now.Sub(w.start) >= rl.window {
+			delete(rl.clients, key)
+		}
+	}
+}
+
+// Handler limits the requests of each client IP.
+func (rl *RateLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rl.Allow(clientIP(r)) {
+			rl.reject(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (rl *RateLimiter) reject(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(rl.window.Seconds())))
+	render.Render(w, r, ErrTooManyRequests(errors.New("rate limit exceeded")))
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(2, time.Hour)
+	for i, want := range []bool{true, true, false} {
+		if got := rl.Allow("198.51.100.1"); got != want {
+			t.Fatalf("request %d: allowed doesn't match: wanted %v but got %v", i, want, got)
+		}
+	}
+	if !rl.Allow("198.51.100.2") {
+		t.Fatalf("other key wasn't allowed")
+	}
+}
+
+func TestRateLimiterFull(t *testing.T) {
+	rl := NewRateLimiter(1, time.Hour)
+	rl.maxKeys = 10
+	for i := 0; i < rl.maxKeys; i++ {
+		rl.Allow(strconv.Itoa(i))
+	}
+	// new keys are rejected while every window is still open
+	if rl.Allow("new") {
+		t.Fatalf("new key was allowed in a full limiter")
+	}
+	if len(rl.clients) != rl.maxKeys {
+		t.Fatalf("keys don't match: wanted %v but got %v", rl.maxKeys, len(rl.clients))
+	}
+
+	// once the windows end the expired keys make room
+	for _, w := range rl.clients {
+		w.start = w.start.Add(-time.Hour)
+	}
+	rl.pruned = rl.pruned.Add(-rateLimiterFullPruneInterval)
+	if !rl.Allow("new") {
+		t.Fatalf("new key wasn't allowed after the windows ended")
+	}
+	if len(rl.clients) != 1 {
+		t.Fatalf("keys don't match: wanted %v but got %v", 1, len(rl.clients))
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+)
+
+type SubscriptionRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func (sr *SubscriptionRequest) Bind(r *http.Request) error {
+	if sr.URL == "" {
+		return errors.New("missing url")
+	}
+	if len(sr.Events) == 0 {
+		return errors.New("missing events")
+	}
+	return nil
+}
+
+type SubscriptionResponse struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (sr *SubscriptionResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func NewSubscriptionResponse(sub repository.WebhookSubscription) *SubscriptionResponse {
+	return &SubscriptionResponse{
+		ID:        sub.ID,
+		URL:       sub.URL,
+		Events:    strings.Split(sub.Events, ","),
+		CreatedAt: sub.CreatedAt,
+	}
+}
+
+type SubscriptionListResponse struct {
+	Subscriptions []*SubscriptionResponse `json:"subscriptions"`
+}
+
+func (slr *SubscriptionListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type DeliveryListResponse struct {
+	Deliveries []repository.WebhookDelivery `json:"deliveries"`
+	Total      int64                        `json:"total"`
+	Offset     int                          `json:"offset"`
+	Limit      int                          `json:"limit"`
+}
+
+func (dlr *DeliveryListResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type DeliveryResponse struct {
+	repository.WebhookDelivery
+}
+
+func (dr *DeliveryResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func renderWebhookError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) || errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		render.Render(w, r, ErrNotFound(err))
+		return
+	}
+	render.Render(w, r, ErrBadRequest(err))
+}
+
+// CreateSubscriptionHandler records the subscription's url as the reason of the audit event.
+func CreateSubscriptionHandler(webhookService webhook.WebhookService, auditSink audit.AuditSink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := SubscriptionRequest{}
+		if err := render.Bind(r, &data); err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		sub, err := webhookService.CreateSubscription(r.Context(), data.URL, data.Events)
+		recordAdminAction(r, auditSink, audit.TypeAdminWebhookCreate, sub.ID, data.URL, err)
+		if err != nil {
+			renderWebhookError(w, r, err)
+			return
+		}
+
+		response := NewSubscriptionResponse(sub)
+		response.Secret = sub.Secret
+		render.Status(r, http.StatusCreated)
+		render.Render(w, r, response)
+	}
+}
+
+func ListSubscriptionsHandler(webhookService webhook.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		subs, err := webhookService.ListSubscriptions(r.Context())
+		if err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			return
+		}
+
+		response := &SubscriptionListResponse{
+			Subscriptions: make([]*SubscriptionResponse, 0, len(subs)),
+		}
+		for _, sub := range subs {
+			response.Subscriptions = append(response.Subscriptions, NewSubscriptionResponse(sub))
+		}
+		render.Render(w, r, response)
+	}
+}
+
+func DeleteSubscriptionHandler(webhookService webhook.WebhookService, auditSink audit.AuditSink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		err := webhookService.DeleteSubscription(r.Context(), id)
+		recordAdminAction(r, auditSink, audit.TypeAdminWebhookDelete, id, "", err)
+		if err != nil {
+			renderWebhookError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// ListDeliveriesHandler returns the delivery log of the subscription in the id url param, newest first.
+func ListDeliveriesHandler(webhookService webhook.WebhookService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, limit, err := parsePage(r.URL.Query(), defaultPageLimit)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		deliveries, total, err := webhookService.ListDeliveries(r.Context(), chi.URLParam(r, "id"), offset, limit)
+		if err != nil {
+			renderWebhookError(w, r, err)
+			return
+		}
+
+		render.Render(w, r, &DeliveryListResponse{
+			Deliveries: deliveries,
+			Total:      total,
+			Offset:     offset,
+			Limit:      limit,
+		})
+	}
+}
+
+// ReplayDeliveryHandler queues the event of the delivery in the id url param to be sent again.
+func ReplayDeliveryHandler(webhookService webhook.WebhookService, auditSink audit.AuditSink) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		delivery, err := webhookService.Replay(r.Context(), id)
+		recordAdminAction(r, auditSink, audit.TypeAdminWebhookReplay, id, "", err)
+		if err != nil {
+			renderWebhookError(w, r, err)
+			return
+		}
+
+		render.Status(r, http.StatusAccepted)
+		render.Render(w, r, &DeliveryResponse{delivery})
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/httplog"
+	"github.com/go-chi/render"
+)
+
+const (
+	maxWebhookBodySize = 1 << 20
+	maxWebhookAge      = 10 * time.Minute
+)
+
+// SendGridWebhookHandler records the delivery events of the SendGrid signed event webhook.
+func SendGridWebhookHandler(userService user.UserService, publicKey *ecdsa.PublicKey) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		err = email.VerifySendGridSignature(publicKey,
+			r.Header.Get("X-Twilio-Email-Event-Webhook-Signature"),
+			r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp"),
+			body, maxWebhookAge)
+		if err != nil {
+			render.Render(w, r, ErrForbidden(err))
+			return
+		}
+
+		events, err := email.ParseSendGridEvents(body)
+		if err != nil {
+			render.Render(w, r, ErrBadRequest(err))
+			return
+		}
+
+		// a non-2xx response makes SendGrid retry, and duplicate events are ignored
+		err = userService.RecordEmailEvents(r.Context(), events)
+		if err != nil {
+			oplog := httplog.LogEntry(r.Context())
+			oplog.Error().Err(err).Msg("record email events")
+			render.Render(w, r, ErrInternalServer(errors.New("unable to record events")))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,166 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check returns an error when the dependency it checks isn't usable.
+type Check func(ctx context.Context) error
+
+type Options struct {
+	// Timeout is how long each check can take before it fails.
+	Timeout time.Duration
+	// CacheTTL is how long a report is reused, so frequent probes don't hammer dependencies.
+	CacheTTL time.Duration
+}
+
+var DefaultOptions = Options{
+	Timeout:  2 * time.Second,
+	CacheTTL: 5 * time.Second,
+}
+
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Optional checks are reported but don't fail the report.
+	Optional bool `json:"optional,omitempty"`
+	// Duration is how long the check took, e.g. "12ms".
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checkedAt"`
+	Checks    map[string]Result `json:"checks"`
+}
+
+type registered struct {
+	check    Check
+	optional bool
+}
+
+type registry struct {
+	mu       sync.Mutex
+	checks   map[string]registered
+	report   Report
+	cachedAt time.Time
+}
+
+// Checker runs the registered checks to decide whether the server is ready for traffic.
+type Checker struct {
+	options  Options
+	registry *registry
+}
+
+func New(options Options) (Checker, error) {
+	if options.Timeout <= 0 || options.CacheTTL < 0 {
+		return Checker{}, fmt.Errorf("invalid health options: %+v", options)
+	}
+	return Checker{
+		options:  options,
+		registry: &registry{checks: make(map[string]registered)},
+	}, nil
+}
+
+// Register adds a check, replacing any check with the same name.
+func (c Checker) Register(name string, check Check) {
+	c.register(name, registered{check: check})
+}
+
+// RegisterOptional adds a check of a dependency the server can work without for a while,
+// its result is reported but doesn't fail the report.
+func (c Checker) RegisterOptional(name string, check Check) {
+	c.register(name, registered{check: check, optional: true})
+}
+
+func (c Checker) register(name string, r registered) {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.registry.checks[name] = r
+	c.registry.cachedAt = time.Time{}
+}
+
+// Run runs every check concurrently, or returns the cached report if it's recent enough.
+// The report is failing if any check that isn't optional failed.
+func (c Checker) Run(ctx context.Context) Report {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	now := time.Now()
+	if !c.registry.cachedAt.IsZero() && now.Sub(c.registry.cachedAt) < c.options.CacheTTL {
+		return c.registry.report
+	}
+
+	names := make([]string, 0, len(c.registry.checks))
+	for name := range c.registry.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]Result, len(names))
+	wg := sync.WaitGroup{}
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, r registered) {
+			defer wg.Done()
+			results[i] = c.run(ctx, r.check)
+			results[i].Optional = r.optional
+		}(i, c.registry.checks[name])
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusOK,
+		CheckedAt: now,
+		Checks:    make(map[string]Result, len(names)),
+	}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusOK && !results[i].Optional {
+			report.Status = StatusFailing
+		}
+	}
+	c.registry.report = report
+	c.registry.cachedAt = now
+	return report
+}
+
+// run fails the check once the timeout passes, even if it ignores its context.
+func (c Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.options.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", c.options.Timeout)
+	}
+
+	result := Result{
+		Status:   StatusOK,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	return result
+}
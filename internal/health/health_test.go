@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestChecker(t *testing.T) {
+	checker, err := New(Options{Timeout: 50 * time.Millisecond, CacheTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	runs := 0
+	checker.Register("db", func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+	report := checker.Run(context.Background())
+	if report.Status != StatusOK || report.Checks["db"].Status != StatusOK {
+		t.Fatalf("status doesn't match: wanted %v but got %+v", StatusOK, report)
+	}
+
+	// reports are cached until a check is registered
+	checker.Run(context.Background())
+	if runs != 1 {
+		t.Fatalf("runs don't match: wanted %v but got %v", 1, runs)
+	}
+
+	checker.Register("email", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	// checks that ignore their context still time out
+	checker.Register("keys", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	report = checker.Run(context.Background())
+	if runs != 2 {
+		t.Fatalf("runs don't match: wanted %v but got %v", 2, runs)
+	}
+	if report.Status != StatusFailing {
+		t.Fatalf("status doesn't match: wanted %v but got %v", StatusFailing, report.Status)
+	}
+	if result := report.Checks["email"]; result.Status != StatusFailing || result.Error != "connection refused" {
+		t.Fatalf("email result doesn't match: wanted %v but got %+v", "connection refused", result)
+	}
+	if result := report.Checks["keys"]; result.Status != StatusFailing || result.Error != "timed out after 50ms" {
+		t.Fatalf("keys result doesn't match: wanted %v but got %+v", "timed out after 50ms", result)
+	}
+	if result := report.Checks["db"]; result.Status != StatusOK {
+		t.Fatalf("db result doesn't match: wanted %v but got %+v", StatusOK, result)
+	}
+}
+
+func TestCheckerOptional(t *testing.T) {
+	checker, _ := New(Options{Timeout: 50 * time.Millisecond})
+	checker.Register("db", func(ctx context.Context) error {
+		return nil
+	})
+	checker.RegisterOptional("email", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	// failing optional checks are reported without failing the report
+	report := checker.Run(context.Background())
+	if report.Status != StatusOK {
+		t.Fatalf("status doesn't match: wanted %v but got %+v", StatusOK, report)
+	}
+	if result := report.Checks["email"]; result.Status != StatusFailing || !result.Optional {
+		t.Fatalf("email result doesn't match: wanted an optional failure but got %+v", result)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Fatalf("New: wanted error for zero timeout")
+	}
+}
@@ -0,0 +1,125 @@
+package keys
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrNoKeys = errors.New("keyring has no keys")
+
+// Key is an HMAC secret that signs tokens, tokens name the key that signed them in their kid header.
+type Key struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Keyring is the keys that verify tokens, newest first. The newest key signs new tokens.
+type Keyring struct {
+	Keys []Key `json:"keys"`
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Generate returns a new random key.
+func Generate(now time.Time) (Key, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return Key{}, fmt.Errorf("generate key id: %w", err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Key{}, fmt.Errorf("generate key secret: %w", err)
+	}
+	return Key{
+		ID:        id,
+		Secret:    secret,
+		CreatedAt: now,
+	}, nil
+}
+
+// Load reads the keyring in the JSON file at path.
+func Load(path string) (Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Keyring{}, err
+	}
+	var keyring Keyring
+	if err := json.Unmarshal(b, &keyring); err != nil {
+		return Keyring{}, fmt.Errorf("parse keyring %s: %w", path, err)
+	}
+	for _, key := range keyring.Keys {
+		if key.ID == "" || key.Secret == "" {
+			return Keyring{}, fmt.Errorf("keyring %s has a key without an id or secret", path)
+		}
+	}
+	return keyring, nil
+}
+
+// Save writes the keyring to path, replacing it at once so readers never see half a keyring.
+func (k Keyring) Save(path string) error {
+	b, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Rotate adds a new signing key and drops the oldest keys past keep,
+// the tokens they signed stop verifying.
+func (k *Keyring) Rotate(now time.Time, keep int) (Key, error) {
+	if keep < 1 {
+		return Key{}, fmt.Errorf("invalid number of keys to keep: %d", keep)
+	}
+	key, err := Generate(now)
+	if err != nil {
+		return Key{}, err
+	}
+	k.Keys = append([]Key{key}, k.Keys...)
+	if len(k.Keys) > keep {
+		k.Keys = k.Keys[:keep]
+	}
+	return key, nil
+}
+
+// Active returns the key that signs new tokens.
+func (k Keyring) Active() (Key, error) {
+	if len(k.Keys) == 0 {
+		return Key{}, ErrNoKeys
+	}
+	return k.Keys[0], nil
+}
+
+// Find returns the key with id.
+func (k Keyring) Find(id string) (Key, bool) {
+	for _, key := range k.Keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
@@ -0,0 +1,97 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotate(t *testing.T) {
+	var keyring Keyring
+	if _, err := keyring.Active(); err != ErrNoKeys {
+		t.Fatalf("Active doesn't match: wanted %v but got %v", ErrNoKeys, err)
+	}
+
+	now := time.Now()
+	first, err := keyring.Rotate(now, 2)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	second, _ := keyring.Rotate(now.Add(time.Hour), 2)
+	third, _ := keyring.Rotate(now.Add(2*time.Hour), 2)
+
+	active, err := keyring.Active()
+	if err != nil {
+		t.Fatalf("Active: %v", err)
+	}
+	if active.ID != third.ID {
+		t.Fatalf("active key doesn't match: wanted %v but got %v", third.ID, active.ID)
+	}
+	if _, ok := keyring.Find(second.ID); !ok {
+		t.Fatalf("previous key was dropped")
+	}
+	// only the two newest keys are kept
+	if _, ok := keyring.Find(first.ID); ok {
+		t.Fatalf("oldest key wasn't dropped")
+	}
+	if len(keyring.Keys) != 2 {
+		t.Fatalf("keys don't match: wanted %v but got %v", 2, len(keyring.Keys))
+	}
+
+	if _, err := keyring.Rotate(now, 0); err == nil {
+		t.Fatalf("Rotate: keeping no keys didn't fail")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	a, err := Generate(time.Now())
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	b, _ := Generate(time.Now())
+	if a.ID == b.ID || a.Secret == b.Secret {
+		t.Fatalf("generated keys repeat: %+v %+v", a, b)
+	}
+	if len(a.Secret) != 64 {
+		t.Fatalf("secret length doesn't match: wanted %v but got %v", 64, len(a.Secret))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	var keyring Keyring
+	key, _ := keyring.Rotate(time.Now(), 3)
+	if err := keyring.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	// the keyring holds secrets
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("mode doesn't match: wanted %v but got %v", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	active, _ := loaded.Active()
+	if active.ID != key.ID || active.Secret != key.Secret {
+		t.Fatalf("loaded key doesn't match: wanted %+v but got %+v", key, active)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Fatalf("Load: missing file didn't fail")
+	}
+	path := filepath.Join(dir, "keys.json")
+	os.WriteFile(path, []byte(`{"keys":[{"id":"a"}]}`), 0600)
+	if _, err := Load(path); err == nil {
+		t.Fatalf("Load: key without secret didn't fail")
+	}
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+)
+
+// EmailService counts the outcome of every email the wrapped service sends through provider.
+type EmailService struct {
+	emailService email.EmailService
+	provider     string
+	metrics      Metrics
+}
+
+func NewEmailService(emailService email.EmailService, provider string, m Metrics) (EmailService, error) {
+	return EmailService{
+		emailService: emailService,
+		provider:     provider,
+		metrics:      m,
+	}, nil
+}
+
+func (s EmailService) observe(kind string, start time.Time, err error) {
+	s.metrics.emails.WithLabelValues(s.provider, kind, outcome(err)).Inc()
+	s.metrics.emailDuration.WithLabelValues(s.provider).Observe(time.Since(start).Seconds())
+}
+
+func (s EmailService) SendConfirmation(ctx context.Context, to email.Recipient, code string) error {
+	start := time.Now()
+	err := s.emailService.SendConfirmation(ctx, to, code)
+	s.observe(email.KindConfirmation, start, err)
+	return err
+}
+
+func (s EmailService) SendConfirmationSuccess(ctx context.Context, to email.Recipient) error {
+	start := time.Now()
+	err := s.emailService.SendConfirmationSuccess(ctx, to)
+	s.observe(email.KindConfirmationSuccess, start, err)
+	return err
+}
+
+func (s EmailService) SendReset(ctx context.Context, to email.Recipient, code string) error {
+	start := time.Now()
+	err := s.emailService.SendReset(ctx, to, code)
+	s.observe(email.KindReset, start, err)
+	return err
+}
+
+func (s EmailService) SendSecurityNotification(ctx context.Context, to email.Recipient, kind string, activity email.Activity) error {
+	start := time.Now()
+	err := s.emailService.SendSecurityNotification(ctx, to, kind, activity)
+	s.observe(kind, start, err)
+	return err
+}
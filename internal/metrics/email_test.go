@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// failingEmailService fails every send with err.
+type failingEmailService struct {
+	err error
+}
+
+func (f failingEmailService) SendConfirmation(ctx context.Context, to email.Recipient, code string) error {
+	return f.err
+}
+
+func (f failingEmailService) SendConfirmationSuccess(ctx context.Context, to email.Recipient) error {
+	return f.err
+}
+
+func (f failingEmailService) SendReset(ctx context.Context, to email.Recipient, code string) error {
+	return f.err
+}
+
+func (f failingEmailService) SendSecurityNotification(ctx context.Context, to email.Recipient, kind string, activity email.Activity) error {
+	return f.err
+}
+
+func TestEmailService(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMetrics(t)
+	tests := []struct {
+		err     error
+		outcome string
+	}{
+		{nil, "sent"},
+		{email.ErrSuppressed, "suppressed"},
+		{email.ErrPermanent, "permanent_failure"},
+		{email.ErrTemporary, "temporary_failure"},
+	}
+	for _, test := range tests {
+		es, _ := NewEmailService(failingEmailService{err: test.err}, "smtp", m)
+		es.SendReset(ctx, email.Recipient{Email: "test@test.com"}, "code")
+		if got := testutil.ToFloat64(m.emails.WithLabelValues("smtp", email.KindReset, test.outcome)); got != 1 {
+			t.Fatalf("%s emails don't match: wanted %v but got %v", test.outcome, 1, got)
+		}
+	}
+}
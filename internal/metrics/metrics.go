@@ -0,0 +1,203 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const namespace = "mimoto"
+
+// Metrics holds the collectors of every instrumented component, registered with their own registry.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requestDuration    *prometheus.HistogramVec
+	signups            *prometheus.CounterVec
+	confirmations      *prometheus.CounterVec
+	logins             *prometheus.CounterVec
+	refreshes          *prometheus.CounterVec
+	passwordResets     *prometheus.CounterVec
+	lockouts           *prometheus.CounterVec
+	passwordDuration   *prometheus.HistogramVec
+	repositoryDuration *prometheus.HistogramVec
+	emails             *prometheus.CounterVec
+	emailDuration      *prometheus.HistogramVec
+}
+
+func New() (Metrics, error) {
+	m := Metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		signups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signups_total",
+			Help:      "Signups by result.",
+		}, []string{"result"}),
+		confirmations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "confirmations_total",
+			Help:      "Account confirmations by result.",
+		}, []string{"result"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Logins by result, success or the reason they failed.",
+		}, []string{"result"}),
+		refreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refreshes_total",
+			Help:      "Token refreshes by result, success or the reason they failed.",
+		}, []string{"result"}),
+		passwordResets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "password_resets_total",
+			Help:      "Password resets by stage, requested or completed, and result.",
+		}, []string{"stage", "result"}),
+		lockouts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lockouts_total",
+			Help:      "Accounts locked by an admin, by the status they were given.",
+		}, []string{"status"}),
+		passwordDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hash_duration_seconds",
+			Help:      "Duration of hashing passwords and comparing them to hashes.",
+			Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"operation"}),
+		repositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_query_duration_seconds",
+			Help:      "Duration of repository queries by operation and result.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation", "result"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "emails_total",
+			Help:      "Emails sent by provider, kind and outcome.",
+		}, []string{"provider", "kind", "outcome"}),
+		emailDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "email_send_duration_seconds",
+			Help:      "Duration of sending emails by provider.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"provider"}),
+	}
+
+	collectors := []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.signups,
+		m.confirmations,
+		m.logins,
+		m.refreshes,
+		m.passwordResets,
+		m.lockouts,
+		m.passwordDuration,
+		m.repositoryDuration,
+		m.emails,
+		m.emailDuration,
+	}
+	for _, collector := range collectors {
+		if err := m.registry.Register(collector); err != nil {
+			return Metrics{}, err
+		}
+	}
+	return m, nil
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware observes the latency of every request by its route pattern, so paths with ids share a series.
+func (m Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requestDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeSince observes the seconds since start, it's meant to be deferred.
+func observeSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// result labels an auth flow outcome, keeping the set of failure reasons small.
+func result(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, repository.ErrUserNotFound):
+		return "user_not_found"
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return "wrong_password"
+	case errors.Is(err, user.ErrNotConfirmed):
+		return "not_confirmed"
+	case errors.Is(err, user.ErrAccountSuspended):
+		return "suspended"
+	case errors.Is(err, user.ErrAccountDisabled):
+		return "disabled"
+	case errors.Is(err, user.ErrAccountPendingDeletion):
+		return "pending_deletion"
+	case errors.Is(err, user.ErrRefreshTokenReuse):
+		return "refresh_token_reuse"
+	case errors.Is(err, user.ErrSessionExpired):
+		return "session_expired"
+	case errors.Is(err, user.ErrUnknownAudience):
+		return "unknown_audience"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
+
+// outcome labels an email delivery by the class of its error.
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "sent"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, email.ErrSuppressed):
+		return "suppressed"
+	case errors.Is(err, email.ErrPermanent):
+		return "permanent_failure"
+	case errors.Is(err, email.ErrTemporary):
+		return "temporary_failure"
+	}
+	return "error"
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newTestMetrics(t *testing.T) Metrics {
+	t.Helper()
+	m, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return m
+}
+
+func TestMiddleware(t *testing.T) {
+	m := newTestMetrics(t)
+	router := chi.NewRouter()
+	router.Use(m.Middleware)
+	router.Get("/admin/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.Handle("/metrics", m.Handler())
+
+	for _, email := range []string{"a@test.com", "b@test.com"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/users/"+email, nil))
+	}
+	// paths with ids share the series of their route
+	if n := testutil.CollectAndCount(m.requestDuration); n != 1 {
+		t.Fatalf("request duration series don't match: wanted %v but got %v", 1, n)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	want := `mimoto_http_request_duration_seconds_count{code="404",method="GET",route="/admin/users/{email}"} 2`
+	if !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("metrics don't contain %s:\n%s", want, w.Body.String())
+	}
+}
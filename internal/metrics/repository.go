@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+// Repository times every query of the wrapped repository.
+type Repository struct {
+	repository.Repository
+	metrics Metrics
+}
+
+func NewRepository(repo repository.Repository, m Metrics) (Repository, error) {
+	return Repository{
+		Repository: repo,
+		metrics:    m,
+	}, nil
+}
+
+// observe records a query that started at start, missing rows aren't failed queries.
+func (r Repository) observe(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) && !errors.Is(err, repository.ErrWebhookSubscriptionNotFound) && !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		result = "error"
+	}
+	r.metrics.repositoryDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+func (r Repository) FindByEmail(ctx context.Context, email string) (repository.User, error) {
+	start := time.Now()
+	user, err := r.Repository.FindByEmail(ctx, email)
+	r.observe("find_by_email", start, err)
+	return user, err
+}
+
+func (r Repository) List(ctx context.Context, opts repository.ListOptions) ([]repository.User, int64, error) {
+	start := time.Now()
+	users, total, err := r.Repository.List(ctx, opts)
+	r.observe("list", start, err)
+	return users, total, err
+}
+
+func (r Repository) Create(ctx context.Context, user *repository.User, outbox ...repository.OutboxMessage) error {
+	start := time.Now()
+	err := r.Repository.Create(ctx, user, outbox...)
+	r.observe("create", start, err)
+	return err
+}
+
+func (r Repository) Save(ctx context.Context, user *repository.User, outbox ...repository.OutboxMessage) error {
+	start := time.Now()
+	err := r.Repository.Save(ctx, user, outbox...)
+	r.observe("save", start, err)
+	return err
+}
+
+func (r Repository) Delete(ctx context.Context, email string, outbox ...repository.OutboxMessage) error {
+	start := time.Now()
+	err := r.Repository.Delete(ctx, email, outbox...)
+	r.observe("delete", start, err)
+	return err
+}
+
+func (r Repository) CreateEmailEvent(ctx context.Context, event *repository.EmailEvent) error {
+	start := time.Now()
+	err := r.Repository.CreateEmailEvent(ctx, event)
+	r.observe("create_email_event", start, err)
+	return err
+}
+
+func (r Repository) ListEmailEvents(ctx context.Context, email string) ([]repository.EmailEvent, error) {
+	start := time.Now()
+	events, err := r.Repository.ListEmailEvents(ctx, email)
+	r.observe("list_email_events", start, err)
+	return events, err
+}
+
+func (r Repository) Suppress(ctx context.Context, email, reason string) error {
+	start := time.Now()
+	err := r.Repository.Suppress(ctx, email, reason)
+	r.observe("suppress", start, err)
+	return err
+}
+
+func (r Repository) Unsuppress(ctx context.Context, email string) error {
+	start := time.Now()
+	err := r.Repository.Unsuppress(ctx, email)
+	r.observe("unsuppress", start, err)
+	return err
+}
+
+func (r Repository) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	start := time.Now()
+	suppressed, err := r.Repository.IsSuppressed(ctx, email)
+	r.observe("is_suppressed", start, err)
+	return suppressed, err
+}
+
+func (r Repository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repository.OutboxMessage, error) {
+	start := time.Now()
+	messages, err := r.Repository.ClaimOutbox(ctx, now, lease, limit)
+	r.observe("claim_outbox", start, err)
+	return messages, err
+}
+
+func (r Repository) SaveOutbox(ctx context.Context, msg *repository.OutboxMessage) error {
+	start := time.Now()
+	err := r.Repository.SaveOutbox(ctx, msg)
+	r.observe("save_outbox", start, err)
+	return err
+}
+
+func (r Repository) CreateWebhookSubscription(ctx context.Context, sub *repository.WebhookSubscription) error {
+	start := time.Now()
+	err := r.Repository.CreateWebhookSubscription(ctx, sub)
+	r.observe("create_webhook_subscription", start, err)
+	return err
+}
+
+func (r Repository) FindWebhookSubscription(ctx context.Context, id string) (repository.WebhookSubscription, error) {
+	start := time.Now()
+	sub, err := r.Repository.FindWebhookSubscription(ctx, id)
+	r.observe("find_webhook_subscription", start, err)
+	return sub, err
+}
+
+func (r Repository) ListWebhookSubscriptions(ctx context.Context) ([]repository.WebhookSubscription, error) {
+	start := time.Now()
+	subs, err := r.Repository.ListWebhookSubscriptions(ctx)
+	r.observe("list_webhook_subscriptions", start, err)
+	return subs, err
+}
+
+func (r Repository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	start := time.Now()
+	err := r.Repository.DeleteWebhookSubscription(ctx, id)
+	r.observe("delete_webhook_subscription", start, err)
+	return err
+}
+
+func (r Repository) CreateWebhookDeliveries(ctx context.Context, deliveries []repository.WebhookDelivery) error {
+	start := time.Now()
+	err := r.Repository.CreateWebhookDeliveries(ctx, deliveries)
+	r.observe("create_webhook_deliveries", start, err)
+	return err
+}
+
+func (r Repository) FindWebhookDelivery(ctx context.Context, id string) (repository.WebhookDelivery, error) {
+	start := time.Now()
+	delivery, err := r.Repository.FindWebhookDelivery(ctx, id)
+	r.observe("find_webhook_delivery", start, err)
+	return delivery, err
+}
+
+func (r Repository) ListWebhookDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]repository.WebhookDelivery, int64, error) {
+	start := time.Now()
+	deliveries, total, err := r.Repository.ListWebhookDeliveries(ctx, subscriptionID, offset, limit)
+	r.observe("list_webhook_deliveries", start, err)
+	return deliveries, total, err
+}
+
+func (r Repository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]repository.WebhookDelivery, error) {
+	start := time.Now()
+	deliveries, err := r.Repository.ClaimWebhookDeliveries(ctx, now, lease, limit)
+	r.observe("claim_webhook_deliveries", start, err)
+	return deliveries, err
+}
+
+func (r Repository) SaveWebhookDelivery(ctx context.Context, delivery *repository.WebhookDelivery) error {
+	start := time.Now()
+	err := r.Repository.SaveWebhookDelivery(ctx, delivery)
+	r.observe("save_webhook_delivery", start, err)
+	return err
+}
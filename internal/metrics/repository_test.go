@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRepository(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMetrics(t)
+	mr, _ := repository.NewMap()
+	repo, _ := NewRepository(mr, m)
+
+	if err := repo.Create(ctx, &repository.User{Email: "test@test.com"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	repo.FindByEmail(ctx, "missing@test.com")
+	repo.Create(ctx, &repository.User{Email: "test@test.com"})
+
+	// missing users aren't failed queries
+	if n := testutil.CollectAndCount(m.repositoryDuration); n != 3 {
+		t.Fatalf("repository series don't match: wanted %v but got %v", 3, n)
+	}
+	want := []struct {
+		operation string
+		result    string
+	}{
+		{"create", "success"},
+		{"create", "error"},
+		{"find_by_email", "success"},
+	}
+	for _, w := range want {
+		if _, err := m.repositoryDuration.GetMetricWithLabelValues(w.operation, w.result); err != nil {
+			t.Fatalf("GetMetricWithLabelValues: %v", err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+)
+
+// UserService counts the outcome of every auth flow of the wrapped service.
+type UserService struct {
+	user.UserService
+	metrics Metrics
+}
+
+func NewUserService(userService user.UserService, m Metrics) (UserService, error) {
+	return UserService{
+		UserService: userService,
+		metrics:     m,
+	}, nil
+}
+
+func (s UserService) Signup(ctx context.Context, email, name, password string) error {
+	err := s.UserService.Signup(ctx, email, name, password)
+	s.metrics.signups.WithLabelValues(result(err)).Inc()
+	return err
+}
+
+func (s UserService) Confirm(ctx context.Context, email, code string) error {
+	err := s.UserService.Confirm(ctx, email, code)
+	s.metrics.confirmations.WithLabelValues(result(err)).Inc()
+	return err
+}
+
+func (s UserService) Login(ctx context.Context, email, password string, client user.Client) (string, string, error) {
+	token, refreshToken, err := s.UserService.Login(ctx, email, password, client)
+	s.metrics.logins.WithLabelValues(result(err)).Inc()
+	return token, refreshToken, err
+}
+
+func (s UserService) Refresh(ctx context.Context, email, token string, client user.Client) (string, string, error) {
+	newToken, refreshToken, err := s.UserService.Refresh(ctx, email, token, client)
+	s.metrics.refreshes.WithLabelValues(result(err)).Inc()
+	return newToken, refreshToken, err
+}
+
+func (s UserService) SendReset(ctx context.Context, email string) error {
+	err := s.UserService.SendReset(ctx, email)
+	s.metrics.passwordResets.WithLabelValues("requested", result(err)).Inc()
+	return err
+}
+
+func (s UserService) ResetPassword(ctx context.Context, email, password, code string, client user.Client) error {
+	err := s.UserService.ResetPassword(ctx, email, password, code, client)
+	s.metrics.passwordResets.WithLabelValues("completed", result(err)).Inc()
+	return err
+}
+
+func (s UserService) SuspendUser(ctx context.Context, email, reason string, until *time.Time) error {
+	err := s.UserService.SuspendUser(ctx, email, reason, until)
+	if err == nil {
+		s.metrics.lockouts.WithLabelValues(repository.StatusSuspended).Inc()
+	}
+	return err
+}
+
+func (s UserService) DisableUser(ctx context.Context, email, reason string) error {
+	err := s.UserService.DisableUser(ctx, email, reason)
+	if err == nil {
+		s.metrics.lockouts.WithLabelValues(repository.StatusDisabled).Inc()
+	}
+	return err
+}
+
+// PasswordHasher observes how long the wrapped hasher takes.
+type PasswordHasher struct {
+	hasher  user.PasswordHasher
+	metrics Metrics
+}
+
+func NewPasswordHasher(hasher user.PasswordHasher, m Metrics) (PasswordHasher, error) {
+	return PasswordHasher{
+		hasher:  hasher,
+		metrics: m,
+	}, nil
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	defer observeSince(h.metrics.passwordDuration.WithLabelValues("hash"), time.Now())
+	return h.hasher.Hash(password)
+}
+
+func (h PasswordHasher) Compare(hash, password string) error {
+	defer observeSince(h.metrics.passwordDuration.WithLabelValues("compare"), time.Now())
+	return h.hasher.Compare(hash, password)
+}
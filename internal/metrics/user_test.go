@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMetrics(t)
+	ur, _ := repository.NewMap()
+	hasher, _ := NewPasswordHasher(user.BcryptHasher{Cost: bcrypt.MinCost}, m)
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	service, err := user.New(ur, hasher, nil, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	us, _ := NewUserService(service, m)
+
+	if err := us.Signup(ctx, "test@test.com", "test", "password"); err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	us.Login(ctx, "test@test.com", "password", user.Client{})
+	found, _ := ur.FindByEmail(ctx, "test@test.com")
+	code := found.ConfirmationCode
+	if err := us.Confirm(ctx, "test@test.com", code); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	us.Login(ctx, "test@test.com", "wrong", user.Client{})
+	us.Login(ctx, "missing@test.com", "password", user.Client{})
+	if _, _, err := us.Login(ctx, "test@test.com", "password", user.Client{}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := us.DisableUser(ctx, "test@test.com", "spam"); err != nil {
+		t.Fatalf("DisableUser: %v", err)
+	}
+	us.Login(ctx, "test@test.com", "password", user.Client{})
+
+	tests := []struct {
+		result string
+		want   float64
+	}{
+		{"success", 1},
+		{"not_confirmed", 1},
+		{"wrong_password", 1},
+		{"user_not_found", 1},
+		{"disabled", 1},
+	}
+	for _, test := range tests {
+		if got := testutil.ToFloat64(m.logins.WithLabelValues(test.result)); got != test.want {
+			t.Fatalf("%s logins don't match: wanted %v but got %v", test.result, test.want, got)
+		}
+	}
+	if got := testutil.ToFloat64(m.signups.WithLabelValues("success")); got != 1 {
+		t.Fatalf("signups don't match: wanted %v but got %v", 1, got)
+	}
+	if got := testutil.ToFloat64(m.lockouts.WithLabelValues(repository.StatusDisabled)); got != 1 {
+		t.Fatalf("lockouts don't match: wanted %v but got %v", 1, got)
+	}
+	// one hash at signup and a compare for each login that reached the password check
+	if n := testutil.CollectAndCount(m.passwordDuration); n != 2 {
+		t.Fatalf("password duration series don't match: wanted %v but got %v", 2, n)
+	}
+}
@@ -0,0 +1,342 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql migrations/sqlite/*.sql
+var migrations embed.FS
+
+// Dialects are the databases with migrations, they share the versions and names of their migrations.
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Migrations returns the embedded migrations of the mimoto schema in dialect.
+func Migrations(dialect string) (fs.FS, error) {
+	if _, err := newDialect(dialect); err != nil {
+		return nil, err
+	}
+	return fs.Sub(migrations, "migrations/"+dialect)
+}
+
+// lockKey is the postgres advisory lock held while migrating, so replicas starting together don't migrate twice.
+const lockKey = 7311985017042
+
+// dialect is the SQL that differs between databases, the migrations themselves are written for each.
+type dialect struct {
+	// lock and unlock serialize migrators, SQLite doesn't need them because its transactions are serialized.
+	lock, unlock     string
+	createMigrations string
+	tableExists      string
+}
+
+func newDialect(name string) (dialect, error) {
+	switch name {
+	case Postgres:
+		return dialect{
+			lock:   fmt.Sprintf("SELECT pg_advisory_lock(%d)", lockKey),
+			unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%d)", lockKey),
+			createMigrations: `CREATE TABLE IF NOT EXISTS schema_migrations (
+				version BIGINT PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at TIMESTAMPTZ NOT NULL
+			)`,
+			tableExists: "SELECT to_regclass('schema_migrations') IS NOT NULL",
+		}, nil
+	case SQLite:
+		return dialect{
+			createMigrations: `CREATE TABLE IF NOT EXISTS schema_migrations (
+				version INTEGER PRIMARY KEY,
+				name TEXT NOT NULL,
+				applied_at DATETIME NOT NULL
+			)`,
+			tableExists: "SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'",
+		}, nil
+	}
+	return dialect{}, fmt.Errorf("unknown migration dialect %q, must be one of: %s, %s", name, Postgres, SQLite)
+}
+
+var ErrNoMigrations = errors.New("no migrations applied")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and when it was applied, AppliedAt is nil for pending migrations.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in fsys ordered by version.
+// Files are named <version>_<name>.up.sql and <version>_<name>.down.sql, the down file is optional.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range names {
+		base, direction, ok := cutDirection(file)
+		if !ok {
+			return nil, fmt.Errorf("migration %s must end in .up.sql or .down.sql", file)
+		}
+		rawVersion, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(rawVersion, 10, 64)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s must start with a positive version and an underscore", file)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", m.Name, name, version)
+		}
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		if direction == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		loaded = append(loaded, *m)
+	}
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Version < loaded[j].Version
+	})
+	return loaded, nil
+}
+
+func cutDirection(file string) (string, string, bool) {
+	file = path.Base(file)
+	if base, ok := strings.CutSuffix(file, ".up.sql"); ok {
+		return base, "up", true
+	}
+	if base, ok := strings.CutSuffix(file, ".down.sql"); ok {
+		return base, "down", true
+	}
+	return "", "", false
+}
+
+// Migrator applies migrations and records them in the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+// New builds a Migrator of the migrations in fsys, written in dialect.
+func New(db *sql.DB, dialectName string, fsys fs.FS) (Migrator, error) {
+	d, err := newDialect(dialectName)
+	if err != nil {
+		return Migrator{}, err
+	}
+	migrations, err := Load(fsys)
+	if err != nil {
+		return Migrator{}, fmt.Errorf("load migrations: %w", err)
+	}
+	return Migrator{
+		db:         db,
+		dialect:    d,
+		migrations: migrations,
+	}, nil
+}
+
+// locked runs fn on a connection holding the migration lock, other migrators wait until it's released.
+func (m Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		// unlock even if ctx was canceled, the connection goes back to the pool still holding it otherwise
+		defer conn.ExecContext(context.WithoutCancel(ctx), m.dialect.unlock)
+	}
+
+	if _, err := conn.ExecContext(ctx, m.dialect.createMigrations); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+func applied(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}) (map[int64]time.Time, error) {
+	rows, err := q.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// run executes the statements of a migration and records it in one transaction,
+// so a failed migration leaves nothing behind. applies is whether it applies or rolls back version,
+// it does nothing and returns false if another migrator already did.
+func run(ctx context.Context, conn *sql.Conn, version int64, applies bool, statements string, record string, args ...interface{}) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = $1", version).Scan(&count); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if (count > 0) == applies {
+		return false, tx.Rollback()
+	}
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// Up applies every pending migration in order and returns the ones it applied.
+func (m Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := make([]Migration, 0)
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			ran, err := run(ctx, conn, migration.Version, true, migration.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)", migration.Version, migration.Name, time.Now())
+			if err != nil {
+				return fmt.Errorf("migrate up %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if ran {
+				done = append(done, migration)
+			}
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back the latest applied migration and returns it.
+func (m Migrator) Down(ctx context.Context) (Migration, error) {
+	var done Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s can't be rolled back, it has no down file", migration.Version, migration.Name)
+			}
+			ran, err := run(ctx, conn, migration.Version, false, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("migrate down %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			if !ran {
+				return ErrNoMigrations
+			}
+			done = migration
+			return nil
+		}
+		return ErrNoMigrations
+	})
+	return done, err
+}
+
+// Status returns every migration and when it was applied.
+func (m Migrator) Status(ctx context.Context) ([]Status, error) {
+	// nothing has been applied before the first migration creates schema_migrations
+	versions := make(map[int64]time.Time)
+	exists, err := m.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		if versions, err = applied(ctx, m.db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := versions[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (m Migrator) tableExists(ctx context.Context) (bool, error) {
+	var exists bool
+	err := m.db.QueryRowContext(ctx, m.dialect.tableExists).Scan(&exists)
+	return exists, err
+}
+
+// Pending returns the migrations that haven't been applied.
+func (m Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]Migration, 0)
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,29 @@
+-- databases created by gorm's AutoMigrate already have the table, so every statement is idempotent
+CREATE TABLE IF NOT EXISTS users (
+    email TEXT PRIMARY KEY
+);
+
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS hashed_password TEXT,
+    ADD COLUMN IF NOT EXISTS name TEXT,
+    ADD COLUMN IF NOT EXISTS refresh_token TEXT,
+    ADD COLUMN IF NOT EXISTS confirmation_code TEXT,
+    ADD COLUMN IF NOT EXISTS confirmation_sent TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS confirmed BOOLEAN,
+    ADD COLUMN IF NOT EXISTS reset_code TEXT,
+    ADD COLUMN IF NOT EXISTS role TEXT,
+    ADD COLUMN IF NOT EXISTS status TEXT,
+    ADD COLUMN IF NOT EXISTS status_reason TEXT,
+    ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS deletion_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS locale TEXT,
+    ADD COLUMN IF NOT EXISTS timezone TEXT,
+    ADD COLUMN IF NOT EXISTS avatar_url TEXT,
+    ADD COLUMN IF NOT EXISTS metadata TEXT,
+    ADD COLUMN IF NOT EXISTS previous_refresh_token TEXT,
+    ADD COLUMN IF NOT EXISTS known_devices TEXT,
+    ADD COLUMN IF NOT EXISTS notification_opt_outs TEXT,
+    ADD COLUMN IF NOT EXISTS session_audience TEXT,
+    ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS session_refreshed_at TIMESTAMPTZ;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    id TEXT PRIMARY KEY,
+    idempotency_key TEXT,
+    kind TEXT,
+    name TEXT,
+    email TEXT,
+    locale TEXT,
+    timezone TEXT,
+    payload TEXT,
+    status TEXT,
+    attempts BIGINT,
+    next_attempt_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ,
+    sent_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_outbox_messages_idempotency_key ON outbox_messages (idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_outbox_due ON outbox_messages (status, next_attempt_at);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id TEXT PRIMARY KEY,
+    time TIMESTAMPTZ,
+    type TEXT,
+    actor TEXT,
+    subject TEXT,
+    ip TEXT,
+    user_agent TEXT,
+    request_id TEXT,
+    outcome TEXT,
+    reason TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_time ON audit_events (time);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (type);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events (actor);
+CREATE INDEX IF NOT EXISTS idx_audit_events_subject ON audit_events (subject);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id TEXT PRIMARY KEY,
+    url TEXT,
+    secret TEXT,
+    events TEXT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    idempotency_key TEXT,
+    subscription_id TEXT,
+    event_id TEXT,
+    event_type TEXT,
+    payload TEXT,
+    status TEXT,
+    attempts BIGINT,
+    response_status BIGINT,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ,
+    replay_of TEXT,
+    created_at TIMESTAMPTZ,
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_idempotency_key ON webhook_deliveries (idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_due ON webhook_deliveries (status, next_attempt_at);
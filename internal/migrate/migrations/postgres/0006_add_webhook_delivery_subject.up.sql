@@ -0,0 +1,6 @@
+ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS subject TEXT;
+
+-- events carry the email of the account they're about
+UPDATE webhook_deliveries SET subject = payload::json->'data'->>'email' WHERE subject IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subject ON webhook_deliveries (subject);
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS refresh_token TEXT,
+    ADD COLUMN IF NOT EXISTS previous_refresh_token TEXT,
+    ADD COLUMN IF NOT EXISTS session_audience TEXT,
+    ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS session_refreshed_at TIMESTAMPTZ;
+
+ALTER TABLE users DROP COLUMN IF EXISTS sessions;
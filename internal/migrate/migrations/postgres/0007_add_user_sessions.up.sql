@@ -0,0 +1,20 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS sessions TEXT;
+
+-- users had one session, sessions from before audiences were tracked are kept under the empty audience
+UPDATE users SET sessions = json_build_object(
+    COALESCE(session_audience, ''),
+    json_build_object(
+        'refreshToken', refresh_token,
+        'previousRefreshToken', COALESCE(previous_refresh_token, ''),
+        'startedAt', session_started_at,
+        'refreshedAt', session_refreshed_at
+    )
+)::text
+WHERE sessions IS NULL AND refresh_token <> '';
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS refresh_token,
+    DROP COLUMN IF EXISTS previous_refresh_token,
+    DROP COLUMN IF EXISTS session_audience,
+    DROP COLUMN IF EXISTS session_started_at,
+    DROP COLUMN IF EXISTS session_refreshed_at;
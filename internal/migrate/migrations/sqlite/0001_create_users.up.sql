@@ -0,0 +1,26 @@
+CREATE TABLE users (
+    email TEXT PRIMARY KEY,
+    hashed_password TEXT,
+    name TEXT,
+    refresh_token TEXT,
+    confirmation_code TEXT,
+    confirmation_sent DATETIME,
+    confirmed BOOLEAN,
+    reset_code TEXT,
+    role TEXT,
+    status TEXT,
+    status_reason TEXT,
+    status_changed_at DATETIME,
+    suspended_until DATETIME,
+    deletion_at DATETIME,
+    locale TEXT,
+    timezone TEXT,
+    avatar_url TEXT,
+    metadata TEXT,
+    previous_refresh_token TEXT,
+    known_devices TEXT,
+    notification_opt_outs TEXT,
+    session_audience TEXT,
+    session_started_at DATETIME,
+    session_refreshed_at DATETIME
+);
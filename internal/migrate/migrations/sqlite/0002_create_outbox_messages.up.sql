@@ -0,0 +1,19 @@
+CREATE TABLE outbox_messages (
+    id TEXT PRIMARY KEY,
+    idempotency_key TEXT,
+    kind TEXT,
+    name TEXT,
+    email TEXT,
+    locale TEXT,
+    timezone TEXT,
+    payload TEXT,
+    status TEXT,
+    attempts INTEGER,
+    next_attempt_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME,
+    sent_at DATETIME
+);
+
+CREATE UNIQUE INDEX idx_outbox_messages_idempotency_key ON outbox_messages (idempotency_key);
+CREATE INDEX idx_outbox_due ON outbox_messages (status, next_attempt_at);
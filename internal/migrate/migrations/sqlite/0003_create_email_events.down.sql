@@ -0,0 +1,2 @@
+DROP TABLE suppressions;
+DROP TABLE email_events;
@@ -0,0 +1,19 @@
+CREATE TABLE email_events (
+    id TEXT PRIMARY KEY,
+    email TEXT,
+    type TEXT,
+    reason TEXT,
+    provider TEXT,
+    provider_event_id TEXT,
+    occurred_at DATETIME,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_email_events_email ON email_events (email);
+CREATE UNIQUE INDEX idx_email_events_provider_event_id ON email_events (provider_event_id);
+
+CREATE TABLE suppressions (
+    email TEXT PRIMARY KEY,
+    reason TEXT,
+    created_at DATETIME
+);
@@ -0,0 +1,28 @@
+CREATE TABLE webhook_subscriptions (
+    id TEXT PRIMARY KEY,
+    url TEXT,
+    secret TEXT,
+    events TEXT,
+    created_at DATETIME
+);
+
+CREATE TABLE webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    idempotency_key TEXT,
+    subscription_id TEXT,
+    event_id TEXT,
+    event_type TEXT,
+    payload TEXT,
+    status TEXT,
+    attempts INTEGER,
+    response_status INTEGER,
+    last_error TEXT,
+    next_attempt_at DATETIME,
+    replay_of TEXT,
+    created_at DATETIME,
+    delivered_at DATETIME
+);
+
+CREATE UNIQUE INDEX idx_webhook_deliveries_idempotency_key ON webhook_deliveries (idempotency_key);
+CREATE INDEX idx_webhook_deliveries_subscription_id ON webhook_deliveries (subscription_id);
+CREATE INDEX idx_webhook_due ON webhook_deliveries (status, next_attempt_at);
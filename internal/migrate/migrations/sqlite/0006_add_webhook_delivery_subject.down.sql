@@ -0,0 +1,2 @@
+DROP INDEX idx_webhook_deliveries_subject;
+ALTER TABLE webhook_deliveries DROP COLUMN subject;
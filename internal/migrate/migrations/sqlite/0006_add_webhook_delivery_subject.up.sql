@@ -0,0 +1,6 @@
+ALTER TABLE webhook_deliveries ADD COLUMN subject TEXT;
+
+-- events carry the email of the account they're about
+UPDATE webhook_deliveries SET subject = json_extract(payload, '$.data.email') WHERE subject IS NULL;
+
+CREATE INDEX idx_webhook_deliveries_subject ON webhook_deliveries (subject);
@@ -0,0 +1,7 @@
+ALTER TABLE users ADD COLUMN refresh_token TEXT;
+ALTER TABLE users ADD COLUMN previous_refresh_token TEXT;
+ALTER TABLE users ADD COLUMN session_audience TEXT;
+ALTER TABLE users ADD COLUMN session_started_at DATETIME;
+ALTER TABLE users ADD COLUMN session_refreshed_at DATETIME;
+
+ALTER TABLE users DROP COLUMN sessions;
@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN sessions TEXT;
+
+-- users had one session, sessions from before audiences were tracked are kept under the empty audience
+UPDATE users SET sessions = json_object(
+    COALESCE(session_audience, ''),
+    json_object(
+        'refreshToken', refresh_token,
+        'previousRefreshToken', COALESCE(previous_refresh_token, ''),
+        'startedAt', replace(session_started_at, ' ', 'T'),
+        'refreshedAt', replace(session_refreshed_at, ' ', 'T')
+    )
+)
+WHERE sessions IS NULL AND refresh_token <> '';
+
+ALTER TABLE users DROP COLUMN refresh_token;
+ALTER TABLE users DROP COLUMN previous_refresh_token;
+ALTER TABLE users DROP COLUMN session_audience;
+ALTER TABLE users DROP COLUMN session_started_at;
+ALTER TABLE users DROP COLUMN session_refreshed_at;
@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN token_generation INTEGER NOT NULL DEFAULT 0;
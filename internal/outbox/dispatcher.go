@@ -0,0 +1,182 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
+)
+
+type Options struct {
+	// BatchSize is the most messages claimed by each dispatch.
+	BatchSize int
+	// MaxAttempts is the number of failed deliveries before a message is dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is doubled after every failed delivery, up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed message is hidden from other dispatchers.
+	Lease time.Duration
+}
+
+var DefaultOptions = Options{
+	BatchSize:   50,
+	MaxAttempts: 8,
+	BaseBackoff: 30 * time.Second,
+	MaxBackoff:  time.Hour,
+	Lease:       5 * time.Minute,
+}
+
+type Stats struct {
+	Sent         uint64
+	Retried      uint64
+	DeadLettered uint64
+}
+
+type counters struct {
+	sent         uint64
+	retried      uint64
+	deadLettered uint64
+}
+
+// Dispatcher delivers the outbox messages written by the user service,
+// emails are sent and webhook events are published to their subscriptions.
+type Dispatcher struct {
+	repository     repository.OutboxRepository
+	emailService   email.EmailService
+	webhookService webhook.WebhookService
+	options        Options
+	counters       *counters
+}
+
+func New(outboxRepository repository.OutboxRepository, emailService email.EmailService, webhookService webhook.WebhookService, options Options) (Dispatcher, error) {
+	if options.BatchSize < 1 || options.MaxAttempts < 1 || options.BaseBackoff <= 0 || options.MaxBackoff < options.BaseBackoff || options.Lease <= 0 {
+		return Dispatcher{}, fmt.Errorf("invalid outbox options: %+v", options)
+	}
+	return Dispatcher{
+		repository:     outboxRepository,
+		emailService:   emailService,
+		webhookService: webhookService,
+		options:        options,
+		counters:       &counters{},
+	}, nil
+}
+
+// DispatchOnce delivers the messages due at now and returns how many were claimed.
+// It stops when ctx is done, leaving the undelivered messages for the next dispatch.
+func (d Dispatcher) DispatchOnce(ctx context.Context, now time.Time) (int, error) {
+	messages, err := d.repository.ClaimOutbox(ctx, now, d.options.Lease, d.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		err := d.deliver(ctx, msg)
+		// interrupted messages are claimed again once their lease expires, without using up an attempt
+		if ctx.Err() != nil {
+			return len(messages), ctx.Err()
+		}
+		msg.Attempts++
+		if err != nil {
+			msg.LastError = err.Error()
+			// retrying won't help permanent provider errors or suppressed recipients
+			if msg.Attempts >= d.options.MaxAttempts || errors.Is(err, email.ErrPermanent) || errors.Is(err, email.ErrSuppressed) {
+				msg.Status = repository.OutboxDead
+				atomic.AddUint64(&d.counters.deadLettered, 1)
+			} else {
+				msg.NextAttemptAt = now.Add(d.backoff(msg.Attempts))
+				atomic.AddUint64(&d.counters.retried, 1)
+			}
+		} else {
+			sentAt := now
+			msg.Status = repository.OutboxSent
+			msg.SentAt = &sentAt
+			msg.LastError = ""
+			atomic.AddUint64(&d.counters.sent, 1)
+		}
+
+		// the message is gone if its user was erased during the delivery
+		if err := d.repository.SaveOutbox(ctx, &msg); err != nil && !errors.Is(err, repository.ErrOutboxMessageNotFound) {
+			return len(messages), err
+		}
+	}
+	return len(messages), nil
+}
+
+// backoff returns the delay before the next delivery after attempts failed deliveries.
+func (d Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.options.BaseBackoff
+	for i := 1; i < attempts && delay < d.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.options.MaxBackoff {
+		delay = d.options.MaxBackoff
+	}
+	return delay
+}
+
+func (d Dispatcher) deliver(ctx context.Context, msg repository.OutboxMessage) error {
+	payload := make(map[string]string)
+	if msg.Payload != "" {
+		if err := json.Unmarshal([]byte(msg.Payload), &payload); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+	}
+
+	if webhook.IsEvent(msg.Kind) {
+		data := map[string]string{"email": msg.Email}
+		for key, value := range payload {
+			data[key] = value
+		}
+		return d.webhookService.Publish(ctx, webhook.Event{
+			ID:        msg.ID,
+			Type:      msg.Kind,
+			CreatedAt: msg.CreatedAt,
+			Data:      data,
+			Subject:   msg.Email,
+		})
+	}
+
+	to := email.Recipient{
+		Name:     msg.Name,
+		Email:    msg.Email,
+		Locale:   msg.Locale,
+		Timezone: msg.Timezone,
+	}
+
+	if email.IsSecurityKind(msg.Kind) {
+		activityTime, err := time.Parse(time.RFC3339, payload["time"])
+		if err != nil {
+			return fmt.Errorf("decode payload time: %w", err)
+		}
+		return d.emailService.SendSecurityNotification(ctx, to, msg.Kind, email.Activity{
+			Time:      activityTime,
+			IP:        payload["ip"],
+			UserAgent: payload["userAgent"],
+		})
+	}
+
+	switch msg.Kind {
+	case email.KindConfirmation:
+		return d.emailService.SendConfirmation(ctx, to, payload["code"])
+	case email.KindConfirmationSuccess:
+		return d.emailService.SendConfirmationSuccess(ctx, to)
+	case email.KindReset:
+		return d.emailService.SendReset(ctx, to, payload["code"])
+	}
+	return fmt.Errorf("unknown outbox message kind: %s", msg.Kind)
+}
+
+func (d Dispatcher) Stats() Stats {
+	return Stats{
+		Sent:         atomic.LoadUint64(&d.counters.sent),
+		Retried:      atomic.LoadUint64(&d.counters.retried),
+		DeadLettered: atomic.LoadUint64(&d.counters.deadLettered),
+	}
+}
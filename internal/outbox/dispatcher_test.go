@@ -0,0 +1,280 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
+)
+
+// flakyEmailService fails the first failures sends with err, or a temporary error if it's nil.
+// It calls cancel, if it's set, before sending.
+type flakyEmailService struct {
+	failures int
+	err      error
+	sent     *[]string
+	cancel   context.CancelFunc
+}
+
+func (f *flakyEmailService) send(kind string, to email.Recipient) error {
+	if f.cancel != nil {
+		f.cancel()
+		return context.Canceled
+	}
+	if f.failures > 0 {
+		f.failures--
+		if f.err != nil {
+			return f.err
+		}
+		return errors.New("provider unavailable")
+	}
+	*f.sent = append(*f.sent, kind+":"+to.Email)
+	return nil
+}
+
+func (f *flakyEmailService) SendConfirmation(ctx context.Context, to email.Recipient, code string) error {
+	return f.send(email.KindConfirmation, to)
+}
+
+func (f *flakyEmailService) SendConfirmationSuccess(ctx context.Context, to email.Recipient) error {
+	return f.send(email.KindConfirmationSuccess, to)
+}
+
+func (f *flakyEmailService) SendReset(ctx context.Context, to email.Recipient, code string) error {
+	return f.send(email.KindReset, to)
+}
+
+func (f *flakyEmailService) SendSecurityNotification(ctx context.Context, to email.Recipient, kind string, activity email.Activity) error {
+	if activity.Time.IsZero() {
+		return errors.New("missing activity time")
+	}
+	return f.send(kind, to)
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	sent := make([]string, 0)
+	es := &flakyEmailService{failures: 2, sent: &sent}
+	d, err := New(mr, es, nil, Options{
+		BatchSize:   10,
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		Lease:       time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	user := repository.User{Email: "test@test.com"}
+	err = mr.Create(ctx, &user, repository.OutboxMessage{Kind: email.KindConfirmation, Email: user.Email, Payload: `{"code":"12345"}`})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	now := time.Now()
+	for i, wait := range []time.Duration{0, time.Second, 2 * time.Second} {
+		now = now.Add(wait)
+		claimed, err := d.DispatchOnce(ctx, now)
+		if err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+		if claimed != 1 {
+			t.Fatalf("attempt %d: wanted %v claimed but got %v", i+1, 1, claimed)
+		}
+	}
+
+	if len(sent) != 1 || sent[0] != "confirmation:test@test.com" {
+		t.Fatalf("unexpected sent emails: %v", sent)
+	}
+	stats := d.Stats()
+	if stats.Sent != 1 || stats.Retried != 2 || stats.DeadLettered != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	for _, msg := range mr.OutboxMessages() {
+		if msg.Status != repository.OutboxSent || msg.Attempts != 3 || msg.SentAt == nil {
+			t.Fatalf("unexpected outbox message: %+v", msg)
+		}
+	}
+}
+
+func TestDispatcherDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	sent := make([]string, 0)
+	es := &flakyEmailService{failures: 10, sent: &sent}
+	d, err := New(mr, es, nil, Options{
+		BatchSize:   10,
+		MaxAttempts: 2,
+		BaseBackoff: time.Second,
+		MaxBackoff:  time.Minute,
+		Lease:       time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	user := repository.User{Email: "test@test.com"}
+	mr.Create(ctx, &user,
+		repository.OutboxMessage{Kind: email.KindReset, Email: user.Email},
+		repository.OutboxMessage{Kind: "unknown", Email: user.Email},
+	)
+
+	now := time.Now()
+	d.DispatchOnce(ctx, now)
+	d.DispatchOnce(ctx, now.Add(time.Second))
+
+	for _, msg := range mr.OutboxMessages() {
+		if msg.Status != repository.OutboxDead || msg.LastError == "" {
+			t.Fatalf("message wasn't dead-lettered: %+v", msg)
+		}
+	}
+	if stats := d.Stats(); stats.DeadLettered != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	claimed, _ := d.DispatchOnce(ctx, now.Add(time.Hour))
+	if claimed != 0 {
+		t.Fatalf("dead messages were claimed")
+	}
+}
+
+func TestDispatcherPermanentError(t *testing.T) {
+	ctx := context.Background()
+	for _, failure := range []error{
+		&email.ProviderError{Provider: "sendgrid", StatusCode: 400, Permanent: true},
+		email.ErrSuppressed,
+	} {
+		mr, _ := repository.NewMap()
+		sent := make([]string, 0)
+		es := &flakyEmailService{failures: 1, err: failure, sent: &sent}
+		d, err := New(mr, es, nil, DefaultOptions)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+
+		user := repository.User{Email: "test@test.com"}
+		mr.Create(ctx, &user, repository.OutboxMessage{Kind: email.KindReset, Email: user.Email})
+		d.DispatchOnce(ctx, time.Now())
+
+		for _, msg := range mr.OutboxMessages() {
+			if msg.Status != repository.OutboxDead || msg.Attempts != 1 {
+				t.Fatalf("%v: message wasn't dead-lettered on the first attempt: %+v", failure, msg)
+			}
+		}
+	}
+}
+
+func TestDispatcherSecurityNotification(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	sent := make([]string, 0)
+	es := &flakyEmailService{sent: &sent}
+	d, err := New(mr, es, nil, DefaultOptions)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	user := repository.User{Email: "test@test.com"}
+	mr.Create(ctx, &user, repository.OutboxMessage{
+		Kind:    email.KindPasswordChanged,
+		Email:   user.Email,
+		Payload: `{"time":"2021-09-01T16:00:00Z","ip":"203.0.113.1","userAgent":"laptop"}`,
+	})
+	d.DispatchOnce(ctx, time.Now())
+
+	if len(sent) != 1 || sent[0] != "password_changed:test@test.com" {
+		t.Fatalf("unexpected sent emails: %v", sent)
+	}
+}
+
+func TestDispatcherCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mr, _ := repository.NewMap()
+	sent := make([]string, 0)
+	es := &flakyEmailService{sent: &sent, cancel: cancel}
+	d, err := New(mr, es, nil, DefaultOptions)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	user := repository.User{Email: "test@test.com"}
+	mr.Create(ctx, &user,
+		repository.OutboxMessage{Kind: email.KindReset, Email: user.Email},
+		repository.OutboxMessage{Kind: email.KindReset, Email: user.Email},
+	)
+	claimed, err := d.DispatchOnce(ctx, time.Now())
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("DispatchOnce error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+	if claimed != 2 {
+		t.Fatalf("claimed messages don't match: wanted %v but got %v", 2, claimed)
+	}
+	// interrupted messages stay pending and are claimed again once their lease expires
+	for _, msg := range mr.OutboxMessages() {
+		if msg.Status != repository.OutboxPending || msg.Attempts != 0 {
+			t.Fatalf("interrupted message was updated: %+v", msg)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d, _ := New(nil, nil, nil, Options{BatchSize: 1, MaxAttempts: 1, BaseBackoff: time.Second, MaxBackoff: 5 * time.Second, Lease: time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := d.backoff(attempts); got != want {
+			t.Fatalf("backoff(%d): wanted %v but got %v", attempts, want, got)
+		}
+	}
+}
+
+func TestDispatcherWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	ws, _ := webhook.New(mr)
+	sub, err := ws.CreateSubscription(ctx, "https://example.com/hook", []string{webhook.EventUserCreated})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	sent := make([]string, 0)
+	d, _ := New(mr, &flakyEmailService{sent: &sent}, ws, DefaultOptions)
+
+	user := repository.User{Email: "test@test.com"}
+	err = mr.Create(ctx, &user,
+		repository.OutboxMessage{Kind: webhook.EventUserCreated, Email: user.Email},
+		repository.OutboxMessage{Kind: webhook.EventUserDeleted, Email: user.Email},
+	)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := d.DispatchOnce(ctx, time.Now()); err != nil {
+		t.Fatalf("DispatchOnce: %v", err)
+	}
+
+	if len(sent) != 0 {
+		t.Fatalf("webhook events were emailed: %v", sent)
+	}
+	// only the event the subscription asked for is delivered
+	deliveries, _, _ := mr.ListWebhookDeliveries(ctx, sub.ID, 0, 10)
+	if len(deliveries) != 1 || deliveries[0].EventType != webhook.EventUserCreated {
+		t.Fatalf("deliveries don't match: got %+v", deliveries)
+	}
+	var event webhook.Event
+	if err := json.Unmarshal([]byte(deliveries[0].Payload), &event); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if event.Data["email"] != user.Email {
+		t.Fatalf("event email doesn't match: wanted %v but got %v", user.Email, event.Data["email"])
+	}
+	for _, msg := range mr.OutboxMessages() {
+		if msg.Status != repository.OutboxSent {
+			t.Fatalf("%s status doesn't match: wanted %v but got %v", msg.Kind, repository.OutboxSent, msg.Status)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm/clause"
+)
+
+// EmailEvent is a delivery event reported by an email provider webhook.
+type EmailEvent struct {
+	ID    string `json:"id" gorm:"primaryKey"`
+	Email string `json:"email" gorm:"index"`
+	Type  string `json:"type"`
+	// Reason is the provider's explanation of a bounce or drop.
+	Reason   string `json:"reason,omitempty"`
+	Provider string `json:"provider"`
+	// ProviderEventID makes recording the same webhook delivery more than once a no-op.
+	ProviderEventID string    `json:"providerEventId" gorm:"uniqueIndex"`
+	OccurredAt      time.Time `json:"occurredAt"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// Suppression stops any more emails being sent to an address.
+type Suppression struct {
+	Email     string    `json:"email" gorm:"primaryKey"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type EmailEventRepository interface {
+	CreateEmailEvent(ctx context.Context, event *EmailEvent) error
+	// ListEmailEvents returns the events for email, newest first.
+	ListEmailEvents(ctx context.Context, email string) ([]EmailEvent, error)
+	Suppress(ctx context.Context, email, reason string) error
+	Unsuppress(ctx context.Context, email string) error
+	IsSuppressed(ctx context.Context, email string) (bool, error)
+}
+
+func prepareEmailEvent(event *EmailEvent, now time.Time) {
+	if event.ID == "" {
+		id, _ := uuid.NewV4()
+		event.ID = id.String()
+	}
+	if event.ProviderEventID == "" {
+		event.ProviderEventID = event.ID
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = now
+	}
+}
+
+func sortEmailEvents(events []EmailEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].OccurredAt.After(events[j].OccurredAt)
+	})
+}
+
+func (mr MapRepository) CreateEmailEvent(ctx context.Context, event *EmailEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	prepareEmailEvent(event, time.Now())
+	for _, existing := range mr.data.EmailEvents {
+		if existing.ProviderEventID == event.ProviderEventID {
+			return nil
+		}
+	}
+	mr.data.EmailEvents[event.ID] = *event
+	return nil
+}
+
+func (mr MapRepository) ListEmailEvents(ctx context.Context, email string) ([]EmailEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	events := make([]EmailEvent, 0)
+	for _, event := range mr.data.EmailEvents {
+		if event.Email == email {
+			events = append(events, event)
+		}
+	}
+	sortEmailEvents(events)
+	return events, nil
+}
+
+func (mr MapRepository) Suppress(ctx context.Context, email, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.Suppressions[email]; ok {
+		return nil
+	}
+	mr.data.Suppressions[email] = Suppression{Email: email, Reason: reason, CreatedAt: time.Now()}
+	return nil
+}
+
+func (mr MapRepository) Unsuppress(ctx context.Context, email string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	delete(mr.data.Suppressions, email)
+	return nil
+}
+
+func (mr MapRepository) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	_, ok := mr.data.Suppressions[email]
+	return ok, nil
+}
+
+func (r SQLRepository) CreateEmailEvent(ctx context.Context, event *EmailEvent) error {
+	prepareEmailEvent(event, time.Now())
+	tx := r.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "provider_event_id"}},
+		DoNothing: true,
+	}).Create(event)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r SQLRepository) ListEmailEvents(ctx context.Context, email string) ([]EmailEvent, error) {
+	events := make([]EmailEvent, 0)
+	tx := r.DB.WithContext(ctx).Where("email = ?", email).Order("occurred_at DESC").Find(&events)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return events, nil
+}
+
+func (r SQLRepository) Suppress(ctx context.Context, email, reason string) error {
+	tx := r.DB.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&Suppression{Email: email, Reason: reason, CreatedAt: time.Now()})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r SQLRepository) Unsuppress(ctx context.Context, email string) error {
+	tx := r.DB.WithContext(ctx).Delete(&Suppression{Email: email})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	return nil
+}
+
+func (r SQLRepository) IsSuppressed(ctx context.Context, email string) (bool, error) {
+	var count int64
+	tx := r.DB.WithContext(ctx).Model(&Suppression{}).Where("email = ?", email).Count(&count)
+	if tx.Error != nil {
+		return false, tx.Error
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEmailEvents(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, mr Repository) {
+		ctx := context.Background()
+
+		now := time.Now()
+		events := []EmailEvent{
+			{Email: "test@test.com", Type: "delivered", ProviderEventID: "1", OccurredAt: now.Add(-time.Minute)},
+			{Email: "test@test.com", Type: "bounce", ProviderEventID: "2", OccurredAt: now},
+			// duplicate webhook delivery
+			{Email: "test@test.com", Type: "bounce", ProviderEventID: "2", OccurredAt: now},
+			{Email: "other@test.com", Type: "delivered", ProviderEventID: "3", OccurredAt: now},
+		}
+		for i := range events {
+			err := mr.CreateEmailEvent(ctx, &events[i])
+			if err != nil {
+				t.Fatalf("CreateEmailEvent: %v", err)
+			}
+		}
+
+		listed, err := mr.ListEmailEvents(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("ListEmailEvents: %v", err)
+		}
+		if len(listed) != 2 {
+			t.Fatalf("ListEmailEvents: wanted %v events but got %v", 2, len(listed))
+		}
+		if listed[0].Type != "bounce" {
+			t.Fatalf("newest event doesn't match: wanted %v but got %v", "bounce", listed[0].Type)
+		}
+
+		err = mr.Suppress(ctx, "test@test.com", "bounce")
+		if err != nil {
+			t.Fatalf("Suppress: %v", err)
+		}
+		suppressed, err := mr.IsSuppressed(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("IsSuppressed: %v", err)
+		}
+		if !suppressed {
+			t.Fatalf("suppressed doesn't match: wanted %v but got %v", true, suppressed)
+		}
+
+		err = mr.Unsuppress(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("Unsuppress: %v", err)
+		}
+		suppressed, err = mr.IsSuppressed(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("IsSuppressed: %v", err)
+		}
+		if suppressed {
+			t.Fatalf("suppressed doesn't match: wanted %v but got %v", false, suppressed)
+		}
+
+		// deleting a user deletes their events
+		user := User{Email: "test@test.com"}
+		mr.Create(ctx, &user)
+		err = mr.Delete(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		listed, err = mr.ListEmailEvents(ctx, user.Email)
+		if err != nil {
+			t.Fatalf("ListEmailEvents: %v", err)
+		}
+		if len(listed) != 0 {
+			t.Fatalf("ListEmailEvents: wanted %v events but got %v", 0, len(listed))
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrOutboxMessageNotFound = errors.New("outbox message not found")
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage is an email to deliver, written in the same transaction as the user change that caused it.
+type OutboxMessage struct {
+	ID string `json:"id" gorm:"primaryKey"`
+	// IdempotencyKey makes enqueueing the same email more than once a no-op.
+	IdempotencyKey string     `json:"idempotencyKey" gorm:"uniqueIndex"`
+	Kind           string     `json:"kind"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	Locale         string     `json:"locale"`
+	Timezone       string     `json:"timezone"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status" gorm:"index:idx_outbox_due"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"nextAttemptAt" gorm:"index:idx_outbox_due"`
+	LastError      string     `json:"lastError"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	SentAt         *time.Time `json:"sentAt"`
+}
+
+type OutboxRepository interface {
+	// ClaimOutbox returns up to limit pending messages due at now,
+	// and delays them by lease so concurrent dispatchers don't claim them too.
+	ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error)
+	// SaveOutbox updates a claimed message, it fails with ErrOutboxMessageNotFound if the message was erased since.
+	SaveOutbox(ctx context.Context, msg *OutboxMessage) error
+}
+
+func prepareOutbox(msg *OutboxMessage, now time.Time) {
+	if msg.ID == "" {
+		id, _ := uuid.NewV4()
+		msg.ID = id.String()
+	}
+	if msg.IdempotencyKey == "" {
+		msg.IdempotencyKey = msg.ID
+	}
+	if msg.Status == "" {
+		msg.Status = OutboxPending
+	}
+	if msg.NextAttemptAt.IsZero() {
+		msg.NextAttemptAt = now
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = now
+	}
+}
+
+func (m OutboxMessage) clone() OutboxMessage {
+	m.SentAt = cloneTime(m.SentAt)
+	return m
+}
+
+// OutboxMessages returns every queued message, sent ones too, oldest first.
+func (mr MapRepository) OutboxMessages() []OutboxMessage {
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	messages := make([]OutboxMessage, 0, len(mr.data.Outbox))
+	for _, msg := range mr.data.Outbox {
+		messages = append(messages, msg.clone())
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+	return messages
+}
+
+func (mr MapRepository) ListOutboxMessages(ctx context.Context, email string) ([]OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	messages := make([]OutboxMessage, 0)
+	for _, msg := range mr.data.Outbox {
+		if msg.Email == email {
+			messages = append(messages, msg.clone())
+		}
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.After(messages[j].CreatedAt)
+	})
+	return messages, nil
+}
+
+// enqueue adds the outbox messages that aren't queued yet, the caller holds the lock.
+func (mr MapRepository) enqueue(outbox []OutboxMessage) {
+	for _, msg := range outbox {
+		prepareOutbox(&msg, time.Now())
+		duplicate := false
+		for _, existing := range mr.data.Outbox {
+			if existing.IdempotencyKey == msg.IdempotencyKey {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			mr.data.Outbox[msg.ID] = msg.clone()
+		}
+	}
+}
+
+func (mr MapRepository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	due := make([]OutboxMessage, 0)
+	for _, msg := range mr.data.Outbox {
+		if msg.Status == OutboxPending && !msg.NextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for i, msg := range due {
+		msg.NextAttemptAt = now.Add(lease)
+		mr.data.Outbox[msg.ID] = msg
+		due[i] = msg.clone()
+	}
+	return due, nil
+}
+
+func (mr MapRepository) SaveOutbox(ctx context.Context, msg *OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.Outbox[msg.ID]; !ok {
+		return ErrOutboxMessageNotFound
+	}
+	mr.data.Outbox[msg.ID] = msg.clone()
+	return nil
+}
+
+func enqueue(tx *gorm.DB, outbox []OutboxMessage) error {
+	for _, msg := range outbox {
+		prepareOutbox(&msg, time.Now())
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "idempotency_key"}},
+			DoNothing: true,
+		}).Create(&msg)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+func (r SQLRepository) ListOutboxMessages(ctx context.Context, email string) ([]OutboxMessage, error) {
+	messages := make([]OutboxMessage, 0)
+	tx := r.DB.WithContext(ctx).Where("email = ?", email).Order("created_at DESC").Find(&messages)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return messages, nil
+}
+
+func (r SQLRepository) ClaimOutbox(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]OutboxMessage, error) {
+	due := make([]OutboxMessage, 0)
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&due)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		ids := make([]string, 0, len(due))
+		for _, msg := range due {
+			ids = append(ids, msg.ID)
+		}
+		return tx.Model(&OutboxMessage{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// SaveOutbox updates every column of the message, unlike gorm's Save it never inserts,
+// so messages erased with their user stay erased.
+func (r SQLRepository) SaveOutbox(ctx context.Context, msg *OutboxMessage) error {
+	tx := r.DB.WithContext(ctx).Select("*").Updates(msg)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, mr Repository) {
+		ctx := context.Background()
+
+		user := User{Email: "test@test.com"}
+		msg := OutboxMessage{IdempotencyKey: "confirmation:1", Kind: "confirmation", Email: user.Email}
+		err := mr.Create(ctx, &user, msg)
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// enqueueing the same idempotency key again is a no-op
+		err = mr.Save(ctx, &user, msg)
+		if err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		now := time.Now()
+		claimed, err := mr.ClaimOutbox(ctx, now, time.Minute, 10)
+		if err != nil {
+			t.Fatalf("ClaimOutbox: %v", err)
+		}
+		if len(claimed) != 1 || claimed[0].Status != OutboxPending {
+			t.Fatalf("ClaimOutbox: unexpected messages %+v", claimed)
+		}
+
+		// claimed messages are leased
+		claimed, err = mr.ClaimOutbox(ctx, now, time.Minute, 10)
+		if err != nil {
+			t.Fatalf("ClaimOutbox: %v", err)
+		}
+		if len(claimed) != 0 {
+			t.Fatalf("ClaimOutbox: wanted %v messages but got %v", 0, len(claimed))
+		}
+
+		claimed, err = mr.ClaimOutbox(ctx, now.Add(time.Minute), time.Minute, 10)
+		if err != nil {
+			t.Fatalf("ClaimOutbox: %v", err)
+		}
+		if len(claimed) != 1 {
+			t.Fatalf("ClaimOutbox: wanted %v messages but got %v", 1, len(claimed))
+		}
+
+		claimed[0].Status = OutboxSent
+		err = mr.SaveOutbox(ctx, &claimed[0])
+		if err != nil {
+			t.Fatalf("SaveOutbox: %v", err)
+		}
+		claimed, _ = mr.ClaimOutbox(ctx, now.Add(time.Hour), time.Minute, 10)
+		if len(claimed) != 0 {
+			t.Fatalf("ClaimOutbox: sent messages were claimed")
+		}
+	})
+}
+
+func TestDeleteErasesUserData(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, mr Repository) {
+		ctx := context.Background()
+
+		for _, email := range []string{"test@test.com", "other@test.com"} {
+			err := mr.Create(ctx, &User{Email: email}, OutboxMessage{Kind: "confirmation", Email: email})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			err = mr.CreateWebhookDeliveries(ctx, []WebhookDelivery{{SubscriptionID: "sub", EventType: "user.created", Subject: email}})
+			if err != nil {
+				t.Fatalf("CreateWebhookDeliveries: %v", err)
+			}
+		}
+
+		messages, err := mr.ListOutboxMessages(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("ListOutboxMessages: %v", err)
+		}
+		if len(messages) != 1 || messages[0].Kind != "confirmation" {
+			t.Fatalf("ListOutboxMessages: unexpected messages %+v", messages)
+		}
+		claimed := messages[0]
+		deliveries, err := mr.ListUserWebhookDeliveries(ctx, "test@test.com")
+		if err != nil {
+			t.Fatalf("ListUserWebhookDeliveries: %v", err)
+		}
+		if len(deliveries) != 1 || deliveries[0].Subject != "test@test.com" {
+			t.Fatalf("ListUserWebhookDeliveries: unexpected deliveries %+v", deliveries)
+		}
+
+		err = mr.Delete(ctx, "test@test.com", OutboxMessage{Kind: "user.deleted", Email: "test@test.com"})
+		if err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		// only the messages written by the delete are left
+		messages, _ = mr.ListOutboxMessages(ctx, "test@test.com")
+		if len(messages) != 1 || messages[0].Kind != "user.deleted" {
+			t.Fatalf("outbox wasn't erased: %+v", messages)
+		}
+		// dispatchers finishing a delivery don't bring erased data back
+		if err := mr.SaveOutbox(ctx, &claimed); !errors.Is(err, ErrOutboxMessageNotFound) {
+			t.Fatalf("SaveOutbox error doesn't match: wanted %v but got %v", ErrOutboxMessageNotFound, err)
+		}
+		if err := mr.SaveWebhookDelivery(ctx, &deliveries[0]); !errors.Is(err, ErrWebhookDeliveryNotFound) {
+			t.Fatalf("SaveWebhookDelivery error doesn't match: wanted %v but got %v", ErrWebhookDeliveryNotFound, err)
+		}
+		messages, _ = mr.ListOutboxMessages(ctx, "test@test.com")
+		if len(messages) != 1 {
+			t.Fatalf("outbox message was resurrected: %+v", messages)
+		}
+		deliveries, _ = mr.ListUserWebhookDeliveries(ctx, "test@test.com")
+		if len(deliveries) != 0 {
+			t.Fatalf("webhook deliveries weren't erased: %+v", deliveries)
+		}
+
+		messages, _ = mr.ListOutboxMessages(ctx, "other@test.com")
+		deliveries, _ = mr.ListUserWebhookDeliveries(ctx, "other@test.com")
+		if len(messages) != 1 || len(deliveries) != 1 {
+			t.Fatalf("other user's data was erased: %+v %+v", messages, deliveries)
+		}
+	})
+}
@@ -1,10 +1,21 @@
 package repository
 
 import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/migrate"
+	"github.com/glebarez/sqlite"
+	"github.com/jackc/pgconn"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -12,83 +23,492 @@ import (
 var (
 	ErrUserNotFound      = errors.New("user not found")
 	ErrUserAlreadyExists = errors.New("user already exists")
+	ErrSchemaOutdated    = errors.New("database schema is outdated")
+)
+
+const (
+	RoleUser  = ""
+	RoleAdmin = "admin"
+)
+
+const (
+	StatusActive          = "active"
+	StatusSuspended       = "suspended"
+	StatusDisabled        = "disabled"
+	StatusPendingDeletion = "pending-deletion"
 )
 
 type User struct {
-	Email            string `json:"email" gorm:"primaryKey"`
-	Password         string `json:"-" gorm:"-"`
-	HashedPassword   string `json:"-"`
-	Name             string `json:"name"`
-	RefreshToken     string `json:"refreshToken"`
-	ConfirmationCode string `json:"confirmationCode"`
-	Confirmed        bool   `json:"confirmed"`
-	ResetCode        string `json:"ResetCode"`
+	Email            string     `json:"email" gorm:"primaryKey"`
+	Password         string     `json:"-" gorm:"-"`
+	HashedPassword   string     `json:"-"`
+	Name             string     `json:"name"`
+	ConfirmationCode string     `json:"-"`
+	ConfirmationSent time.Time  `json:"-"`
+	Confirmed        bool       `json:"confirmed"`
+	ResetCode        string     `json:"-"`
+	Role             string     `json:"role"`
+	Status           string     `json:"status"`
+	StatusReason     string     `json:"statusReason"`
+	StatusChangedAt  time.Time  `json:"statusChangedAt"`
+	SuspendedUntil   *time.Time `json:"suspendedUntil"`
+	DeletionAt       *time.Time `json:"deletionAt"`
+	Locale           string     `json:"locale"`
+	Timezone         string     `json:"timezone"`
+	AvatarURL        string     `json:"avatarUrl"`
+	Metadata         string     `json:"metadata"`
+
+	// KnownDevices is a comma separated list of hashes of the user agents the user logged in from.
+	KnownDevices string `json:"-"`
+	// NotificationOptOuts is a comma separated list of the notification kinds the user disabled.
+	NotificationOptOuts string `json:"notificationOptOuts"`
+	// Sessions are the sessions of the user by audience, each has its own refresh token.
+	Sessions Sessions `json:"-" gorm:"type:text"`
+	// TokenGeneration is bumped to revoke every token issued before, access tokens too.
+	TokenGeneration int `json:"-"`
+}
+
+// Session is a login of the user on one audience.
+type Session struct {
+	RefreshToken string `json:"refreshToken"`
+	// PreviousRefreshToken was rotated out by the last refresh, using it again means it leaked.
+	PreviousRefreshToken string    `json:"previousRefreshToken,omitempty"`
+	StartedAt            time.Time `json:"startedAt"`
+	RefreshedAt          time.Time `json:"refreshedAt"`
+}
+
+// Sessions maps audiences to their session, it's stored as JSON.
+type Sessions map[string]Session
+
+func (s Sessions) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (s *Sessions) Scan(value interface{}) error {
+	*s = nil
+	var b []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("unexpected sessions type %T", value)
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	return json.Unmarshal(b, s)
+}
+
+// EffectiveStatus returns the status of the user at now.
+// Users without a status are active, and suspensions lift once SuspendedUntil has passed.
+func (u User) EffectiveStatus(now time.Time) string {
+	switch {
+	case u.Status == "":
+		return StatusActive
+	case u.Status == StatusSuspended && u.SuspendedUntil != nil && !now.Before(*u.SuspendedUntil):
+		return StatusActive
+	}
+	return u.Status
 }
 
+// ListOptions filters and paginates the users returned by List.
+// Nil pointer fields are not filtered on.
+type ListOptions struct {
+	Offset    int
+	Limit     int
+	Email     string
+	Name      string
+	Confirmed *bool
+	Status    string
+	// DeletionDue only matches users scheduled for deletion at or before it.
+	DeletionDue *time.Time
+}
+
+func (o ListOptions) matches(user User) bool {
+	if o.Email != "" && !strings.Contains(strings.ToLower(user.Email), strings.ToLower(o.Email)) {
+		return false
+	}
+	if o.Name != "" && !strings.Contains(strings.ToLower(user.Name), strings.ToLower(o.Name)) {
+		return false
+	}
+	if o.Confirmed != nil && user.Confirmed != *o.Confirmed {
+		return false
+	}
+	if o.Status != "" && user.EffectiveStatus(time.Now()) != o.Status {
+		return false
+	}
+	if o.DeletionDue != nil && (user.DeletionAt == nil || user.DeletionAt.After(*o.DeletionDue)) {
+		return false
+	}
+	return true
+}
+
+// UserRepository stores users by email, every implementation must pass the conformance tests in repository_test.go.
+// FindByEmail, Save and Delete fail with ErrUserNotFound for missing users and Create with ErrUserAlreadyExists for existing ones.
 type UserRepository interface {
-	FindByEmail(email string) (User, error)
-	Create(*User) error
-	Save(*User) error
+	FindByEmail(ctx context.Context, email string) (User, error)
+	List(ctx context.Context, opts ListOptions) ([]User, int64, error)
+	// Create and Save write the outbox messages in the same transaction as the user.
+	// Create only inserts new users and Save only replaces existing ones.
+	Create(ctx context.Context, user *User, outbox ...OutboxMessage) error
+	Save(ctx context.Context, user *User, outbox ...OutboxMessage) error
+	// Delete also removes the user's email events, outbox messages and the webhook deliveries about them,
+	// then writes the outbox messages in the same transaction.
+	Delete(ctx context.Context, email string, outbox ...OutboxMessage) error
+	// ListOutboxMessages returns the messages queued for email, sent ones too, newest first.
+	ListOutboxMessages(ctx context.Context, email string) ([]OutboxMessage, error)
+	// ListUserWebhookDeliveries returns the deliveries of the events about email, newest first.
+	ListUserWebhookDeliveries(ctx context.Context, email string) ([]WebhookDelivery, error)
+	EmailEventRepository
+}
+
+// Repository is implemented by every storage backend.
+type Repository interface {
+	UserRepository
+	OutboxRepository
+	WebhookRepository
+	// Ping checks the backend can be reached, for readiness checks.
+	Ping(ctx context.Context) error
+	// Close releases the connections of the backend.
+	Close() error
 }
 
+// New builds the repository named in the config, "postgres", "sqlite" or "memory".
+// The memory repository is only meant for development, it loses every user on restart unless it writes snapshots.
+// plugins are only used by the postgres and sqlite repositories.
+func New(cfg config.Config, plugins ...gorm.Plugin) (Repository, error) {
+	switch name := cfg.Repository; name {
+	case "", "postgres":
+		return NewPostgres(cfg.Postgres, plugins...)
+	case "sqlite":
+		return NewSQLite(cfg.SQLite, plugins...)
+	case "memory":
+		return NewMemory(cfg.Memory)
+	}
+	return nil, fmt.Errorf("unknown repository %q, must be one of: postgres, sqlite, memory", cfg.Repository)
+}
+
+// MapRepository keeps everything in memory and is safe for concurrent use.
+// Values are copied on the way in and out, so callers never share them with the repository or each other.
 type MapRepository struct {
-	M map[string]User
+	mu   *sync.RWMutex
+	data *mapData
+	// path is where snapshots are written, they're disabled when it's empty.
+	path string
+}
+
+// mapData is everything the map repository stores, snapshots are its gob encoding.
+type mapData struct {
+	Users                map[string]User
+	Outbox               map[string]OutboxMessage
+	EmailEvents          map[string]EmailEvent
+	Suppressions         map[string]Suppression
+	WebhookSubscriptions map[string]WebhookSubscription
+	WebhookDeliveries    map[string]WebhookDelivery
 }
 
+func newMapData() *mapData {
+	return &mapData{
+		Users:                make(map[string]User),
+		Outbox:               make(map[string]OutboxMessage),
+		EmailEvents:          make(map[string]EmailEvent),
+		Suppressions:         make(map[string]Suppression),
+		WebhookSubscriptions: make(map[string]WebhookSubscription),
+		WebhookDeliveries:    make(map[string]WebhookDelivery),
+	}
+}
+
+// NewMap returns an empty map repository that loses everything on restart.
 func NewMap() (MapRepository, error) {
-	return MapRepository{
-		M: make(map[string]User),
-	}, nil
+	return MapRepository{mu: &sync.RWMutex{}, data: newMapData()}, nil
+}
+
+// cloneTime copies t so the copy doesn't share the time it points to.
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func (u User) clone() User {
+	u.SuspendedUntil = cloneTime(u.SuspendedUntil)
+	u.DeletionAt = cloneTime(u.DeletionAt)
+	if u.Sessions != nil {
+		sessions := make(Sessions, len(u.Sessions))
+		for audience, session := range u.Sessions {
+			sessions[audience] = session
+		}
+		u.Sessions = sessions
+	}
+	return u
 }
 
-func (mr MapRepository) FindByEmail(email string) (User, error) {
-	user, ok := mr.M[email]
+func (mr MapRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	if err := ctx.Err(); err != nil {
+		return User{}, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	user, ok := mr.data.Users[email]
 	if !ok {
 		return User{}, ErrUserNotFound
 	}
-	return user, nil
+	return user.clone(), nil
 }
 
-func (mr MapRepository) Create(user *User) error {
-	_, ok := mr.M[user.Email]
+func (mr MapRepository) Create(ctx context.Context, user *User, outbox ...OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	_, ok := mr.data.Users[user.Email]
 	if ok {
 		return ErrUserAlreadyExists
 	}
-	mr.M[user.Email] = *user
+	mr.data.Users[user.Email] = user.clone()
+	mr.enqueue(outbox)
 	return nil
 }
 
-func (mr MapRepository) Save(user *User) error {
-	mr.M[user.Email] = *user
+func (mr MapRepository) List(ctx context.Context, opts ListOptions) ([]User, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	users := make([]User, 0)
+	for _, user := range mr.data.Users {
+		if opts.matches(user) {
+			users = append(users, user.clone())
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+
+	total := int64(len(users))
+	if opts.Offset >= len(users) {
+		return []User{}, total, nil
+	}
+	users = users[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(users) {
+		users = users[:opts.Limit]
+	}
+	return users, total, nil
+}
+
+func (mr MapRepository) Save(ctx context.Context, user *User, outbox ...OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.Users[user.Email]; !ok {
+		return ErrUserNotFound
+	}
+	mr.data.Users[user.Email] = user.clone()
+	mr.enqueue(outbox)
 	return nil
 }
 
-type PostgresRepository struct {
+func (mr MapRepository) Delete(ctx context.Context, email string, outbox ...OutboxMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.Users[email]; !ok {
+		return ErrUserNotFound
+	}
+	delete(mr.data.Users, email)
+	for id, event := range mr.data.EmailEvents {
+		if event.Email == email {
+			delete(mr.data.EmailEvents, id)
+		}
+	}
+	for id, msg := range mr.data.Outbox {
+		if msg.Email == email {
+			delete(mr.data.Outbox, id)
+		}
+	}
+	for id, delivery := range mr.data.WebhookDeliveries {
+		if delivery.Subject == email {
+			delete(mr.data.WebhookDeliveries, id)
+		}
+	}
+	mr.enqueue(outbox)
+	return nil
+}
+
+func (mr MapRepository) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close writes a last snapshot, if snapshots are enabled.
+func (mr MapRepository) Close() error {
+	return mr.Snapshot()
+}
+
+// SQLRepository stores users in a SQL database with gorm, the postgres and sqlite repositories share it.
+type SQLRepository struct {
 	DB *gorm.DB
 }
 
-func NewPostgres() (PostgresRepository, error) {
-	host := os.Getenv("POSTGRES_HOST")
-	port := os.Getenv("POSTGRES_PORT")
-	puser := os.Getenv("POSTGRES_USER")
-	pass := os.Getenv("POSTGRES_PASS")
-	dbname := os.Getenv("POSTGRES_DB")
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s  sslmode=disable", host, puser, pass, dbname, port)
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+type PostgresRepository struct {
+	SQLRepository
+}
+
+// PostgresDSN returns the connection string of the database in cfg.
+func PostgresDSN(cfg config.PostgresConfig) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s  sslmode=disable", cfg.Host, cfg.User, cfg.Password, cfg.DB, cfg.Port)
+}
+
+// OpenPostgres connects to postgres without checking its schema, for running migrations.
+func OpenPostgres(cfg config.PostgresConfig, plugins ...gorm.Plugin) (*gorm.DB, error) {
+	return open(postgres.Open(PostgresDSN(cfg)), plugins)
+}
+
+func open(dialector gorm.Dialector, plugins []gorm.Plugin) (*gorm.DB, error) {
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	for _, plugin := range plugins {
+		if err := db.Use(plugin); err != nil {
+			return nil, fmt.Errorf("use %s plugin: %w", plugin.Name(), err)
+		}
+	}
+	return db, nil
+}
+
+// migrator returns the migrator of the schema of db.
+func migrator(db *gorm.DB, dialect string) (migrate.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return migrate.Migrator{}, err
+	}
+	migrations, err := migrate.Migrations(dialect)
+	if err != nil {
+		return migrate.Migrator{}, err
+	}
+	return migrate.New(sqlDB, dialect, migrations)
+}
+
+// NewPostgres connects to postgres and fails if its schema has pending migrations,
+// they're applied by "mimoto migrate up" so replicas never race to change the schema.
+func NewPostgres(cfg config.PostgresConfig, plugins ...gorm.Plugin) (PostgresRepository, error) {
+	db, err := OpenPostgres(cfg, plugins...)
+	if err != nil {
+		return PostgresRepository{}, err
+	}
+	r := PostgresRepository{SQLRepository{DB: db}}
+
+	m, err := migrator(db, migrate.Postgres)
 	if err != nil {
+		r.Close()
 		return PostgresRepository{}, err
 	}
+	pending, err := m.Pending(context.Background())
+	if err != nil {
+		r.Close()
+		return PostgresRepository{}, fmt.Errorf("check migrations: %w", err)
+	}
+	if len(pending) > 0 {
+		r.Close()
+		return PostgresRepository{}, fmt.Errorf("%w: %d pending, run mimoto migrate up", ErrSchemaOutdated, len(pending))
+	}
+	return r, nil
+}
+
+// SQLiteRepository stores users in a single file, for small deployments that don't want to run postgres.
+type SQLiteRepository struct {
+	SQLRepository
+}
+
+// OpenSQLite opens the database file in cfg without checking its schema, for running migrations.
+// Transactions take the write lock when they begin, so claims of the outbox and webhook dispatchers
+// don't need the row locks sqlite doesn't have.
+func OpenSQLite(cfg config.SQLiteConfig, plugins ...gorm.Plugin) (*gorm.DB, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("missing sqlite path")
+	}
+	// the driver already writes times in sqlite's format, setting _time_format makes it ignore _txlock
+	dsn := "file:" + cfg.Path + "?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	db, err := open(sqlite.Open(dsn), plugins)
+	if err != nil {
+		return nil, err
+	}
+	// every connection to an in memory database opens a new empty one
+	if cfg.Path == ":memory:" {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
+
+// NewSQLite opens the database file in cfg and applies pending migrations,
+// unlike postgres a sqlite database only has one server so there's nothing to race.
+func NewSQLite(cfg config.SQLiteConfig, plugins ...gorm.Plugin) (SQLiteRepository, error) {
+	db, err := OpenSQLite(cfg, plugins...)
+	if err != nil {
+		return SQLiteRepository{}, err
+	}
+	r := SQLiteRepository{SQLRepository{DB: db}}
+
+	m, err := migrator(db, migrate.SQLite)
+	if err != nil {
+		r.Close()
+		return SQLiteRepository{}, err
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		r.Close()
+		return SQLiteRepository{}, err
+	}
+	return r, nil
+}
 
-	db.AutoMigrate(&User{})
+// like is the case insensitive LIKE operator of the database, sqlite's LIKE already ignores case.
+func (r SQLRepository) like() string {
+	if r.DB.Dialector.Name() == "sqlite" {
+		return "LIKE"
+	}
+	return "ILIKE"
+}
 
-	return PostgresRepository{
-		DB: db,
-	}, nil
+// page applies offset and limit to query, sqlite only accepts an OFFSET after a LIMIT.
+func page(query *gorm.DB, offset, limit int) *gorm.DB {
+	if limit <= 0 {
+		if offset == 0 {
+			return query
+		}
+		limit = math.MaxInt32
+	}
+	return query.Offset(offset).Limit(limit)
 }
 
-func (r PostgresRepository) FindByEmail(email string) (User, error) {
+func (r SQLRepository) FindByEmail(ctx context.Context, email string) (User, error) {
 	user := User{Email: email}
-	tx := r.DB.First(&user)
+	tx := r.DB.WithContext(ctx).First(&user)
 	if tx.Error != nil {
 		if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 			return User{}, ErrUserNotFound
@@ -98,18 +518,119 @@ func (r PostgresRepository) FindByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (r PostgresRepository) Create(user *User) error {
-	tx := r.DB.Create(user)
-	if tx.Error != nil {
-		return tx.Error
+func (r SQLRepository) Create(ctx context.Context, user *User, outbox ...OutboxMessage) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if result := tx.Model(&User{}).Where("email = ?", user.Email).Count(&count); result.Error != nil {
+			return result.Error
+		}
+		if count > 0 {
+			return ErrUserAlreadyExists
+		}
+		if result := tx.Create(user); result.Error != nil {
+			// a concurrent create won the race between the count and the insert
+			if isUniqueViolation(result.Error) {
+				return ErrUserAlreadyExists
+			}
+			return result.Error
+		}
+		return enqueue(tx, outbox)
+	})
+}
+
+// isUniqueViolation reports whether err is postgres refusing a duplicate key.
+// sqlite transactions hold the write lock from the start, so they never race.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (r SQLRepository) List(ctx context.Context, opts ListOptions) ([]User, int64, error) {
+	query := r.DB.WithContext(ctx).Model(&User{})
+	if opts.Email != "" {
+		query = query.Where("email "+r.like()+" ?", "%"+opts.Email+"%")
 	}
-	return nil
+	if opts.Name != "" {
+		query = query.Where("name "+r.like()+" ?", "%"+opts.Name+"%")
+	}
+	if opts.Confirmed != nil {
+		query = query.Where("confirmed = ?", *opts.Confirmed)
+	}
+	switch opts.Status {
+	case "":
+	case StatusActive:
+		query = query.Where("status IS NULL OR status IN ? OR (status = ? AND suspended_until <= ?)", []string{"", StatusActive}, StatusSuspended, time.Now())
+	case StatusSuspended:
+		query = query.Where("status = ? AND (suspended_until IS NULL OR suspended_until > ?)", StatusSuspended, time.Now())
+	default:
+		query = query.Where("status = ?", opts.Status)
+	}
+	if opts.DeletionDue != nil {
+		query = query.Where("deletion_at <= ?", *opts.DeletionDue)
+	}
+
+	var total int64
+	if tx := query.Count(&total); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+
+	query = page(query.Order("email"), opts.Offset, opts.Limit)
+	users := make([]User, 0)
+	if tx := query.Find(&users); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+	return users, total, nil
 }
 
-func (r PostgresRepository) Save(user *User) error {
-	tx := r.DB.Save(user)
-	if tx.Error != nil {
-		return tx.Error
+// Save updates every column of an existing user, unlike gorm's Save it never inserts.
+func (r SQLRepository) Save(ctx context.Context, user *User, outbox ...OutboxMessage) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Select("*").Updates(user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		return enqueue(tx, outbox)
+	})
+}
+
+// Delete removes the user and their email events, suppressions are kept so deleted addresses stay suppressed.
+func (r SQLRepository) Delete(ctx context.Context, email string, outbox ...OutboxMessage) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&User{Email: email})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserNotFound
+		}
+		if err := tx.Where("email = ?", email).Delete(&EmailEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("email = ?", email).Delete(&OutboxMessage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subject = ?", email).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return enqueue(tx, outbox)
+	})
+}
+
+func (r SQLRepository) Ping(ctx context.Context) error {
+	db, err := r.DB.DB()
+	if err != nil {
+		return err
 	}
-	return nil
+	return db.PingContext(ctx)
+}
+
+func (r SQLRepository) Close() error {
+	db, err := r.DB.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
 }
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/broswen/mimoto/internal/config"
+)
+
+// Snapshotter is implemented by repositories that persist themselves by writing snapshots.
+type Snapshotter interface {
+	Snapshot() error
+}
+
+// NewMemory returns a map repository restored from the snapshot at cfg.SnapshotPath,
+// Snapshot and Close write it back. Without a path it's the same as NewMap.
+func NewMemory(cfg config.MemoryConfig) (MapRepository, error) {
+	mr, err := NewMap()
+	if err != nil {
+		return MapRepository{}, err
+	}
+	if cfg.SnapshotPath == "" {
+		return mr, nil
+	}
+	mr.path = cfg.SnapshotPath
+
+	b, err := os.ReadFile(mr.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return mr, nil
+	}
+	if err != nil {
+		return MapRepository{}, fmt.Errorf("read snapshot: %w", err)
+	}
+	// gob leaves out empty maps, so decode into the empty ones of the new repository
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(mr.data); err != nil {
+		return MapRepository{}, fmt.Errorf("decode snapshot %s: %w", mr.path, err)
+	}
+	return mr, nil
+}
+
+// Snapshot writes everything in the repository to its snapshot file, replacing the previous snapshot at once.
+// The audit events of the memory audit sink aren't part of the repository, so they aren't in snapshots.
+// Snapshots are gob encoded because the json encoding of users leaves out their passwords and tokens,
+// so the file is only readable by the current user.
+func (mr MapRepository) Snapshot() error {
+	if mr.path == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	mr.mu.RLock()
+	err := gob.NewEncoder(&b).Encode(mr.data)
+	mr.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(mr.path), filepath.Base(mr.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	// the snapshot must be on disk before it replaces the previous one, or a crash could leave an empty file
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), mr.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(mr.path))
+}
+
+// syncDir makes a rename in dir survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+)
+
+func TestMemorySnapshot(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.MemoryConfig{SnapshotPath: filepath.Join(t.TempDir(), "mimoto.gob")}
+
+	// there's nothing to restore the first time
+	mr, err := NewMemory(cfg)
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	suspended := time.Now().Add(time.Hour).Truncate(time.Second)
+	user := User{Email: "test@test.com", HashedPassword: "hash", Sessions: Sessions{"mimoto": {RefreshToken: "token"}}, SuspendedUntil: &suspended}
+	msg := OutboxMessage{IdempotencyKey: "confirmation:1", Kind: "confirmation", Email: user.Email}
+	if err := mr.Create(ctx, &user, msg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := mr.Suppress(ctx, "bounced@test.com", "bounce"); err != nil {
+		t.Fatalf("Suppress: %v", err)
+	}
+	if err := mr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	info, err := os.Stat(cfg.SnapshotPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("snapshot mode doesn't match: wanted %v but got %v", os.FileMode(0600), info.Mode().Perm())
+	}
+
+	restored, err := NewMemory(cfg)
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	found, err := restored.FindByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	// unlike the json encoding of users the snapshot keeps their secrets
+	if found.HashedPassword != "hash" || found.Sessions["mimoto"].RefreshToken != "token" || !found.SuspendedUntil.Equal(suspended) {
+		t.Fatalf("restored user doesn't match: got %+v", found)
+	}
+	if messages := restored.OutboxMessages(); len(messages) != 1 || messages[0].IdempotencyKey != msg.IdempotencyKey {
+		t.Fatalf("restored outbox doesn't match: got %+v", messages)
+	}
+	if suppressed, _ := restored.IsSuppressed(ctx, "bounced@test.com"); !suppressed {
+		t.Fatalf("restored suppression is missing")
+	}
+	// empty maps aren't in the snapshot but can still be written to
+	sub := WebhookSubscription{URL: "https://example.com/hook", Events: "user.created"}
+	if err := restored.CreateWebhookSubscription(ctx, &sub); err != nil {
+		t.Fatalf("CreateWebhookSubscription: %v", err)
+	}
+}
+
+func TestMemorySnapshotInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mimoto.gob")
+	if err := os.WriteFile(path, []byte("not a snapshot"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := NewMemory(config.MemoryConfig{SnapshotPath: path}); err == nil {
+		t.Fatalf("NewMemory: invalid snapshot didn't fail")
+	}
+}
+
+func TestMemoryWithoutSnapshots(t *testing.T) {
+	mr, err := NewMemory(config.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("NewMemory: %v", err)
+	}
+	if err := mr.Snapshot(); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if err := mr.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
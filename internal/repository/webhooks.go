@@ -0,0 +1,408 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookDeliveryNotFound     = errors.New("webhook delivery not found")
+)
+
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+// WebhookSubscription is a url that is sent the webhook events it subscribed to.
+type WebhookSubscription struct {
+	ID  string `json:"id" gorm:"primaryKey"`
+	URL string `json:"url"`
+	// Secret signs the payloads, it's only shown when the subscription is created.
+	Secret string `json:"-"`
+	// Events is a comma separated list of the event types sent to URL.
+	Events    string    `json:"events"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is an event to send to a subscription, kept as a log once it's delivered.
+type WebhookDelivery struct {
+	ID string `json:"id" gorm:"primaryKey"`
+	// IdempotencyKey makes fanning the same event out to a subscription more than once a no-op.
+	IdempotencyKey string `json:"-" gorm:"uniqueIndex"`
+	SubscriptionID string `json:"subscriptionId" gorm:"index"`
+	EventID        string `json:"eventId"`
+	EventType      string `json:"eventType"`
+	// Subject is the email of the account the event is about.
+	Subject  string `json:"subject" gorm:"index"`
+	Payload  string `json:"payload"`
+	Status   string `json:"status" gorm:"index:idx_webhook_due"`
+	Attempts int    `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 if there was no response.
+	ResponseStatus int       `json:"responseStatus"`
+	LastError      string    `json:"lastError"`
+	NextAttemptAt  time.Time `json:"nextAttemptAt" gorm:"index:idx_webhook_due"`
+	// ReplayOf is the delivery this one sends again.
+	ReplayOf    string     `json:"replayOf,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	DeliveredAt *time.Time `json:"deliveredAt"`
+}
+
+type WebhookRepository interface {
+	CreateWebhookSubscription(ctx context.Context, sub *WebhookSubscription) error
+	FindWebhookSubscription(ctx context.Context, id string) (WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+
+	// CreateWebhookDeliveries skips deliveries whose idempotency key was already used.
+	CreateWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+	FindWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error)
+	// ListWebhookDeliveries returns the deliveries to a subscription newest first, and how many there are in total.
+	ListWebhookDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]WebhookDelivery, int64, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at now,
+	// and delays them by lease so concurrent dispatchers don't claim them too.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+}
+
+func prepareWebhookSubscription(sub *WebhookSubscription, now time.Time) {
+	if sub.ID == "" {
+		id, _ := uuid.NewV4()
+		sub.ID = id.String()
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = now
+	}
+}
+
+func prepareWebhookDelivery(delivery *WebhookDelivery, now time.Time) {
+	if delivery.ID == "" {
+		id, _ := uuid.NewV4()
+		delivery.ID = id.String()
+	}
+	if delivery.IdempotencyKey == "" {
+		delivery.IdempotencyKey = delivery.ID
+	}
+	if delivery.Status == "" {
+		delivery.Status = WebhookPending
+	}
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = now
+	}
+}
+
+func (d WebhookDelivery) clone() WebhookDelivery {
+	d.DeliveredAt = cloneTime(d.DeliveredAt)
+	return d
+}
+
+func (mr MapRepository) CreateWebhookSubscription(ctx context.Context, sub *WebhookSubscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	prepareWebhookSubscription(sub, time.Now())
+	mr.data.WebhookSubscriptions[sub.ID] = *sub
+	return nil
+}
+
+func (mr MapRepository) FindWebhookSubscription(ctx context.Context, id string) (WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return WebhookSubscription{}, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	sub, ok := mr.data.WebhookSubscriptions[id]
+	if !ok {
+		return WebhookSubscription{}, ErrWebhookSubscriptionNotFound
+	}
+	return sub, nil
+}
+
+func (mr MapRepository) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	subs := make([]WebhookSubscription, 0, len(mr.data.WebhookSubscriptions))
+	for _, sub := range mr.data.WebhookSubscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].CreatedAt.Before(subs[j].CreatedAt)
+	})
+	return subs, nil
+}
+
+func (mr MapRepository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.WebhookSubscriptions[id]; !ok {
+		return ErrWebhookSubscriptionNotFound
+	}
+	delete(mr.data.WebhookSubscriptions, id)
+	return nil
+}
+
+func (mr MapRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	for _, delivery := range deliveries {
+		prepareWebhookDelivery(&delivery, time.Now())
+		duplicate := false
+		for _, existing := range mr.data.WebhookDeliveries {
+			if existing.IdempotencyKey == delivery.IdempotencyKey {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			mr.data.WebhookDeliveries[delivery.ID] = delivery.clone()
+		}
+	}
+	return nil
+}
+
+func (mr MapRepository) FindWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return WebhookDelivery{}, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	delivery, ok := mr.data.WebhookDeliveries[id]
+	if !ok {
+		return WebhookDelivery{}, ErrWebhookDeliveryNotFound
+	}
+	return delivery.clone(), nil
+}
+
+func (mr MapRepository) ListWebhookDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]WebhookDelivery, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range mr.data.WebhookDeliveries {
+		if delivery.SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, delivery.clone())
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+
+	total := int64(len(deliveries))
+	if offset >= len(deliveries) {
+		return []WebhookDelivery{}, total, nil
+	}
+	deliveries = deliveries[offset:]
+	if limit > 0 && limit < len(deliveries) {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, total, nil
+}
+
+func (mr MapRepository) ListUserWebhookDeliveries(ctx context.Context, email string) ([]WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.RLock()
+	defer mr.mu.RUnlock()
+	deliveries := make([]WebhookDelivery, 0)
+	for _, delivery := range mr.data.WebhookDeliveries {
+		if delivery.Subject == email {
+			deliveries = append(deliveries, delivery.clone())
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries, nil
+}
+
+func (mr MapRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	due := make([]WebhookDelivery, 0)
+	for _, delivery := range mr.data.WebhookDeliveries {
+		if delivery.Status == WebhookPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	for i, delivery := range due {
+		delivery.NextAttemptAt = now.Add(lease)
+		mr.data.WebhookDeliveries[delivery.ID] = delivery
+		due[i] = delivery.clone()
+	}
+	return due, nil
+}
+
+func (mr MapRepository) SaveWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+	if _, ok := mr.data.WebhookDeliveries[delivery.ID]; !ok {
+		return ErrWebhookDeliveryNotFound
+	}
+	mr.data.WebhookDeliveries[delivery.ID] = delivery.clone()
+	return nil
+}
+
+func (r SQLRepository) CreateWebhookSubscription(ctx context.Context, sub *WebhookSubscription) error {
+	prepareWebhookSubscription(sub, time.Now())
+	return r.DB.WithContext(ctx).Create(sub).Error
+}
+
+func (r SQLRepository) FindWebhookSubscription(ctx context.Context, id string) (WebhookSubscription, error) {
+	sub := WebhookSubscription{}
+	tx := r.DB.WithContext(ctx).Where("id = ?", id).First(&sub)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return WebhookSubscription{}, ErrWebhookSubscriptionNotFound
+	}
+	if tx.Error != nil {
+		return WebhookSubscription{}, tx.Error
+	}
+	return sub, nil
+}
+
+func (r SQLRepository) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	subs := make([]WebhookSubscription, 0)
+	tx := r.DB.WithContext(ctx).Order("created_at").Find(&subs)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return subs, nil
+}
+
+// DeleteWebhookSubscription keeps the deliveries to the subscription as a log.
+func (r SQLRepository) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	tx := r.DB.WithContext(ctx).Delete(&WebhookSubscription{ID: id})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+func (r SQLRepository) CreateWebhookDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	for i := range deliveries {
+		prepareWebhookDelivery(&deliveries[i], time.Now())
+	}
+	return r.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "idempotency_key"}},
+		DoNothing: true,
+	}).Create(&deliveries).Error
+}
+
+func (r SQLRepository) FindWebhookDelivery(ctx context.Context, id string) (WebhookDelivery, error) {
+	delivery := WebhookDelivery{}
+	tx := r.DB.WithContext(ctx).Where("id = ?", id).First(&delivery)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return WebhookDelivery{}, ErrWebhookDeliveryNotFound
+	}
+	if tx.Error != nil {
+		return WebhookDelivery{}, tx.Error
+	}
+	return delivery, nil
+}
+
+func (r SQLRepository) ListWebhookDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]WebhookDelivery, int64, error) {
+	query := r.DB.WithContext(ctx).Model(&WebhookDelivery{}).Where("subscription_id = ?", subscriptionID)
+
+	var total int64
+	if tx := query.Count(&total); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+
+	query = page(query.Order("created_at DESC"), offset, limit)
+	deliveries := make([]WebhookDelivery, 0)
+	if tx := query.Find(&deliveries); tx.Error != nil {
+		return nil, 0, tx.Error
+	}
+	return deliveries, total, nil
+}
+
+func (r SQLRepository) ListUserWebhookDeliveries(ctx context.Context, email string) ([]WebhookDelivery, error) {
+	deliveries := make([]WebhookDelivery, 0)
+	tx := r.DB.WithContext(ctx).Where("subject = ?", email).Order("created_at DESC").Find(&deliveries)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	return deliveries, nil
+}
+
+func (r SQLRepository) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	due := make([]WebhookDelivery, 0)
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", WebhookPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&due)
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(due) == 0 {
+			return nil
+		}
+
+		ids := make([]string, 0, len(due))
+		for _, delivery := range due {
+			ids = append(ids, delivery.ID)
+		}
+		return tx.Model(&WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return due, nil
+}
+
+// SaveWebhookDelivery updates every column of the delivery, unlike gorm's Save it never inserts,
+// so deliveries erased with their user stay erased.
+func (r SQLRepository) SaveWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	tx := r.DB.WithContext(ctx).Select("*").Updates(delivery)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrWebhookDeliveryNotFound
+	}
+	return nil
+}
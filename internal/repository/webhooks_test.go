@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	forEachRepository(t, func(t *testing.T, mr Repository) {
+		ctx := context.Background()
+
+		sub := WebhookSubscription{URL: "https://example.com/hook", Secret: "secret", Events: "user.created"}
+		if err := mr.CreateWebhookSubscription(ctx, &sub); err != nil {
+			t.Fatalf("CreateWebhookSubscription: %v", err)
+		}
+		if sub.ID == "" {
+			t.Fatalf("subscription is missing an id")
+		}
+		subs, err := mr.ListWebhookSubscriptions(ctx)
+		if err != nil {
+			t.Fatalf("ListWebhookSubscriptions: %v", err)
+		}
+		if len(subs) != 1 || subs[0].Secret != "secret" {
+			t.Fatalf("subscriptions don't match: got %+v", subs)
+		}
+
+		delivery := WebhookDelivery{IdempotencyKey: sub.ID + ":1", SubscriptionID: sub.ID, EventID: "1", EventType: "user.created"}
+		// fanning out the same event again is a no-op
+		for i := 0; i < 2; i++ {
+			if err := mr.CreateWebhookDeliveries(ctx, []WebhookDelivery{delivery}); err != nil {
+				t.Fatalf("CreateWebhookDeliveries: %v", err)
+			}
+		}
+		deliveries, total, err := mr.ListWebhookDeliveries(ctx, sub.ID, 0, 10)
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries: %v", err)
+		}
+		if total != 1 || len(deliveries) != 1 || deliveries[0].Status != WebhookPending {
+			t.Fatalf("deliveries don't match: got %v %+v", total, deliveries)
+		}
+
+		now := time.Now()
+		claimed, err := mr.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+		if err != nil {
+			t.Fatalf("ClaimWebhookDeliveries: %v", err)
+		}
+		if len(claimed) != 1 {
+			t.Fatalf("ClaimWebhookDeliveries: wanted %v deliveries but got %v", 1, len(claimed))
+		}
+		// claimed deliveries are leased
+		claimed, _ = mr.ClaimWebhookDeliveries(ctx, now, time.Minute, 10)
+		if len(claimed) != 0 {
+			t.Fatalf("ClaimWebhookDeliveries: wanted %v deliveries but got %v", 0, len(claimed))
+		}
+
+		delivery, _ = mr.FindWebhookDelivery(ctx, deliveries[0].ID)
+		delivery.Status = WebhookDelivered
+		if err := mr.SaveWebhookDelivery(ctx, &delivery); err != nil {
+			t.Fatalf("SaveWebhookDelivery: %v", err)
+		}
+		claimed, _ = mr.ClaimWebhookDeliveries(ctx, now.Add(time.Hour), time.Minute, 10)
+		if len(claimed) != 0 {
+			t.Fatalf("ClaimWebhookDeliveries: delivered delivery was claimed")
+		}
+
+		if err := mr.DeleteWebhookSubscription(ctx, sub.ID); err != nil {
+			t.Fatalf("DeleteWebhookSubscription: %v", err)
+		}
+		if _, err := mr.FindWebhookSubscription(ctx, sub.ID); !errors.Is(err, ErrWebhookSubscriptionNotFound) {
+			t.Fatalf("FindWebhookSubscription error doesn't match: wanted %v but got %v", ErrWebhookSubscriptionNotFound, err)
+		}
+		// the delivery log outlives the subscription
+		if _, total, _ := mr.ListWebhookDeliveries(ctx, sub.ID, 0, 10); total != 1 {
+			t.Fatalf("deliveries don't match: wanted %v but got %v", 1, total)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/rs/zerolog"
+)
+
+// loggingSink logs the events its sink fails to write, since the actions they record carry on without them.
+type loggingSink struct {
+	audit.AuditSink
+	logger zerolog.Logger
+}
+
+func (s loggingSink) Write(ctx context.Context, event audit.Event) error {
+	err := s.AuditSink.Write(ctx, event)
+	if err != nil {
+		s.logger.Error().Err(err).Str("type", event.Type).Str("subject", event.Subject).Msg("write audit event")
+	}
+	return err
+}
+
+// loggingLog is a loggingSink that keeps the queries of the log it wraps.
+type loggingLog struct {
+	loggingSink
+	log audit.AuditLog
+}
+
+func (l loggingLog) List(ctx context.Context, opts audit.ListOptions) ([]audit.Event, int64, error) {
+	return l.log.List(ctx, opts)
+}
+
+func (l loggingLog) Anonymize(ctx context.Context, email, pseudonym string) error {
+	return l.log.Anonymize(ctx, email, pseudonym)
+}
@@ -1,83 +1,500 @@
 package server
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/config"
 	"github.com/broswen/mimoto/internal/email"
 	"github.com/broswen/mimoto/internal/handlers"
+	"github.com/broswen/mimoto/internal/health"
+	"github.com/broswen/mimoto/internal/metrics"
+	"github.com/broswen/mimoto/internal/outbox"
 	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/tracing"
 	"github.com/broswen/mimoto/internal/user"
+	"github.com/broswen/mimoto/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/httplog"
-	"github.com/go-chi/jwtauth/v5"
 	"github.com/go-chi/render"
 	"github.com/rs/zerolog"
 )
 
+const (
+	deletionWorkerInterval = time.Hour
+	outboxWorkerInterval   = 5 * time.Second
+	webhookWorkerInterval  = 5 * time.Second
+)
+
 type Server struct {
+	config       config.Config
+	repository   repository.Repository
 	userService  user.UserService
 	emailService email.EmailService
-	router       chi.Router
-	logger       zerolog.Logger
-	tokenAuth    *jwtauth.JWTAuth
+	// sender is closed on shutdown, after the workers sent their last emails.
+	sender            email.Sender
+	dispatcher        outbox.Dispatcher
+	webhookService    webhook.WebhookService
+	webhookDispatcher webhook.Dispatcher
+	health            health.Checker
+	metrics           metrics.Metrics
+	tracing           tracing.Tracing
+	auditSink         audit.AuditSink
+	// auditLog serves the audit query endpoints, which are only mounted when it's set.
+	auditLog audit.AuditLog
+	router   chi.Router
+	logger   zerolog.Logger
+	// sendGridWebhookKey verifies the SendGrid event webhook, which is only mounted when it's set.
+	sendGridWebhookKey *ecdsa.PublicKey
+	// certReloader serves the TLS certificate, HTTPS is only served when it's set.
+	certReloader *certReloader
+	// snapshots persists the repository every snapshot interval, it's only set for repositories that write snapshots.
+	snapshots repository.Snapshotter
 }
 
-func New() (Server, error) {
+func New(cfg config.Config) (_ Server, err error) {
 
-	userRepository, err := repository.NewPostgres()
+	m, err := metrics.New()
+	if err != nil {
+		return Server{}, fmt.Errorf("init Metrics: %w", err)
+	}
+
+	t, err := tracing.New(cfg.Tracing)
+	if err != nil {
+		return Server{}, fmt.Errorf("init Tracing: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			t.Shutdown(context.Background())
+		}
+	}()
+
+	repo, err := repository.New(cfg, t.GormPlugin())
 	if err != nil {
 		return Server{}, fmt.Errorf("init Repository: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			repo.Close()
+		}
+	}()
+
+	logger := httplog.NewLogger("mimoto", httplog.Options{
+		JSON: true,
+	})
+
+	sink, err := audit.New(cfg.Audit, repo)
+	if err != nil {
+		return Server{}, fmt.Errorf("init AuditSink: %w", err)
+	}
+	// the audit log can only be queried if the sink supports it
+	auditLog, _ := sink.(audit.AuditLog)
+	var auditSink audit.AuditSink = loggingSink{AuditSink: sink, logger: logger}
+	if auditLog != nil {
+		// the user service exports and anonymizes the events of accounts through it
+		auditSink = loggingLog{loggingSink: loggingSink{AuditSink: sink, logger: logger}, log: auditLog}
+	}
 
-	emailService, err := email.NewSendGrid()
+	var snapshots repository.Snapshotter
+	if snapshotter, ok := repo.(repository.Snapshotter); ok && cfg.Memory.SnapshotPath != "" && cfg.Memory.SnapshotInterval > 0 {
+		snapshots = snapshotter
+	}
+
+	userRepository, err := metrics.NewRepository(repo, m)
+	if err != nil {
+		return Server{}, fmt.Errorf("init Repository metrics: %w", err)
+	}
+
+	sender, err := email.NewSender(cfg.Email)
+	if err != nil {
+		return Server{}, fmt.Errorf("init Sender: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			closeSender(sender)
+		}
+	}()
+
+	var templateOverride fs.FS
+	if cfg.Email.TemplatesDir != "" {
+		templateOverride = os.DirFS(cfg.Email.TemplatesDir)
+	}
+	templates, err := email.NewTemplates(templateOverride)
+	if err != nil {
+		return Server{}, fmt.Errorf("init Templates: %w", err)
+	}
+
+	emailService, err := email.New(sender, templates, userRepository, cfg.BaseURL)
 	if err != nil {
 		return Server{}, fmt.Errorf("init EmailService: %w", err)
 	}
 
-	userService, err := user.New(userRepository, emailService)
+	instrumentedEmailService, err := metrics.NewEmailService(emailService, cfg.Email.Provider, m)
+	if err != nil {
+		return Server{}, fmt.Errorf("init EmailService metrics: %w", err)
+	}
+	tracedEmailService, err := tracing.NewEmailService(instrumentedEmailService, cfg.Email.Provider, t)
+	if err != nil {
+		return Server{}, fmt.Errorf("init EmailService tracing: %w", err)
+	}
+
+	hasher, err := metrics.NewPasswordHasher(user.BcryptHasher{}, m)
+	if err != nil {
+		return Server{}, fmt.Errorf("init PasswordHasher metrics: %w", err)
+	}
+	service, err := user.New(userRepository, hasher, auditSink, cfg)
 	if err != nil {
 		return Server{}, fmt.Errorf("init UserService: %w", err)
 	}
+	instrumentedUserService, err := metrics.NewUserService(service, m)
+	if err != nil {
+		return Server{}, fmt.Errorf("init UserService metrics: %w", err)
+	}
+	userService, err := tracing.NewUserService(instrumentedUserService, t)
+	if err != nil {
+		return Server{}, fmt.Errorf("init UserService tracing: %w", err)
+	}
 
-	logger := httplog.NewLogger("mimoto", httplog.Options{
-		JSON: true,
+	webhookService, err := webhook.New(userRepository)
+	if err != nil {
+		return Server{}, fmt.Errorf("init WebhookService: %w", err)
+	}
+	webhookClient, err := webhook.NewClient(cfg.Webhooks.AllowedNetworks)
+	if err != nil {
+		return Server{}, fmt.Errorf("init webhook client: %w", err)
+	}
+	webhookDispatcher, err := webhook.NewDispatcher(userRepository, webhookClient, webhook.DefaultOptions)
+	if err != nil {
+		return Server{}, fmt.Errorf("init webhook Dispatcher: %w", err)
+	}
+
+	dispatcher, err := outbox.New(userRepository, tracedEmailService, webhookService, outbox.DefaultOptions)
+	if err != nil {
+		return Server{}, fmt.Errorf("init Dispatcher: %w", err)
+	}
+
+	var sendGridWebhookKey *ecdsa.PublicKey
+	if cfg.Email.SendGridWebhookPublicKey != "" {
+		sendGridWebhookKey, err = email.ParseSendGridPublicKey(cfg.Email.SendGridWebhookPublicKey)
+		if err != nil {
+			return Server{}, fmt.Errorf("init SendGrid webhook: %w", err)
+		}
+	}
+
+	var reloader *certReloader
+	if cfg.HTTP.TLSCertFile != "" {
+		reloader, err = newCertReloader(cfg.HTTP.TLSCertFile, cfg.HTTP.TLSKeyFile, logger)
+		if err != nil {
+			return Server{}, fmt.Errorf("init TLS: %w", err)
+		}
+	}
+
+	checker, err := health.New(health.DefaultOptions)
+	if err != nil {
+		return Server{}, fmt.Errorf("init health checks: %w", err)
+	}
+	checker.Register("repository", userRepository.Ping)
+	// a provider outage only delays emails, the outbox retries them, so it doesn't take the server out of rotation
+	checker.RegisterOptional("email", emailService.Ping)
+	checker.Register("keys", func(ctx context.Context) error {
+		if cfg.Secret == "" && cfg.Tokens.KeysFile == "" {
+			return errors.New("missing token signing secret")
+		}
+		if reloader != nil {
+			return reloader.Check(ctx)
+		}
+		return nil
 	})
 
 	return Server{
-		userService:  userService,
-		emailService: emailService,
-		router:       chi.NewRouter(),
-		logger:       logger,
-		tokenAuth:    jwtauth.New("HS256", []byte(os.Getenv("SECRET")), nil),
+		config:            cfg,
+		repository:        userRepository,
+		userService:       userService,
+		emailService:      tracedEmailService,
+		sender:            sender,
+		dispatcher:        dispatcher,
+		webhookService:    webhookService,
+		webhookDispatcher: webhookDispatcher,
+		health:            checker,
+		metrics:           m,
+		tracing:           t,
+		auditSink:         auditSink,
+		auditLog:          auditLog,
+		snapshots:         snapshots,
+		router:            chi.NewRouter(),
+		logger:            logger,
+
+		sendGridWebhookKey: sendGridWebhookKey,
+		certReloader:       reloader,
 	}, nil
 }
 
-func (s *Server) Listen() error {
-	return http.ListenAndServe(fmt.Sprintf(":%s", os.Getenv("PORT")), s.router)
+// Listen serves requests and runs the background workers until ctx is done,
+// then drains connections, stops the workers and closes the repository and email sender within the shutdown timeout.
+func (s *Server) Listen(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%s", s.config.Port),
+		Handler:           s.router,
+		ReadTimeout:       s.config.HTTP.ReadTimeout,
+		ReadHeaderTimeout: s.config.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      s.config.HTTP.WriteTimeout,
+		IdleTimeout:       s.config.HTTP.IdleTimeout,
+		MaxHeaderBytes:    s.config.HTTP.MaxHeaderBytes,
+	}
+	if s.certReloader != nil {
+		srv.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certReloader.GetCertificate,
+		}
+	}
+
+	// workers stop starting work once stopped, and the work they're doing is canceled once the shutdown timeout passes
+	stop := make(chan struct{})
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+	workers := sync.WaitGroup{}
+	workers.Add(3)
+	go func() {
+		defer workers.Done()
+		s.purgeDeletedUsers(workCtx, stop, deletionWorkerInterval)
+	}()
+	go func() {
+		defer workers.Done()
+		s.dispatchOutbox(workCtx, stop, outboxWorkerInterval)
+	}()
+	go func() {
+		defer workers.Done()
+		s.dispatchWebhooks(workCtx, stop, webhookWorkerInterval)
+	}()
+	if s.snapshots != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.snapshotRepository(stop, s.config.Memory.SnapshotInterval)
+		}()
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.certReloader != nil {
+			serveErr <- srv.ListenAndServeTLS("", "")
+		} else {
+			serveErr <- srv.ListenAndServe()
+		}
+	}()
+
+	problems := make([]string, 0)
+	select {
+	case err := <-serveErr:
+		problems = append(problems, err.Error())
+	case <-ctx.Done():
+		s.logger.Info().Msg("shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.HTTP.ShutdownTimeout)
+	defer cancel()
+	context.AfterFunc(shutdownCtx, cancelWork)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		problems = append(problems, fmt.Sprintf("drain connections: %v", err))
+	}
+
+	// workers finish what they're doing before stopping
+	close(stop)
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		problems = append(problems, "stop workers: shutdown timeout exceeded")
+	}
+
+	// closing the memory repository writes its last snapshot, after the workers made their last changes
+	if err := s.repository.Close(); err != nil {
+		problems = append(problems, fmt.Sprintf("close repository: %v", err))
+	}
+	if err := closeSender(s.sender); err != nil {
+		problems = append(problems, fmt.Sprintf("close email sender: %v", err))
+	}
+	if err := s.tracing.Shutdown(shutdownCtx); err != nil {
+		problems = append(problems, fmt.Sprintf("flush traces: %v", err))
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// closeSender closes senders that keep a connection open, like the SMTP sender.
+func closeSender(sender email.Sender) error {
+	if closer, ok := sender.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
 }
 
 func (s *Server) Routes() error {
+	clientIP, err := handlers.ClientIP(s.config.HTTP.TrustedProxies)
+	if err != nil {
+		return err
+	}
+
+	s.router.Use(clientIP)
+	s.router.Use(s.tracing.Middleware)
 	s.router.Use(httplog.RequestLogger(s.logger))
+	s.router.Use(s.metrics.Middleware)
 	s.router.Use(render.SetContentType(render.ContentTypeJSON))
+	s.router.Use(handlers.AuditRequest)
+	if s.config.HTTP.RequestTimeout > 0 {
+		s.router.Use(handlers.Timeout(s.config.HTTP.RequestTimeout))
+	}
 
-	// health check
-	s.router.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("OK"))
-	})
+	// health checks, /healthz is kept for existing probes
+	s.router.Get("/livez", handlers.LivenessHandler())
+	s.router.Get("/healthz", handlers.LivenessHandler())
+	s.router.Get("/readyz", handlers.ReadinessHandler(s.health))
+	s.router.Handle("/metrics", s.metrics.Handler())
 
 	s.router.Post("/signup", handlers.SignupHandler(s.userService))
 	s.router.Post("/confirm", handlers.ConfirmHandler(s.userService))
+	s.router.With(handlers.NewRateLimiter(5, time.Hour).Handler).Post("/confirm/resend", handlers.ResendConfirmationHandler(s.userService, handlers.NewRateLimiter(5, time.Hour)))
 	s.router.Post("/login", handlers.LoginHandler(s.userService))
+	s.router.Post("/refresh", handlers.RefreshHandler(s.userService))
 	s.router.Post("/sendreset", handlers.SendResetHandler(s.userService))
 	s.router.Post("/reset", handlers.ResetHandler(s.userService))
+	s.router.With(handlers.NewRateLimiter(5, time.Hour).Handler).Post("/account/cancel-deletion", handlers.CancelDeletionHandler(s.userService, handlers.NewRateLimiter(5, time.Hour)))
+	if s.sendGridWebhookKey != nil {
+		s.router.Post("/webhooks/sendgrid", handlers.SendGridWebhookHandler(s.userService, s.sendGridWebhookKey))
+	}
 
 	s.router.Group(func(r chi.Router) {
-		r.Use(handlers.JWTAuthorizer)
+		r.Use(handlers.JWTAuthorizer(s.userService))
 
-		r.Post("/refresh", handlers.RefreshHandler(s.userService))
 		r.Post("/logout", handlers.LogoutHandler(s.userService))
+		r.Get("/me", handlers.GetProfileHandler(s.userService))
+		r.Patch("/me", handlers.UpdateProfileHandler(s.userService))
+		r.Get("/me/notifications", handlers.GetNotificationPreferencesHandler(s.userService))
+		r.Patch("/me/notifications", handlers.UpdateNotificationPreferencesHandler(s.userService))
+		r.Delete("/account", handlers.DeleteAccountHandler(s.userService))
+		r.Get("/account/export", handlers.ExportAccountHandler(s.userService))
+		if s.auditLog != nil {
+			r.Get("/account/activity", handlers.ActivityHandler(s.auditLog))
+		}
+	})
+
+	s.router.Route("/admin", func(r chi.Router) {
+		r.Use(handlers.JWTAuthorizer(s.userService))
+		r.Use(handlers.AdminAuthorizer(s.userService))
+
+		r.Get("/users", handlers.ListUsersHandler(s.userService))
+		r.Get("/users/{email}", handlers.GetUserHandler(s.userService))
+		r.Post("/users/{email}/confirm", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminConfirm, s.userService.ForceConfirm))
+		r.Post("/users/{email}/reset", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminReset, s.userService.SendReset))
+		r.Post("/users/{email}/suspend", handlers.SuspendUserHandler(s.userService, s.auditSink))
+		r.Post("/users/{email}/disable", handlers.DisableUserHandler(s.userService, s.auditSink))
+		r.Post("/users/{email}/enable", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminEnable, s.userService.EnableUser))
+		r.Post("/users/{email}/logout", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminLogout, s.userService.Logout))
+		r.Delete("/users/{email}", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminDelete, s.userService.DeleteUser))
+		r.Get("/users/{email}/email-events", handlers.ListEmailEventsHandler(s.userService))
+		r.Delete("/users/{email}/suppression", handlers.AdminActionHandler(s.auditSink, audit.TypeAdminUnsuppress, s.userService.Unsuppress))
+		if s.auditLog != nil {
+			r.Get("/audit", handlers.ListAuditEventsHandler(s.auditLog))
+		}
+
+		r.Post("/webhooks", handlers.CreateSubscriptionHandler(s.webhookService, s.auditSink))
+		r.Get("/webhooks", handlers.ListSubscriptionsHandler(s.webhookService))
+		r.Delete("/webhooks/{id}", handlers.DeleteSubscriptionHandler(s.webhookService, s.auditSink))
+		r.Get("/webhooks/{id}/deliveries", handlers.ListDeliveriesHandler(s.webhookService))
+		r.Post("/webhooks/deliveries/{id}/replay", handlers.ReplayDeliveryHandler(s.webhookService, s.auditSink))
 	})
 	return nil
 }
+
+// purgeDeletedUsers deletes users whose deletion grace period has passed every interval.
+func (s *Server) purgeDeletedUsers(ctx context.Context, stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := s.userService.PurgeDeletedUsers(ctx, time.Now())
+		if err != nil {
+			s.logger.Error().Err(err).Msg("purge deleted users")
+		} else if purged > 0 {
+			s.logger.Info().Int("purged", purged).Msg("purged deleted users")
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// snapshotRepository writes a snapshot of the repository every interval.
+func (s *Server) snapshotRepository(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		if err := s.snapshots.Snapshot(); err != nil {
+			s.logger.Error().Err(err).Msg("snapshot repository")
+		}
+	}
+}
+
+// dispatchOutbox delivers due outbox messages every interval.
+func (s *Server) dispatchOutbox(ctx context.Context, stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		claimed, err := s.dispatcher.DispatchOnce(ctx, time.Now())
+		if err != nil {
+			s.logger.Error().Err(err).Msg("dispatch outbox")
+		} else if claimed > 0 {
+			stats := s.dispatcher.Stats()
+			s.logger.Info().Int("claimed", claimed).Uint64("sent", stats.Sent).Uint64("retried", stats.Retried).Uint64("deadLettered", stats.DeadLettered).Msg("dispatched outbox")
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// dispatchWebhooks sends due webhook deliveries every interval.
+func (s *Server) dispatchWebhooks(ctx context.Context, stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		claimed, err := s.webhookDispatcher.DispatchOnce(ctx, time.Now())
+		if err != nil {
+			s.logger.Error().Err(err).Msg("dispatch webhooks")
+		} else if claimed > 0 {
+			stats := s.webhookDispatcher.Stats()
+			s.logger.Info().Int("claimed", claimed).Uint64("delivered", stats.Delivered).Uint64("retried", stats.Retried).Uint64("dead", stats.Dead).Msg("dispatched webhooks")
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
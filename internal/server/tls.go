@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// certReloader serves the certificate in certFile and keyFile,
+// reloading it when either file changes so renewed certificates don't need a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	logger   zerolog.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+func newCertReloader(certFile, keyFile string, logger zerolog.Logger) (*certReloader, error) {
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the certificate if either file changed since the last reload, and reports whether it did.
+func (r *certReloader) reload() (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("stat tls cert: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("stat tls key: %w", err)
+	}
+	if r.cert != nil && certInfo.ModTime().Equal(r.certMod) && keyInfo.ModTime().Equal(r.keyMod) {
+		return false, nil
+	}
+
+	// a half written pair is retried once the files change again
+	r.certMod = certInfo.ModTime()
+	r.keyMod = keyInfo.ModTime()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load tls key pair: %w", err)
+	}
+	r.cert = &cert
+	return true, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate, it keeps serving the last good certificate when reloading fails.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reloaded, err := r.reload()
+	if err != nil {
+		r.logger.Error().Err(err).Msg("reload tls certificate")
+	} else if reloaded {
+		r.logger.Info().Str("cert", r.certFile).Msg("reloaded tls certificate")
+	}
+	return r.cert, nil
+}
+
+// Check fails when the certificate can't be loaded or has expired, for readiness checks.
+func (r *certReloader) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.reload(); err != nil && r.cert == nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(r.cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("parse tls certificate: %w", err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("tls certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
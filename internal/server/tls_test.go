@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// writeCert writes a self signed certificate for name to certFile and keyFile, modified at modTime.
+func writeCert(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+
+	files := map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: keyDER},
+	}
+	for path, block := range files {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Chtimes: %v", err)
+		}
+	}
+}
+
+func commonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	_, err := newCertReloader(certFile, keyFile, zerolog.Nop())
+	if err == nil {
+		t.Fatalf("newCertReloader: wanted error for missing files")
+	}
+
+	writeCert(t, certFile, keyFile, "first", now.Add(-time.Hour))
+	reloader, err := newCertReloader(certFile, keyFile, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	if name := commonName(t, reloader); name != "first" {
+		t.Fatalf("certificate doesn't match: wanted %v but got %v", "first", name)
+	}
+
+	writeCert(t, certFile, keyFile, "renewed", now)
+	if name := commonName(t, reloader); name != "renewed" {
+		t.Fatalf("reloaded certificate doesn't match: wanted %v but got %v", "renewed", name)
+	}
+
+	// a broken certificate keeps the last good one
+	if err := os.WriteFile(certFile, []byte("broken"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if err := os.Chtimes(certFile, now.Add(time.Hour), now.Add(time.Hour)); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+	if name := commonName(t, reloader); name != "renewed" {
+		t.Fatalf("certificate after failed reload doesn't match: wanted %v but got %v", "renewed", name)
+	}
+}
+
+func TestCertReloaderCheck(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeCert(t, certFile, keyFile, "mimoto", time.Now())
+	reloader, err := newCertReloader(certFile, keyFile, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("newCertReloader: %v", err)
+	}
+	if err := reloader.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+
+	// certificates that can't be reloaded keep passing while the last good one is valid
+	if err := os.Remove(certFile); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := reloader.Check(context.Background()); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+}
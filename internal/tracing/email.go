@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/broswen/mimoto/internal/email"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EmailService starts a span for every email the wrapped service sends through provider.
+type EmailService struct {
+	emailService email.EmailService
+	provider     string
+	tracing      Tracing
+}
+
+func NewEmailService(emailService email.EmailService, provider string, t Tracing) (EmailService, error) {
+	return EmailService{
+		emailService: emailService,
+		provider:     provider,
+		tracing:      t,
+	}, nil
+}
+
+func (s EmailService) start(ctx context.Context, kind string) (context.Context, trace.Span) {
+	return s.tracing.start(ctx, "EmailService.Send",
+		attribute.String("mimoto.email.provider", s.provider),
+		attribute.String("mimoto.email.kind", kind),
+	)
+}
+
+func (s EmailService) SendConfirmation(ctx context.Context, to email.Recipient, code string) error {
+	ctx, span := s.start(ctx, email.KindConfirmation)
+	err := s.emailService.SendConfirmation(ctx, to, code)
+	end(span, err)
+	return err
+}
+
+func (s EmailService) SendConfirmationSuccess(ctx context.Context, to email.Recipient) error {
+	ctx, span := s.start(ctx, email.KindConfirmationSuccess)
+	err := s.emailService.SendConfirmationSuccess(ctx, to)
+	end(span, err)
+	return err
+}
+
+func (s EmailService) SendReset(ctx context.Context, to email.Recipient, code string) error {
+	ctx, span := s.start(ctx, email.KindReset)
+	err := s.emailService.SendReset(ctx, to, code)
+	end(span, err)
+	return err
+}
+
+func (s EmailService) SendSecurityNotification(ctx context.Context, to email.Recipient, kind string, activity email.Activity) error {
+	ctx, span := s.start(ctx, kind)
+	err := s.emailService.SendSecurityNotification(ctx, to, kind, activity)
+	end(span, err)
+	return err
+}
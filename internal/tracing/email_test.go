@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/email"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanEmailService records the span of the context every email is sent with.
+type spanEmailService struct {
+	spans *[]trace.SpanContext
+}
+
+func (s spanEmailService) record(ctx context.Context) error {
+	*s.spans = append(*s.spans, trace.SpanContextFromContext(ctx))
+	return nil
+}
+
+func (s spanEmailService) SendConfirmation(ctx context.Context, to email.Recipient, code string) error {
+	return s.record(ctx)
+}
+
+func (s spanEmailService) SendConfirmationSuccess(ctx context.Context, to email.Recipient) error {
+	return s.record(ctx)
+}
+
+func (s spanEmailService) SendReset(ctx context.Context, to email.Recipient, code string) error {
+	return s.record(ctx)
+}
+
+func (s spanEmailService) SendSecurityNotification(ctx context.Context, to email.Recipient, kind string, activity email.Activity) error {
+	return s.record(ctx)
+}
+
+func TestEmailService(t *testing.T) {
+	tr, recorder := newTestTracing(t)
+	spans := make([]trace.SpanContext, 0)
+	es, _ := NewEmailService(spanEmailService{spans: &spans}, "smtp", tr)
+
+	if err := es.SendReset(context.Background(), email.Recipient{Email: "test@test.com"}, "12345"); err != nil {
+		t.Fatalf("SendReset: %v", err)
+	}
+
+	span := spanNamed(t, recorder, "EmailService.Send")
+	if len(spans) != 1 || spans[0].SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("sender span doesn't match: wanted %v but got %v", span.SpanContext().SpanID(), spans)
+	}
+	want := map[attribute.Key]string{
+		"mimoto.email.provider": "smtp",
+		"mimoto.email.kind":     email.KindReset,
+	}
+	for _, kv := range span.Attributes() {
+		if value, ok := want[kv.Key]; ok && kv.Value.AsString() != value {
+			t.Fatalf("%s doesn't match: wanted %v but got %v", kv.Key, value, kv.Value.AsString())
+		}
+	}
+}
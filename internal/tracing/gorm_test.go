@@ -0,0 +1,53 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestGormPlugin(t *testing.T) {
+	tr, recorder := newTestTracing(t)
+	// dry runs build statements without a database
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if err := db.Use(tr.GormPlugin()); err != nil {
+		t.Fatalf("Use: %v", err)
+	}
+
+	ctx, parent := tr.start(context.Background(), "request")
+	var user repository.User
+	db.WithContext(ctx).Where("email = ?", "test@test.com").First(&user)
+	db.WithContext(ctx).Save(&repository.User{Email: "test@test.com"})
+	parent.End()
+
+	query := spanNamed(t, recorder, "db.select")
+	if query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("parent doesn't match: wanted %v but got %v", parent.SpanContext().SpanID(), query.Parent().SpanID())
+	}
+	var statement, system string
+	for _, kv := range query.Attributes() {
+		switch kv.Key {
+		case "db.query.text":
+			statement = kv.Value.AsString()
+		case "db.system.name":
+			system = kv.Value.AsString()
+		}
+	}
+	want := `SELECT * FROM "users" WHERE email = $1 ORDER BY "users"."email" LIMIT $2`
+	if statement != want {
+		t.Fatalf("statement doesn't match: wanted %v but got %v", want, statement)
+	}
+	if system != "postgresql" {
+		t.Fatalf("db system doesn't match: wanted %v but got %v", "postgresql", system)
+	}
+	if system := dbSystem("sqlite").Value.AsString(); system != "sqlite" {
+		t.Fatalf("db system doesn't match: wanted %v but got %v", "sqlite", system)
+	}
+	spanNamed(t, recorder, "db.update")
+}
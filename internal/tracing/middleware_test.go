@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMiddleware(t *testing.T) {
+	tr, recorder := newTestTracing(t)
+	router := chi.NewRouter()
+	router.Use(tr.Middleware)
+
+	var handlerSpan trace.SpanContext
+	router.Get("/admin/users/{email}", func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/users/test@test.com", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := spanNamed(t, recorder, "GET /admin/users/{email}")
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("trace id doesn't match: wanted %v but got %v", "4bf92f3577b34da6a3ce929d0e0e4736", got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("parent span id doesn't match: wanted %v but got %v", "00f067aa0ba902b7", got)
+	}
+	if !span.Parent().IsRemote() {
+		t.Fatalf("parent span isn't remote")
+	}
+	if handlerSpan.SpanID() != span.SpanContext().SpanID() {
+		t.Fatalf("handler span doesn't match: wanted %v but got %v", span.SpanContext().SpanID(), handlerSpan.SpanID())
+	}
+	if span.Status().Code != codes.Error {
+		t.Fatalf("status doesn't match: wanted %v but got %v", codes.Error, span.Status().Code)
+	}
+}
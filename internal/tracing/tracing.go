@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/broswen/mimoto/internal/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.39.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const instrumentationName = "github.com/broswen/mimoto"
+
+// Tracing starts the spans of every instrumented component and exports them to the configured exporter.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	shutdown   func(ctx context.Context) error
+}
+
+// New builds the exporter named in the config, "otlp", "stdout" or "none".
+// Incoming W3C traceparent headers are continued even when spans aren't exported.
+func New(cfg config.TracingConfig) (Tracing, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", "none":
+		return newTracing(noop.NewTracerProvider(), nil), nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		options := make([]otlptracehttp.Option, 0)
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return Tracing{}, fmt.Errorf("unknown tracing exporter %q, must be one of: otlp, stdout, none", cfg.Exporter)
+	}
+	if err != nil {
+		return Tracing{}, fmt.Errorf("init %s exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+	)
+	if err != nil {
+		return Tracing{}, fmt.Errorf("init tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// sampled parents are always sampled, so traces started upstream stay whole
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	return newTracing(provider, provider.Shutdown), nil
+}
+
+func newTracing(provider trace.TracerProvider, shutdown func(ctx context.Context) error) Tracing {
+	if shutdown == nil {
+		shutdown = func(ctx context.Context) error { return nil }
+	}
+	return Tracing{
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.TraceContext{},
+		shutdown:   shutdown,
+	}
+}
+
+// Shutdown exports the spans that are still buffered.
+func (t Tracing) Shutdown(ctx context.Context) error {
+	return t.shutdown(ctx)
+}
+
+func (t Tracing) start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// end records err on span before ending it.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
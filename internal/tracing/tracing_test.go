@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/config"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestTracing records every span instead of exporting it.
+func newTestTracing(t *testing.T) (Tracing, *tracetest.SpanRecorder) {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return newTracing(provider, provider.Shutdown), recorder
+}
+
+// spanNamed returns the ended span called name, failing the test if there isn't one.
+func spanNamed(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	names := make([]string, 0)
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+		names = append(names, span.Name())
+	}
+	t.Fatalf("no span named %s in %v", name, names)
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	cfg := config.Default().Tracing
+	for _, exporter := range []string{"none", "stdout", "otlp"} {
+		cfg.Exporter = exporter
+		tr, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New %s: %v", exporter, err)
+		}
+		if err := tr.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown %s: %v", exporter, err)
+		}
+	}
+
+	cfg.Exporter = "jaeger"
+	if _, err := New(cfg); err == nil {
+		t.Fatalf("New: unknown exporter didn't fail")
+	}
+}
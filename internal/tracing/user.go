@@ -0,0 +1,220 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// UserService starts a span for every method of the wrapped service, repository queries and emails sent become its children.
+type UserService struct {
+	user.UserService
+	tracing Tracing
+}
+
+func NewUserService(userService user.UserService, t Tracing) (UserService, error) {
+	return UserService{
+		UserService: userService,
+		tracing:     t,
+	}, nil
+}
+
+func (s UserService) Signup(ctx context.Context, email, name, password string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.Signup")
+	err := s.UserService.Signup(ctx, email, name, password)
+	end(span, err)
+	return err
+}
+
+func (s UserService) Confirm(ctx context.Context, email, code string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.Confirm")
+	err := s.UserService.Confirm(ctx, email, code)
+	end(span, err)
+	return err
+}
+
+func (s UserService) ResendConfirmation(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.ResendConfirmation")
+	err := s.UserService.ResendConfirmation(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) Login(ctx context.Context, email, password string, client user.Client) (string, string, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.Login", attribute.String("mimoto.audience", client.Audience))
+	token, refreshToken, err := s.UserService.Login(ctx, email, password, client)
+	end(span, err)
+	return token, refreshToken, err
+}
+
+func (s UserService) Refresh(ctx context.Context, email, token string, client user.Client) (string, string, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.Refresh")
+	newToken, refreshToken, err := s.UserService.Refresh(ctx, email, token, client)
+	end(span, err)
+	return newToken, refreshToken, err
+}
+
+func (s UserService) Logout(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.Logout")
+	err := s.UserService.Logout(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) SendReset(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.SendReset")
+	err := s.UserService.SendReset(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) ResetPassword(ctx context.Context, email, password, code string, client user.Client) error {
+	ctx, span := s.tracing.start(ctx, "UserService.ResetPassword")
+	err := s.UserService.ResetPassword(ctx, email, password, code, client)
+	end(span, err)
+	return err
+}
+
+func (s UserService) ListUsers(ctx context.Context, opts repository.ListOptions) ([]repository.User, int64, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.ListUsers")
+	users, total, err := s.UserService.ListUsers(ctx, opts)
+	end(span, err)
+	return users, total, err
+}
+
+func (s UserService) GetUser(ctx context.Context, email string) (repository.User, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.GetUser")
+	u, err := s.UserService.GetUser(ctx, email)
+	end(span, err)
+	return u, err
+}
+
+func (s UserService) IsAdmin(ctx context.Context, email string) (bool, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.IsAdmin")
+	admin, err := s.UserService.IsAdmin(ctx, email)
+	end(span, err)
+	return admin, err
+}
+
+func (s UserService) ForceConfirm(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.ForceConfirm")
+	err := s.UserService.ForceConfirm(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) CheckToken(ctx context.Context, claims user.Claims) error {
+	ctx, span := s.tracing.start(ctx, "UserService.CheckToken")
+	err := s.UserService.CheckToken(ctx, claims)
+	end(span, err)
+	return err
+}
+
+func (s UserService) SuspendUser(ctx context.Context, email, reason string, until *time.Time) error {
+	ctx, span := s.tracing.start(ctx, "UserService.SuspendUser")
+	err := s.UserService.SuspendUser(ctx, email, reason, until)
+	end(span, err)
+	return err
+}
+
+func (s UserService) DisableUser(ctx context.Context, email, reason string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.DisableUser")
+	err := s.UserService.DisableUser(ctx, email, reason)
+	end(span, err)
+	return err
+}
+
+func (s UserService) EnableUser(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.EnableUser")
+	err := s.UserService.EnableUser(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) DeleteUser(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.DeleteUser")
+	err := s.UserService.DeleteUser(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) ScheduleDeletion(ctx context.Context, email, password string) (time.Time, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.ScheduleDeletion")
+	deletionAt, err := s.UserService.ScheduleDeletion(ctx, email, password)
+	end(span, err)
+	return deletionAt, err
+}
+
+func (s UserService) CancelDeletion(ctx context.Context, email, password string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.CancelDeletion")
+	err := s.UserService.CancelDeletion(ctx, email, password)
+	end(span, err)
+	return err
+}
+
+func (s UserService) PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.PurgeDeletedUsers")
+	purged, err := s.UserService.PurgeDeletedUsers(ctx, now)
+	end(span, err)
+	return purged, err
+}
+
+func (s UserService) ExportUser(ctx context.Context, email string) (user.Export, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.ExportUser")
+	export, err := s.UserService.ExportUser(ctx, email)
+	end(span, err)
+	return export, err
+}
+
+func (s UserService) GetProfile(ctx context.Context, email string) (user.Profile, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.GetProfile")
+	profile, err := s.UserService.GetProfile(ctx, email)
+	end(span, err)
+	return profile, err
+}
+
+func (s UserService) UpdateProfile(ctx context.Context, email string, update user.ProfileUpdate) (user.Profile, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.UpdateProfile")
+	profile, err := s.UserService.UpdateProfile(ctx, email, update)
+	end(span, err)
+	return profile, err
+}
+
+func (s UserService) RecordEmailEvents(ctx context.Context, events []email.Event) error {
+	ctx, span := s.tracing.start(ctx, "UserService.RecordEmailEvents")
+	err := s.UserService.RecordEmailEvents(ctx, events)
+	end(span, err)
+	return err
+}
+
+func (s UserService) ListEmailEvents(ctx context.Context, email string) ([]repository.EmailEvent, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.ListEmailEvents")
+	events, err := s.UserService.ListEmailEvents(ctx, email)
+	end(span, err)
+	return events, err
+}
+
+func (s UserService) Unsuppress(ctx context.Context, email string) error {
+	ctx, span := s.tracing.start(ctx, "UserService.Unsuppress")
+	err := s.UserService.Unsuppress(ctx, email)
+	end(span, err)
+	return err
+}
+
+func (s UserService) GetNotificationPreferences(ctx context.Context, email string) (user.NotificationPreferences, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.GetNotificationPreferences")
+	prefs, err := s.UserService.GetNotificationPreferences(ctx, email)
+	end(span, err)
+	return prefs, err
+}
+
+func (s UserService) UpdateNotificationPreferences(ctx context.Context, email string, update user.NotificationPreferences) (user.NotificationPreferences, error) {
+	ctx, span := s.tracing.start(ctx, "UserService.UpdateNotificationPreferences")
+	prefs, err := s.UserService.UpdateNotificationPreferences(ctx, email, update)
+	end(span, err)
+	return prefs, err
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/user"
+	"go.opentelemetry.io/otel/codes"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUserService(t *testing.T) {
+	tr, recorder := newTestTracing(t)
+	ur, _ := repository.NewMap()
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	service, err := user.New(ur, user.BcryptHasher{Cost: bcrypt.MinCost}, nil, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	us, _ := NewUserService(service, tr)
+
+	ctx, parent := tr.start(context.Background(), "request")
+	if err := us.Signup(ctx, "test@test.com", "test", "password"); err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	if _, _, err := us.Login(ctx, "test@test.com", "password", user.Client{}); err == nil {
+		t.Fatalf("Login: unconfirmed user logged in")
+	}
+	parent.End()
+
+	signup := spanNamed(t, recorder, "UserService.Signup")
+	if signup.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatalf("parent doesn't match: wanted %v but got %v", parent.SpanContext().SpanID(), signup.Parent().SpanID())
+	}
+	if signup.Status().Code != codes.Unset {
+		t.Fatalf("signup status doesn't match: wanted %v but got %v", codes.Unset, signup.Status().Code)
+	}
+	login := spanNamed(t, recorder, "UserService.Login")
+	if login.Status().Code != codes.Error {
+		t.Fatalf("login status doesn't match: wanted %v but got %v", codes.Error, login.Status().Code)
+	}
+}
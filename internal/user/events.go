@@ -0,0 +1,47 @@
+package user
+
+import (
+	"context"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+// RecordEmailEvents stores provider delivery events and suppresses addresses that hard bounced,
+// were dropped or reported spam. Events already recorded are ignored.
+func (s Service) RecordEmailEvents(ctx context.Context, events []email.Event) error {
+	for _, e := range events {
+		event := repository.EmailEvent{
+			Email:           e.Email,
+			Type:            e.Type,
+			Reason:          e.Reason,
+			Provider:        e.Provider,
+			ProviderEventID: e.ID,
+			OccurredAt:      e.Timestamp,
+		}
+		if err := s.userRepository.CreateEmailEvent(ctx, &event); err != nil {
+			return err
+		}
+		if e.Suppresses() {
+			if err := s.userRepository.Suppress(ctx, e.Email, e.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s Service) ListEmailEvents(ctx context.Context, email string) ([]repository.EmailEvent, error) {
+	if _, err := s.userRepository.FindByEmail(ctx, email); err != nil {
+		return nil, err
+	}
+	return s.userRepository.ListEmailEvents(ctx, email)
+}
+
+// Unsuppress lets emails be sent to the user again, e.g. after they fixed their mailbox.
+func (s Service) Unsuppress(ctx context.Context, email string) error {
+	if _, err := s.userRepository.FindByEmail(ctx, email); err != nil {
+		return err
+	}
+	return s.userRepository.Unsuppress(ctx, email)
+}
@@ -0,0 +1,66 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+func TestRecordEmailEvents(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	events := []email.Event{
+		{Provider: "sendgrid", ID: "1", Email: "test@test.com", Type: email.EventDelivered, Timestamp: time.Now().Add(-time.Minute)},
+		{Provider: "sendgrid", ID: "2", Email: "test@test.com", Type: email.EventBounce, Hard: true, Reason: "550 no such user", Timestamp: time.Now()},
+	}
+	err = us.RecordEmailEvents(ctx, events)
+	if err != nil {
+		t.Fatalf("RecordEmailEvents: %v", err)
+	}
+	// webhook retries are ignored
+	err = us.RecordEmailEvents(ctx, events)
+	if err != nil {
+		t.Fatalf("RecordEmailEvents: %v", err)
+	}
+
+	recorded, err := us.ListEmailEvents(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ListEmailEvents: %v", err)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("wanted %v events but got %v", 2, len(recorded))
+	}
+
+	export, err := us.ExportUser(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ExportUser: %v", err)
+	}
+	if !export.Account.EmailSuppressed || len(export.EmailEvents) != 2 {
+		t.Fatalf("unexpected export: %+v", export)
+	}
+
+	err = us.Unsuppress(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("Unsuppress: %v", err)
+	}
+	suppressed, _ := ur.IsSuppressed(ctx, "test@test.com")
+	if suppressed {
+		t.Fatalf("suppressed doesn't match: wanted %v but got %v", false, suppressed)
+	}
+
+	_, err = us.ListEmailEvents(ctx, "missing@test.com")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("ListEmailEvents error doesn't match: wanted %v but got %v", repository.ErrUserNotFound, err)
+	}
+}
@@ -0,0 +1,148 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+const maxKnownDevices = 10
+
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// optionalNotifications are the security notifications users can opt out of,
+// every other kind is always sent.
+var optionalNotifications = map[string]bool{
+	email.KindNewDeviceLogin: true,
+}
+
+// Client is where a request came from, included in security notifications.
+type Client struct {
+	IP        string
+	UserAgent string
+	// Audience selects the token policy at login, the default audience if it's empty.
+	Audience string
+}
+
+// NotificationPreferences maps every security notification kind to whether it's sent.
+type NotificationPreferences map[string]bool
+
+func optOuts(user repository.User) map[string]bool {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Split(user.NotificationOptOuts, ",") {
+		if kind != "" {
+			kinds[kind] = true
+		}
+	}
+	return kinds
+}
+
+func newNotificationPreferences(user repository.User) NotificationPreferences {
+	disabled := optOuts(user)
+	prefs := make(NotificationPreferences)
+	for _, kind := range email.SecurityKinds {
+		prefs[kind] = !disabled[kind]
+	}
+	return prefs
+}
+
+func (s Service) GetNotificationPreferences(ctx context.Context, address string) (NotificationPreferences, error) {
+	user, err := s.userRepository.FindByEmail(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return newNotificationPreferences(user), nil
+}
+
+// UpdateNotificationPreferences changes the kinds in update and leaves the rest as they are.
+// Only optional notifications can be disabled.
+func (s Service) UpdateNotificationPreferences(ctx context.Context, address string, update NotificationPreferences) (NotificationPreferences, error) {
+	user, err := s.userRepository.FindByEmail(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	disabled := optOuts(user)
+	for kind, enabled := range update {
+		if !email.IsSecurityKind(kind) {
+			return nil, fmt.Errorf("%w: unknown notification %s", ErrInvalidPreferences, kind)
+		}
+		if !enabled && !optionalNotifications[kind] {
+			return nil, fmt.Errorf("%w: %s can't be disabled", ErrInvalidPreferences, kind)
+		}
+		disabled[kind] = !enabled
+	}
+
+	kinds := make([]string, 0, len(disabled))
+	for _, kind := range email.SecurityKinds {
+		if disabled[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	user.NotificationOptOuts = strings.Join(kinds, ",")
+	err = s.userRepository.Save(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	return newNotificationPreferences(user), nil
+}
+
+// securityEmails returns the notification of kind for the user, or nothing if they opted out of it.
+func securityEmails(kind string, user repository.User, client Client, now time.Time) []repository.OutboxMessage {
+	if optOuts(user)[kind] {
+		return nil
+	}
+	msg := newEmail(kind, user, generateCode(), map[string]string{
+		"time":      now.UTC().Format(time.RFC3339),
+		"ip":        client.IP,
+		"userAgent": client.UserAgent,
+	})
+	return []repository.OutboxMessage{msg}
+}
+
+func newDeviceLoginEmails(user repository.User, client Client, now time.Time) []repository.OutboxMessage {
+	return securityEmails(email.KindNewDeviceLogin, user, client, now)
+}
+
+func passwordChangedEmails(user repository.User, client Client, now time.Time) []repository.OutboxMessage {
+	return securityEmails(email.KindPasswordChanged, user, client, now)
+}
+
+func accountLockedEmails(user repository.User, now time.Time) []repository.OutboxMessage {
+	return securityEmails(email.KindAccountLocked, user, Client{}, now)
+}
+
+func refreshTokenReuseEmails(user repository.User, client Client, now time.Time) []repository.OutboxMessage {
+	return securityEmails(email.KindRefreshTokenReuse, user, client, now)
+}
+
+// rememberDevice adds the client's user agent to the user's known devices
+// and reports whether it's new, forgetting the oldest device once there are too many.
+func rememberDevice(user *repository.User, client Client) bool {
+	hash := sha256.Sum256([]byte(client.UserAgent))
+	device := hex.EncodeToString(hash[:8])
+
+	devices := make([]string, 0)
+	if user.KnownDevices != "" {
+		devices = strings.Split(user.KnownDevices, ",")
+	}
+	for _, known := range devices {
+		if known == device {
+			return false
+		}
+	}
+
+	devices = append(devices, device)
+	if len(devices) > maxKnownDevices {
+		devices = devices[len(devices)-maxKnownDevices:]
+	}
+	user.KnownDevices = strings.Join(devices, ",")
+	return true
+}
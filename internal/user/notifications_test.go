@@ -0,0 +1,187 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+func newConfirmedUser(t *testing.T, us Service, address string) repository.User {
+	t.Helper()
+	ctx := context.Background()
+	err := us.Signup(ctx, address, "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	user, _ := us.userRepository.FindByEmail(ctx, address)
+	err = us.Confirm(ctx, address, user.ConfirmationCode)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	user, _ = us.userRepository.FindByEmail(ctx, address)
+	return user
+}
+
+func TestNewDeviceLogin(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	laptop := Client{IP: "203.0.113.1", UserAgent: "laptop"}
+	phone := Client{IP: "203.0.113.2", UserAgent: "phone"}
+	for i, client := range []Client{laptop, laptop, phone, phone} {
+		_, _, err := us.Login(ctx, user.Email, "password", client)
+		if err != nil {
+			t.Fatalf("Login %d: %v", i+1, err)
+		}
+	}
+
+	// only the first login from the phone is from a new device
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindNewDeviceLogin] != 1 {
+		t.Fatalf("new device login emails don't match: wanted %v but got %v", 1, kinds[email.KindNewDeviceLogin])
+	}
+
+	_, err := us.UpdateNotificationPreferences(ctx, user.Email, NotificationPreferences{email.KindNewDeviceLogin: false})
+	if err != nil {
+		t.Fatalf("UpdateNotificationPreferences: %v", err)
+	}
+	_, _, err = us.Login(ctx, user.Email, "password", Client{UserAgent: "tablet"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindNewDeviceLogin] != 1 {
+		t.Fatalf("new device login email was sent after opting out")
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	_, refreshToken, err := us.Login(ctx, user.Email, "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, rotated, err := us.Refresh(ctx, user.Email, refreshToken, Client{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if rotated == refreshToken {
+		t.Fatalf("refresh token wasn't rotated")
+	}
+
+	// a concurrent refresh with the old token gets the rotated one
+	_, current, err := us.Refresh(ctx, user.Email, refreshToken, Client{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if current != rotated {
+		t.Fatalf("refresh token doesn't match: wanted %v but got %v", rotated, current)
+	}
+
+	// past the grace period it's reuse
+	user, _ = ur.FindByEmail(ctx, user.Email)
+	session := user.Sessions["mimoto"]
+	session.RefreshedAt = session.RefreshedAt.Add(-time.Minute)
+	user.Sessions["mimoto"] = session
+	ur.Save(ctx, &user)
+
+	_, _, err = us.Refresh(ctx, user.Email, refreshToken, Client{IP: "198.51.100.1"})
+	if !errors.Is(err, ErrRefreshTokenReuse) {
+		t.Fatalf("Refresh error doesn't match: wanted %v but got %v", ErrRefreshTokenReuse, err)
+	}
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindRefreshTokenReuse] != 1 {
+		t.Fatalf("refresh token reuse email wasn't enqueued: %v", kinds)
+	}
+
+	// every session is signed out
+	_, _, err = us.Refresh(ctx, user.Email, rotated, Client{})
+	if err == nil {
+		t.Fatalf("Refresh: wanted an error for a revoked refresh token")
+	}
+}
+
+func TestSecurityNotifications(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	err := us.SendReset(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("SendReset: %v", err)
+	}
+	user, _ = ur.FindByEmail(ctx, user.Email)
+	err = us.ResetPassword(ctx, user.Email, "newpassword", user.ResetCode, Client{IP: "203.0.113.1", UserAgent: "laptop"})
+	if err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	err = us.DisableUser(ctx, user.Email, "spam")
+	if err != nil {
+		t.Fatalf("DisableUser: %v", err)
+	}
+
+	kinds := outboxKinds(ur, user.Email)
+	if kinds[email.KindPasswordChanged] != 1 || kinds[email.KindAccountLocked] != 1 {
+		t.Fatalf("security notifications weren't enqueued: %v", kinds)
+	}
+	for _, msg := range ur.OutboxMessages() {
+		if msg.Kind == email.KindPasswordChanged && msg.Payload == "" {
+			t.Fatalf("password changed email is missing the activity: %+v", msg)
+		}
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	prefs, err := us.GetNotificationPreferences(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("GetNotificationPreferences: %v", err)
+	}
+	for _, kind := range email.SecurityKinds {
+		if !prefs[kind] {
+			t.Fatalf("%s isn't enabled by default", kind)
+		}
+	}
+
+	prefs, err = us.UpdateNotificationPreferences(ctx, user.Email, NotificationPreferences{email.KindNewDeviceLogin: false})
+	if err != nil {
+		t.Fatalf("UpdateNotificationPreferences: %v", err)
+	}
+	if prefs[email.KindNewDeviceLogin] || !prefs[email.KindPasswordChanged] {
+		t.Fatalf("unexpected preferences: %v", prefs)
+	}
+
+	for _, update := range []NotificationPreferences{
+		{email.KindPasswordChanged: false},
+		{"unknown": true},
+	} {
+		_, err = us.UpdateNotificationPreferences(ctx, user.Email, update)
+		if !errors.Is(err, ErrInvalidPreferences) {
+			t.Fatalf("UpdateNotificationPreferences error doesn't match: wanted %v but got %v", ErrInvalidPreferences, err)
+		}
+	}
+
+	// critical notifications can still be enabled
+	_, err = us.UpdateNotificationPreferences(ctx, user.Email, NotificationPreferences{email.KindPasswordChanged: true, email.KindNewDeviceLogin: true})
+	if err != nil {
+		t.Fatalf("UpdateNotificationPreferences: %v", err)
+	}
+	user, _ = ur.FindByEmail(ctx, user.Email)
+	if user.NotificationOptOuts != "" {
+		t.Fatalf("opt outs don't match: wanted %q but got %q", "", user.NotificationOptOuts)
+	}
+}
@@ -0,0 +1,31 @@
+package user
+
+import "golang.org/x/crypto/bcrypt"
+
+// PasswordHasher hashes passwords and checks them against their hash.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) error
+}
+
+// BcryptHasher hashes passwords with bcrypt, a zero Cost uses bcrypt.DefaultCost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	cost := h.Cost
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// Compare returns bcrypt.ErrMismatchedHashAndPassword if password doesn't match hash.
+func (h BcryptHasher) Compare(hash, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+}
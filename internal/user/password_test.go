@@ -0,0 +1,22 @@
+package user
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBcryptHasher(t *testing.T) {
+	hasher := BcryptHasher{Cost: bcrypt.MinCost}
+	hash, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if err := hasher.Compare(hash, "password"); err != nil {
+		t.Fatalf("Compare: %v", err)
+	}
+	if err := hasher.Compare(hash, "wrong"); !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		t.Fatalf("Compare error doesn't match: wanted %v but got %v", bcrypt.ErrMismatchedHashAndPassword, err)
+	}
+}
@@ -0,0 +1,178 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"golang.org/x/text/language"
+)
+
+const (
+	maxNameLength      = 100
+	maxAvatarURLLength = 2048
+	maxMetadataSize    = 4096
+)
+
+var ErrInvalidProfile = errors.New("invalid profile")
+
+type Profile struct {
+	Email     string          `json:"email"`
+	Name      string          `json:"name"`
+	Locale    string          `json:"locale,omitempty"`
+	Timezone  string          `json:"timezone,omitempty"`
+	AvatarURL string          `json:"avatarUrl,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+}
+
+func newProfile(user repository.User) Profile {
+	profile := Profile{
+		Email:     user.Email,
+		Name:      user.Name,
+		Locale:    user.Locale,
+		Timezone:  user.Timezone,
+		AvatarURL: user.AvatarURL,
+	}
+	if user.Metadata != "" {
+		profile.Metadata = json.RawMessage(user.Metadata)
+	}
+	return profile
+}
+
+// ProfileUpdate holds the profile fields to change, nil fields are left as is.
+// Empty strings and a null Metadata clear the optional attributes.
+type ProfileUpdate struct {
+	Name      *string
+	Locale    *string
+	Timezone  *string
+	AvatarURL *string
+	Metadata  json.RawMessage
+}
+
+func (s Service) GetProfile(ctx context.Context, email string) (Profile, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return Profile{}, err
+	}
+	return newProfile(user), nil
+}
+
+func (s Service) UpdateProfile(ctx context.Context, email string, update ProfileUpdate) (Profile, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if update.Name != nil {
+		name, err := validateName(*update.Name)
+		if err != nil {
+			return Profile{}, err
+		}
+		user.Name = name
+	}
+	if update.Locale != nil {
+		locale, err := validateLocale(*update.Locale)
+		if err != nil {
+			return Profile{}, err
+		}
+		user.Locale = locale
+	}
+	if update.Timezone != nil {
+		if err := validateTimezone(*update.Timezone); err != nil {
+			return Profile{}, err
+		}
+		user.Timezone = *update.Timezone
+	}
+	if update.AvatarURL != nil {
+		if err := validateAvatarURL(*update.AvatarURL); err != nil {
+			return Profile{}, err
+		}
+		user.AvatarURL = *update.AvatarURL
+	}
+	if update.Metadata != nil {
+		metadata, err := validateMetadata(update.Metadata)
+		if err != nil {
+			return Profile{}, err
+		}
+		user.Metadata = metadata
+	}
+
+	err = s.userRepository.Save(ctx, &user)
+	if err != nil {
+		return Profile{}, err
+	}
+	return newProfile(user), nil
+}
+
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%w: name can't be empty", ErrInvalidProfile)
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return "", fmt.Errorf("%w: name is longer than %d characters", ErrInvalidProfile, maxNameLength)
+	}
+	return name, nil
+}
+
+// validateLocale returns the canonical BCP 47 form of locale.
+func validateLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("%w: locale %q isn't a BCP 47 language tag", ErrInvalidProfile, locale)
+	}
+	return tag.String(), nil
+}
+
+func validateTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("%w: timezone %q isn't an IANA time zone", ErrInvalidProfile, timezone)
+	}
+	return nil
+}
+
+func validateAvatarURL(avatarURL string) error {
+	if avatarURL == "" {
+		return nil
+	}
+	if len(avatarURL) > maxAvatarURLLength {
+		return fmt.Errorf("%w: avatar url is longer than %d characters", ErrInvalidProfile, maxAvatarURLLength)
+	}
+	u, err := url.Parse(avatarURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: avatar url must be an absolute http or https url", ErrInvalidProfile)
+	}
+	return nil
+}
+
+// validateMetadata returns the compacted metadata, which must be a JSON object or null.
+func validateMetadata(metadata json.RawMessage) (string, error) {
+	if len(metadata) > maxMetadataSize {
+		return "", fmt.Errorf("%w: metadata is larger than %d bytes", ErrInvalidProfile, maxMetadataSize)
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(metadata, &object); err != nil {
+		return "", fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidProfile)
+	}
+	if object == nil {
+		return "", nil
+	}
+	compacted := bytes.Buffer{}
+	if err := json.Compact(&compacted, metadata); err != nil {
+		return "", err
+	}
+	return compacted.String(), nil
+}
@@ -0,0 +1,99 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+func TestProfile(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	name := " new name "
+	locale := "en-us"
+	timezone := "America/New_York"
+	avatarURL := "https://example.com/avatar.png"
+	profile, err := us.UpdateProfile(ctx, "test@test.com", ProfileUpdate{
+		Name:      &name,
+		Locale:    &locale,
+		Timezone:  &timezone,
+		AvatarURL: &avatarURL,
+		Metadata:  json.RawMessage(`{ "theme": "dark" }`),
+	})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if profile.Name != "new name" {
+		t.Fatalf("name doesn't match: wanted %v but got %v", "new name", profile.Name)
+	}
+	if profile.Locale != "en-US" {
+		t.Fatalf("locale doesn't match: wanted %v but got %v", "en-US", profile.Locale)
+	}
+	if string(profile.Metadata) != `{"theme":"dark"}` {
+		t.Fatalf("metadata doesn't match: wanted %v but got %v", `{"theme":"dark"}`, string(profile.Metadata))
+	}
+
+	profile, err = us.GetProfile(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("GetProfile: %v", err)
+	}
+	if profile.Timezone != timezone || profile.AvatarURL != avatarURL {
+		t.Fatalf("GetProfile: unexpected profile %+v", profile)
+	}
+
+	profile, err = us.UpdateProfile(ctx, "test@test.com", ProfileUpdate{
+		Metadata: json.RawMessage(`null`),
+	})
+	if err != nil {
+		t.Fatalf("UpdateProfile: %v", err)
+	}
+	if profile.Metadata != nil {
+		t.Fatalf("metadata wasn't cleared: %v", string(profile.Metadata))
+	}
+
+	invalid := "not a timezone"
+	badURL := "javascript:alert(1)"
+	empty := " "
+	for _, update := range []ProfileUpdate{
+		{Name: &empty},
+		{Locale: &invalid},
+		{Timezone: &invalid},
+		{AvatarURL: &badURL},
+		{Metadata: json.RawMessage(`[1, 2]`)},
+	} {
+		_, err = us.UpdateProfile(ctx, "test@test.com", update)
+		if !errors.Is(err, ErrInvalidProfile) {
+			t.Fatalf("UpdateProfile: wanted %v but got %v", ErrInvalidProfile, err)
+		}
+	}
+}
+
+func TestSignupName(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	for _, name := range []string{"   ", strings.Repeat("a", maxNameLength+1)} {
+		if err := us.Signup(ctx, "test@test.com", name, "password"); !errors.Is(err, ErrInvalidProfile) {
+			t.Fatalf("Signup: wanted %v but got %v", ErrInvalidProfile, err)
+		}
+	}
+
+	if err := us.Signup(ctx, "test@test.com", " test ", "password"); err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	if user, _ := ur.FindByEmail(ctx, "test@test.com"); user.Name != "test" {
+		t.Fatalf("name doesn't match: wanted %v but got %v", "test", user.Name)
+	}
+}
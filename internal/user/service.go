@@ -1,43 +1,200 @@
 package user
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math/rand"
-	"os"
+	"sort"
 	"time"
 
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/config"
 	"github.com/broswen/mimoto/internal/email"
+	"github.com/broswen/mimoto/internal/keys"
 	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
 	"github.com/gofrs/uuid"
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type UserService interface {
-	Signup(email, name, password string) error
-	Confirm(email, code string) error
-	Login(email, password string) (string, string, error)
-	Refresh(email, token string) (string, error)
-	Logout(email string) error
-	SendReset(email string) error
-	ResetPassword(email, password, code string) error
+	Signup(ctx context.Context, email, name, password string) error
+	Confirm(ctx context.Context, email, code string) error
+	ResendConfirmation(ctx context.Context, email string) error
+	Login(ctx context.Context, email, password string, client Client) (string, string, error)
+	Refresh(ctx context.Context, email, token string, client Client) (string, string, error)
+	ParseToken(tokenString string) (*jwt.Token, Claims, error)
+	ParseRefreshToken(tokenString string) (*jwt.Token, Claims, error)
+	Logout(ctx context.Context, email string) error
+	SendReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, email, password, code string, client Client) error
+
+	ListUsers(ctx context.Context, opts repository.ListOptions) ([]repository.User, int64, error)
+	GetUser(ctx context.Context, email string) (repository.User, error)
+	IsAdmin(ctx context.Context, email string) (bool, error)
+	ForceConfirm(ctx context.Context, email string) error
+	CheckToken(ctx context.Context, claims Claims) error
+	SuspendUser(ctx context.Context, email, reason string, until *time.Time) error
+	DisableUser(ctx context.Context, email, reason string) error
+	EnableUser(ctx context.Context, email string) error
+	DeleteUser(ctx context.Context, email string) error
+
+	ScheduleDeletion(ctx context.Context, email, password string) (time.Time, error)
+	CancelDeletion(ctx context.Context, email, password string) error
+	PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error)
+	ExportUser(ctx context.Context, email string) (Export, error)
+
+	GetProfile(ctx context.Context, email string) (Profile, error)
+	UpdateProfile(ctx context.Context, email string, update ProfileUpdate) (Profile, error)
+
+	RecordEmailEvents(ctx context.Context, events []email.Event) error
+	ListEmailEvents(ctx context.Context, email string) ([]repository.EmailEvent, error)
+	Unsuppress(ctx context.Context, email string) error
+
+	GetNotificationPreferences(ctx context.Context, email string) (NotificationPreferences, error)
+	UpdateNotificationPreferences(ctx context.Context, email string, update NotificationPreferences) (NotificationPreferences, error)
+}
+
+const confirmationResendCooldown = time.Minute
+
+var (
+	ErrNotConfirmed           = errors.New("account is not confirmed")
+	ErrRefreshTokenReuse      = errors.New("refresh token was already used")
+	ErrAccountSuspended       = errors.New("account is suspended")
+	ErrAccountDisabled        = errors.New("account is disabled")
+	ErrAccountPendingDeletion = errors.New("account is pending deletion")
+	// ErrInvalidCredentials is returned for unknown emails and wrong passwords alike, so logins don't reveal which accounts exist.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+// invalidCredentials is ErrInvalidCredentials, it keeps why the credentials were rejected for metrics
+// without putting it in the message.
+type invalidCredentials struct {
+	cause error
+}
+
+func (e invalidCredentials) Error() string {
+	return ErrInvalidCredentials.Error()
+}
+
+func (e invalidCredentials) Is(target error) bool {
+	return target == ErrInvalidCredentials
+}
+
+func (e invalidCredentials) Unwrap() error {
+	return e.cause
+}
+
+// missingUserHash is compared against for unknown emails, so they take as long to reject as wrong passwords.
+const missingUserHash = "$2a$10$Ds/pGQ0EF7DVy0H0l5ED6OsWbP0kLq8GXOWyYKKfXBNWEZuxVURS6"
+
+// statusError returns the error for users that aren't allowed to authenticate.
+func statusError(user repository.User) error {
+	switch user.EffectiveStatus(time.Now()) {
+	case repository.StatusActive:
+		return nil
+	case repository.StatusSuspended:
+		if user.SuspendedUntil != nil {
+			return fmt.Errorf("%w until %s", ErrAccountSuspended, user.SuspendedUntil.Format(time.RFC3339))
+		}
+		return ErrAccountSuspended
+	case repository.StatusDisabled:
+		return ErrAccountDisabled
+	case repository.StatusPendingDeletion:
+		return ErrAccountPendingDeletion
+	}
+	return fmt.Errorf("unknown account status: %s", user.Status)
 }
 
 type Service struct {
 	userRepository repository.UserRepository
-	emailService   email.EmailService
+	hasher         PasswordHasher
+	auditSink      audit.AuditSink
+	// auditLog is auditSink if it can be queried, for exports and erasing deleted accounts.
+	auditLog            audit.AuditLog
+	secret              []byte
+	keyring             keys.Keyring
+	tokens              config.TokensConfig
+	deletionGracePeriod time.Duration
 }
 
-func New(userRepository repository.UserRepository, emailService email.EmailService) (Service, error) {
+// New builds a Service that hashes passwords with hasher, or bcrypt if it's nil,
+// and records security events in auditSink, or nowhere if it's nil.
+func New(userRepository repository.UserRepository, hasher PasswordHasher, auditSink audit.AuditSink, cfg config.Config) (Service, error) {
 	rand.Seed(time.Now().Unix())
+
+	var keyring keys.Keyring
+	if cfg.Tokens.KeysFile != "" {
+		var err error
+		if keyring, err = keys.Load(cfg.Tokens.KeysFile); err != nil {
+			return Service{}, fmt.Errorf("load token keys: %w", err)
+		}
+		if _, err := keyring.Active(); err != nil {
+			return Service{}, fmt.Errorf("load token keys: %w", err)
+		}
+	} else if cfg.Secret == "" {
+		return Service{}, errors.New("missing token secret")
+	}
+
+	if hasher == nil {
+		hasher = BcryptHasher{}
+	}
+	auditLog, _ := auditSink.(audit.AuditLog)
+
 	return Service{
-		userRepository: userRepository,
-		emailService:   emailService,
+		userRepository:      userRepository,
+		hasher:              hasher,
+		auditSink:           auditSink,
+		auditLog:            auditLog,
+		secret:              []byte(cfg.Secret),
+		keyring:             keyring,
+		tokens:              cfg.Tokens,
+		deletionGracePeriod: cfg.DeletionGracePeriod,
 	}, nil
 }
 
-func (s Service) Signup(email, name, password string) error {
-	user, err := s.userRepository.FindByEmail(email)
+// record writes an audit event about subject, failing to write it doesn't fail the action.
+func (s Service) record(ctx context.Context, eventType, subject string, err error) {
+	if s.auditSink == nil {
+		return
+	}
+	// the event is written even if the request was cancelled
+	s.auditSink.Write(context.WithoutCancel(ctx), audit.NewEvent(ctx, eventType, subject, err))
+}
+
+func (s Service) Signup(ctx context.Context, email, name, password string) (err error) {
+	defer func() { s.record(ctx, audit.TypeSignup, email, err) }()
+
+	return s.create(ctx, NewUser{Email: email, Name: name, Password: password})
+}
+
+// NewUser is a user created by an operator with CreateUser.
+type NewUser struct {
+	Email    string
+	Name     string
+	Password string
+	Role     string
+	// Confirmed users are created confirmed, without a confirmation email.
+	Confirmed bool
+}
+
+// CreateUser creates a user for operators, its role and confirmation are written with it.
+func (s Service) CreateUser(ctx context.Context, newUser NewUser) (err error) {
+	defer func() { s.record(ctx, audit.TypeSignup, newUser.Email, err) }()
+
+	return s.create(ctx, newUser)
+}
+
+func (s Service) create(ctx context.Context, newUser NewUser) error {
+	// names are held to the same rules as profile updates
+	name, err := validateName(newUser.Name)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepository.FindByEmail(ctx, newUser.Email)
 	if err == nil {
 		return errors.New("user already exists with that email")
 	}
@@ -47,29 +204,57 @@ func (s Service) Signup(email, name, password string) error {
 	}
 
 	user = repository.User{
-		Email: email,
-		Name:  name,
+		Email:           newUser.Email,
+		Name:            name,
+		Role:            newUser.Role,
+		Status:          repository.StatusActive,
+		StatusChangedAt: time.Now(),
 	}
 
 	// hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(newUser.Password)
 	if err != nil {
 		return err
 	}
-	user.HashedPassword = string(hashedPassword)
+	user.HashedPassword = hashedPassword
+
+	if newUser.Confirmed {
+		user.Confirmed = true
+		return s.userRepository.Create(ctx, &user, webhookEvent(webhook.EventUserCreated, user, nil), webhookEvent(webhook.EventUserConfirmed, user, nil))
+	}
+
 	code := generateCode()
 	user.ConfirmationCode = code
-	err = s.userRepository.Create(&user)
-	if err != nil {
-		return err
-	}
+	user.ConfirmationSent = time.Now()
 
-	// send confirmation email
-	err = s.emailService.SendConfirmation(name, email, code)
-	if err != nil {
-		return err
+	// the confirmation email is sent by the outbox dispatcher
+	return s.userRepository.Create(ctx, &user, confirmationEmail(user, code), webhookEvent(webhook.EventUserCreated, user, nil))
+}
+
+func confirmationEmail(user repository.User, code string) repository.OutboxMessage {
+	return newEmail(email.KindConfirmation, user, code, map[string]string{"code": code})
+}
+
+func confirmationSuccessEmail(user repository.User, code string) repository.OutboxMessage {
+	return newEmail(email.KindConfirmationSuccess, user, code, nil)
+}
+
+func resetEmail(user repository.User, code string) repository.OutboxMessage {
+	return newEmail(email.KindReset, user, code, map[string]string{"code": code})
+}
+
+// newEmail builds an outbox message for the user, idempotencyKey must be unique to this email.
+func newEmail(kind string, user repository.User, idempotencyKey string, payload map[string]string) repository.OutboxMessage {
+	b, _ := json.Marshal(payload)
+	return repository.OutboxMessage{
+		IdempotencyKey: kind + ":" + idempotencyKey,
+		Kind:           kind,
+		Name:           user.Name,
+		Email:          user.Email,
+		Locale:         user.Locale,
+		Timezone:       user.Timezone,
+		Payload:        string(b),
 	}
-	return nil
 }
 
 func generateCode() string {
@@ -77,9 +262,11 @@ func generateCode() string {
 	return id.String()
 }
 
-func (s Service) Confirm(email, code string) error {
+func (s Service) Confirm(ctx context.Context, email, code string) (err error) {
+	defer func() { s.record(ctx, audit.TypeConfirm, email, err) }()
+
 	// get user from repo, throw error if not exists
-	user, err := s.userRepository.FindByEmail(email)
+	user, err := s.userRepository.FindByEmail(ctx, email)
 
 	if err != nil {
 		return err
@@ -97,55 +284,81 @@ func (s Service) Confirm(email, code string) error {
 	// set confirmed = true
 	user.ConfirmationCode = ""
 	user.Confirmed = true
-	err = s.userRepository.Save(&user)
+	return s.userRepository.Save(ctx, &user, confirmationSuccessEmail(user, code), webhookEvent(webhook.EventUserConfirmed, user, nil))
+}
 
+// ResendConfirmation replaces the confirmation code of an unconfirmed user and emails the new one.
+// Unknown or confirmed emails and resends within the cooldown are silently ignored
+// so callers can't tell which emails have accounts.
+func (s Service) ResendConfirmation(ctx context.Context, email string) error {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
 
-	s.emailService.SendConfirmationSuccess(user.Name, user.Email)
+	if user.Confirmed || time.Since(user.ConfirmationSent) < confirmationResendCooldown {
+		return nil
+	}
 
-	return nil
+	code := generateCode()
+	user.ConfirmationCode = code
+	user.ConfirmationSent = time.Now()
+	return s.userRepository.Save(ctx, &user, confirmationEmail(user, code))
 }
 
-func (s Service) Login(email, password string) (string, string, error) {
-	user, err := s.userRepository.FindByEmail(email)
+func (s Service) Login(ctx context.Context, email, password string, client Client) (token, refreshToken string, err error) {
+	defer func() { s.record(ctx, audit.TypeLogin, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.hasher.Compare(missingUserHash, password)
+		return "", "", invalidCredentials{cause: err}
+	}
 	if err != nil {
 		return "", "", err
 	}
+	// the state of the account is only revealed to whoever knows its password
+	if err := s.hasher.Compare(user.HashedPassword, password); err != nil {
+		return "", "", invalidCredentials{cause: err}
+	}
 
 	if user.ConfirmationCode != "" || !user.Confirmed {
-		return "", "", errors.New("account is not confirmed")
+		return "", "", ErrNotConfirmed
 	}
-	// hash password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(password)); err != nil {
+
+	if err := statusError(user); err != nil {
 		return "", "", err
 	}
 
-	tokenClaims := &jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-		Issuer:    "mimoto",
-		Subject:   user.Email,
-	}
-	refreshTokenClaims := &jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(30 * 24 * time.Hour).Unix(),
-		Issuer:    "mimoto",
-		Subject:   user.Email,
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims)
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	signedRefreshToken, err := refreshToken.SignedString([]byte(os.Getenv("SECRET")))
+	audience, policy, err := s.policy(client.Audience)
 	if err != nil {
 		return "", "", err
 	}
 
-	user.RefreshToken = signedRefreshToken
-	err = s.userRepository.Save(&user)
+	// logging in starts a new session, sessions on other audiences are left alone
+	now := time.Now()
+	session := repository.Session{StartedAt: now, RefreshedAt: now}
+	signedToken, signedRefreshToken, err := s.issueTokens(user, audience, session, policy, now)
 	if err != nil {
 		return "", "", err
 	}
-	signedToken, err := token.SignedString([]byte(os.Getenv("SECRET")))
 
+	// the first login isn't from a new device
+	hadDevices := user.KnownDevices != ""
+	var notifications []repository.OutboxMessage
+	if rememberDevice(&user, client) && hadDevices {
+		notifications = newDeviceLoginEmails(user, client, now)
+	}
+
+	session.RefreshToken = signedRefreshToken
+	if key, _, ok := s.findSession(user, audience); ok {
+		delete(user.Sessions, key)
+	}
+	setSession(&user, audience, session)
+	err = s.userRepository.Save(ctx, &user, notifications...)
 	if err != nil {
 		return "", "", err
 	}
@@ -153,37 +366,102 @@ func (s Service) Login(email, password string) (string, string, error) {
 	return signedToken, signedRefreshToken, nil
 }
 
-func (s Service) Refresh(email, token string) (string, error) {
-	user, err := s.userRepository.FindByEmail(email)
+// Refresh returns a new token and rotates the refresh token, following the token policy of the session's audience.
+// Using a rotated refresh token again signs the user out and notifies them, since it was probably stolen,
+// unless it was rotated within the grace period, then it returns the current refresh token.
+func (s Service) Refresh(ctx context.Context, email, token string, client Client) (newToken, newRefreshToken string, err error) {
+	defer func() { s.record(ctx, audit.TypeRefresh, email, err) }()
+
+	_, claims, err := s.ParseRefreshToken(token)
+	if err != nil {
+		return "", "", err
+	}
+	if claims.Subject != email {
+		return "", "", errors.New("refresh token doesn't match")
+	}
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := statusError(user); err != nil {
+		return "", "", err
+	}
+	if claims.Generation != user.TokenGeneration {
+		return "", "", ErrTokenRevoked
+	}
+
+	audience, policy, err := s.policy(claims.Audience)
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	key, session, ok := s.findSession(user, audience)
+	if !ok {
+		return "", "", errors.New("refresh token doesn't match")
+	}
+
+	now := time.Now()
+	if session.PreviousRefreshToken != "" && token == session.PreviousRefreshToken {
+		if now.Sub(session.RefreshedAt) <= refreshGracePeriod {
+			signedToken, _, err := s.issueTokens(user, audience, session, policy, now)
+			if err != nil {
+				return "", "", err
+			}
+			return signedToken, session.RefreshToken, nil
+		}
+		revoked := sessionRevokedEvents(user, "refresh_token_reuse")
+		revokeTokens(&user)
+		err = s.userRepository.Save(ctx, &user, append(refreshTokenReuseEmails(user, client, now), revoked...)...)
+		if err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReuse
+	}
+
+	if session.RefreshToken == "" || token != session.RefreshToken {
+		return "", "", errors.New("refresh token doesn't match")
 	}
 
-	if token != user.RefreshToken {
-		return "", errors.New("refresh token doesn't match")
+	delete(user.Sessions, key)
+	if err := sessionError(session, policy, now); err != nil {
+		if err := s.userRepository.Save(ctx, &user); err != nil {
+			return "", "", err
+		}
+		return "", "", err
 	}
 
-	tokenClaims := &jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
-		Issuer:    "mimoto",
-		Subject:   user.Email,
+	// sessions from before session tracking start now
+	if session.StartedAt.IsZero() {
+		session.StartedAt = now
+	}
+	session.RefreshedAt = now
+	signedToken, signedRefreshToken, err := s.issueTokens(user, audience, session, policy, now)
+	if err != nil {
+		return "", "", err
 	}
-	newToken := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims)
-	signedToken, err := newToken.SignedString([]byte(os.Getenv("SECRET")))
+
+	session.PreviousRefreshToken = session.RefreshToken
+	session.RefreshToken = signedRefreshToken
+	setSession(&user, audience, session)
+	err = s.userRepository.Save(ctx, &user)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
-	return signedToken, nil
+	return signedToken, signedRefreshToken, nil
 }
 
-func (s Service) Logout(email string) error {
-	user, err := s.userRepository.FindByEmail(email)
+func (s Service) Logout(ctx context.Context, email string) (err error) {
+	defer func() { s.record(ctx, audit.TypeLogout, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
 	if err != nil {
 		return err
 	}
 
-	user.RefreshToken = ""
-	err = s.userRepository.Save(&user)
+	revoked := sessionRevokedEvents(user, "logout")
+	revokeTokens(&user)
+	err = s.userRepository.Save(ctx, &user, revoked...)
 	if err != nil {
 		return err
 	}
@@ -191,23 +469,23 @@ func (s Service) Logout(email string) error {
 	return nil
 }
 
-func (s Service) SendReset(email string) error {
-	user, err := s.userRepository.FindByEmail(email)
+func (s Service) SendReset(ctx context.Context, email string) (err error) {
+	defer func() { s.record(ctx, audit.TypeResetRequested, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
 	if err != nil {
 		return err
 	}
 
 	code := generateCode()
 	user.ResetCode = code
-	err = s.userRepository.Save(&user)
-	if err != nil {
-		return err
-	}
-	return s.emailService.SendReset(user.Name, user.Email, code)
+	return s.userRepository.Save(ctx, &user, resetEmail(user, code))
 }
 
-func (s Service) ResetPassword(email, password, code string) error {
-	user, err := s.userRepository.FindByEmail(email)
+func (s Service) ResetPassword(ctx context.Context, email, password, code string, client Client) (err error) {
+	defer func() { s.record(ctx, audit.TypeResetCompleted, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
 	if err != nil {
 		return err
 	}
@@ -220,18 +498,366 @@ func (s Service) ResetPassword(email, password, code string) error {
 		return errors.New("reset code doesn't match")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	// update user in repo with new password and set code to "", whoever had the old password is signed out
+	revoked := sessionRevokedEvents(user, "password_reset")
+	user.HashedPassword = hashedPassword
+	user.ResetCode = ""
+	revokeTokens(&user)
+	outbox := append(passwordChangedEmails(user, client, time.Now()), webhookEvent(webhook.EventUserPasswordReset, user, nil))
+	err = s.userRepository.Save(ctx, &user, append(outbox, revoked...)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// SetPassword replaces the password of email without a reset code, for operators.
+func (s Service) SetPassword(ctx context.Context, email, password string) (err error) {
+	defer func() { s.record(ctx, audit.TypeResetCompleted, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
-	// update user in repo with new password and set code to ""
-	user.HashedPassword = string(hashedPassword)
+	revoked := sessionRevokedEvents(user, "password_reset")
+	user.HashedPassword = hashedPassword
 	user.ResetCode = ""
-	err = s.userRepository.Save(&user)
+	revokeTokens(&user)
+	outbox := append(passwordChangedEmails(user, Client{}, time.Now()), webhookEvent(webhook.EventUserPasswordReset, user, nil))
+	return s.userRepository.Save(ctx, &user, append(outbox, revoked...)...)
+}
+
+func (s Service) ListUsers(ctx context.Context, opts repository.ListOptions) ([]repository.User, int64, error) {
+	return s.userRepository.List(ctx, opts)
+}
+
+func (s Service) GetUser(ctx context.Context, email string) (repository.User, error) {
+	return s.userRepository.FindByEmail(ctx, email)
+}
+
+func (s Service) IsAdmin(ctx context.Context, email string) (bool, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	return user.Role == repository.RoleAdmin && statusError(user) == nil, nil
+}
+
+// CheckStatus returns an error if the user isn't allowed to authenticate.
+func (s Service) CheckStatus(ctx context.Context, email string) error {
+	user, err := s.userRepository.FindByEmail(ctx, email)
 	if err != nil {
 		return err
 	}
+	return statusError(user)
+}
+
+func (s Service) setStatus(ctx context.Context, email, status, reason string, until *time.Time) error {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	user.Status = status
+	user.StatusReason = reason
+	user.StatusChangedAt = time.Now()
+	user.SuspendedUntil = until
+	if status == repository.StatusActive {
+		return s.userRepository.Save(ctx, &user)
+	}
 
+	revoked := sessionRevokedEvents(user, status)
+	revokeTokens(&user)
+	return s.userRepository.Save(ctx, &user, append(accountLockedEmails(user, time.Now()), revoked...)...)
+}
+
+// ForceConfirm confirms a user without requiring their confirmation code.
+func (s Service) ForceConfirm(ctx context.Context, email string) error {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if user.Confirmed {
+		return errors.New("this user is already confirmed")
+	}
+
+	user.ConfirmationCode = ""
+	user.Confirmed = true
+	return s.userRepository.Save(ctx, &user, webhookEvent(webhook.EventUserConfirmed, user, nil))
+}
+
+// SuspendUser blocks a user from authenticating until the suspension is lifted.
+// A nil until suspends the user indefinitely.
+func (s Service) SuspendUser(ctx context.Context, email, reason string, until *time.Time) error {
+	if until != nil && !until.After(time.Now()) {
+		return errors.New("suspension must end in the future")
+	}
+	return s.setStatus(ctx, email, repository.StatusSuspended, reason, until)
+}
+
+// DisableUser blocks a user from authenticating and revokes their refresh token.
+func (s Service) DisableUser(ctx context.Context, email, reason string) error {
+	return s.setStatus(ctx, email, repository.StatusDisabled, reason, nil)
+}
+
+func (s Service) EnableUser(ctx context.Context, email string) error {
+	return s.setStatus(ctx, email, repository.StatusActive, "", nil)
+}
+
+func (s Service) DeleteUser(ctx context.Context, email string) error {
+	err := s.userRepository.Delete(ctx, email, webhookEvent(webhook.EventUserDeleted, repository.User{Email: email}, map[string]string{"reason": "admin"}))
+	if err != nil {
+		return err
+	}
+	return s.anonymizeAuditEvents(ctx, email)
+}
+
+// anonymizeAuditEvents replaces a deleted user's email in the audit log with a pseudonym,
+// the event of the deletion is recorded afterwards so the log still shows who was erased.
+func (s Service) anonymizeAuditEvents(ctx context.Context, email string) error {
+	if s.auditLog == nil {
+		return nil
+	}
+	if err := s.auditLog.Anonymize(context.WithoutCancel(ctx), email, "deleted:"+generateCode()); err != nil {
+		return fmt.Errorf("anonymize audit events: %w", err)
+	}
 	return nil
 }
+
+// ScheduleDeletion marks the user for deletion once the grace period has passed.
+// The user can't authenticate until the deletion is cancelled.
+func (s Service) ScheduleDeletion(ctx context.Context, email, password string) (deletionAt time.Time, err error) {
+	defer func() { s.record(ctx, audit.TypeDeletionScheduled, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.hasher.Compare(user.HashedPassword, password); err != nil {
+		return time.Time{}, invalidCredentials{cause: err}
+	}
+
+	deletionAt = time.Now().Add(s.deletionGracePeriod)
+	user.Status = repository.StatusPendingDeletion
+	user.StatusReason = "deletion requested by user"
+	user.StatusChangedAt = time.Now()
+	user.DeletionAt = &deletionAt
+	revoked := sessionRevokedEvents(user, repository.StatusPendingDeletion)
+	revokeTokens(&user)
+	user.ResetCode = ""
+	err = s.userRepository.Save(ctx, &user, revoked...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return deletionAt, nil
+}
+
+// CancelDeletion reactivates an account pending deletion, like Login it can't be used to find which accounts exist.
+func (s Service) CancelDeletion(ctx context.Context, email, password string) (err error) {
+	defer func() { s.record(ctx, audit.TypeDeletionCanceled, email, err) }()
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.hasher.Compare(missingUserHash, password)
+		return invalidCredentials{cause: err}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.hasher.Compare(user.HashedPassword, password); err != nil {
+		return invalidCredentials{cause: err}
+	}
+
+	if user.Status != repository.StatusPendingDeletion {
+		return errors.New("account is not pending deletion")
+	}
+
+	user.Status = repository.StatusActive
+	user.StatusReason = ""
+	user.StatusChangedAt = time.Now()
+	user.DeletionAt = nil
+	return s.userRepository.Save(ctx, &user)
+}
+
+// PurgeDeletedUsers deletes every user whose deletion was due at or before now.
+func (s Service) PurgeDeletedUsers(ctx context.Context, now time.Time) (int, error) {
+	users, _, err := s.userRepository.List(ctx, repository.ListOptions{
+		Status:      repository.StatusPendingDeletion,
+		DeletionDue: &now,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx = audit.WithActor(ctx, audit.ActorSystem)
+	purged := 0
+	for _, user := range users {
+		// the event carries nothing about the erased user but their email
+		err := s.userRepository.Delete(ctx, user.Email, webhookEvent(webhook.EventUserDeleted, repository.User{Email: user.Email}, map[string]string{"reason": "requested"}))
+		// another replica purged the user first
+		if errors.Is(err, repository.ErrUserNotFound) {
+			continue
+		}
+		if err == nil {
+			err = s.anonymizeAuditEvents(ctx, user.Email)
+		}
+		s.record(ctx, audit.TypeDeleted, user.Email, err)
+		if err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Export is everything mimoto stores about a user, minus credentials.
+type Export struct {
+	ExportedAt time.Time `json:"exportedAt"`
+	Profile    Profile   `json:"profile"`
+	Account    Account   `json:"account"`
+	// EmailEvents are the delivery events reported by the email provider.
+	EmailEvents []repository.EmailEvent `json:"emailEvents"`
+	// Emails are the emails sent, or waiting to be sent, to the user.
+	Emails []ExportedEmail `json:"emails"`
+	// WebhookDeliveries are the events about the user sent to webhook subscriptions.
+	WebhookDeliveries []repository.WebhookDelivery `json:"webhookDeliveries"`
+	// AuditEvents are what the user did, or was done to their account, newest first.
+	// They're left out when the audit log can't be queried.
+	AuditEvents []audit.Event `json:"auditEvents"`
+}
+
+// ExportedEmail is an outbox message without the confirmation and reset codes in it.
+type ExportedEmail struct {
+	Kind      string            `json:"kind"`
+	Status    string            `json:"status"`
+	Data      map[string]string `json:"data,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	SentAt    *time.Time        `json:"sentAt"`
+}
+
+func newExportedEmail(msg repository.OutboxMessage) ExportedEmail {
+	data := make(map[string]string)
+	json.Unmarshal([]byte(msg.Payload), &data)
+	delete(data, "code")
+	if len(data) == 0 {
+		data = nil
+	}
+	return ExportedEmail{
+		Kind:      msg.Kind,
+		Status:    msg.Status,
+		Data:      data,
+		CreatedAt: msg.CreatedAt,
+		SentAt:    msg.SentAt,
+	}
+}
+
+// exportAuditEvents returns the events the user was the actor or subject of, newest first.
+func (s Service) exportAuditEvents(ctx context.Context, email string) ([]audit.Event, error) {
+	if s.auditLog == nil {
+		return nil, nil
+	}
+	subject, _, err := s.auditLog.List(ctx, audit.ListOptions{Subject: email})
+	if err != nil {
+		return nil, err
+	}
+	actor, _, err := s.auditLog.List(ctx, audit.ListOptions{Actor: email})
+	if err != nil {
+		return nil, err
+	}
+	events := subject
+	for _, event := range actor {
+		// the user's own actions are in both lists
+		if event.Subject != email {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	return events, nil
+}
+
+type Account struct {
+	Role                string     `json:"role"`
+	Confirmed           bool       `json:"confirmed"`
+	PendingConfirmation bool       `json:"pendingConfirmation"`
+	PendingReset        bool       `json:"pendingReset"`
+	ActiveSession       bool       `json:"activeSession"`
+	Status              string     `json:"status"`
+	StatusReason        string     `json:"statusReason"`
+	StatusChangedAt     time.Time  `json:"statusChangedAt"`
+	SuspendedUntil      *time.Time `json:"suspendedUntil"`
+	DeletionAt          *time.Time `json:"deletionAt"`
+	EmailSuppressed     bool       `json:"emailSuppressed"`
+}
+
+func (s Service) ExportUser(ctx context.Context, email string) (Export, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	events, err := s.userRepository.ListEmailEvents(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	suppressed, err := s.userRepository.IsSuppressed(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	messages, err := s.userRepository.ListOutboxMessages(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	emails := make([]ExportedEmail, 0, len(messages))
+	for _, msg := range messages {
+		// webhook events are exported as their deliveries
+		if !webhook.IsEvent(msg.Kind) {
+			emails = append(emails, newExportedEmail(msg))
+		}
+	}
+	deliveries, err := s.userRepository.ListUserWebhookDeliveries(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+	auditEvents, err := s.exportAuditEvents(ctx, email)
+	if err != nil {
+		return Export{}, err
+	}
+
+	return Export{
+		ExportedAt:        time.Now(),
+		EmailEvents:       events,
+		Emails:            emails,
+		WebhookDeliveries: deliveries,
+		AuditEvents:       auditEvents,
+		Profile:           newProfile(user),
+		Account: Account{
+			Role:                user.Role,
+			Confirmed:           user.Confirmed,
+			PendingConfirmation: user.ConfirmationCode != "",
+			PendingReset:        user.ResetCode != "",
+			ActiveSession:       len(user.Sessions) > 0,
+			Status:              user.EffectiveStatus(time.Now()),
+			StatusReason:        user.StatusReason,
+			StatusChangedAt:     user.StatusChangedAt,
+			SuspendedUntil:      user.SuspendedUntil,
+			DeletionAt:          user.DeletionAt,
+			EmailSuppressed:     suppressed,
+		},
+	}, nil
+}
@@ -1,26 +1,52 @@
 package user
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/broswen/mimoto/internal/audit"
+	"github.com/broswen/mimoto/internal/config"
 	"github.com/broswen/mimoto/internal/email"
 	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
 )
 
-func TestService(t *testing.T) {
-	ur, _ := repository.NewMap()
-	es, _ := email.NewConsole()
-	us, err := New(ur, es)
+func newTestService(t *testing.T, ur repository.UserRepository) Service {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	us, err := New(ur, nil, nil, cfg)
 	if err != nil {
 		t.Fatalf("New: %v", err)
 	}
+	return us
+}
+
+// outboxKinds returns the kinds of the outbox messages for email.
+func outboxKinds(ur repository.MapRepository, email string) map[string]int {
+	kinds := make(map[string]int)
+	for _, msg := range ur.OutboxMessages() {
+		if msg.Email == email {
+			kinds[msg.Kind]++
+		}
+	}
+	return kinds
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
 
-	err = us.Signup("test@test.com", "test", "password")
+	err := us.Signup(ctx, "test@test.com", "test", "password")
 	if err != nil {
 		t.Fatalf("Signup: %v", err)
 	}
 
-	user, err := us.userRepository.FindByEmail("test@test.com")
+	user, err := us.userRepository.FindByEmail(ctx, "test@test.com")
 	if err != nil {
 		t.Fatalf("FindByEmail: %v", err)
 	}
@@ -32,18 +58,26 @@ func TestService(t *testing.T) {
 		t.Fatalf("user is confirmed: wanted %v but got %v", false, user.Confirmed)
 	}
 
-	err = us.Confirm(user.Email, user.ConfirmationCode)
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindConfirmation] != 1 {
+		t.Fatalf("confirmation email wasn't enqueued: %v", kinds)
+	}
+
+	err = us.Confirm(ctx, user.Email, user.ConfirmationCode)
 	if err != nil {
 		t.Fatalf("Confirm: %v", err)
 	}
 
-	user, _ = ur.FindByEmail(user.Email)
+	user, _ = ur.FindByEmail(ctx, user.Email)
 
 	if !user.Confirmed {
 		t.Fatalf("user is not confirmed: wanted %v but got %v", true, user.Confirmed)
 	}
 
-	token, refreshToken, err := us.Login(user.Email, "password")
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindConfirmationSuccess] != 1 {
+		t.Fatalf("confirmation success email wasn't enqueued: %v", kinds)
+	}
+
+	token, refreshToken, err := us.Login(ctx, user.Email, "password", Client{})
 	if err != nil {
 		t.Fatalf("Login: %v", err)
 	}
@@ -52,16 +86,522 @@ func TestService(t *testing.T) {
 		t.Fatalf("token or refreshToken is null")
 	}
 
-	err = us.SendReset(user.Email)
+	err = us.SendReset(ctx, user.Email)
 	if err != nil {
 		t.Fatalf("SendReset: %v", err)
 	}
 
-	user, _ = ur.FindByEmail(user.Email)
+	user, _ = ur.FindByEmail(ctx, user.Email)
+
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindReset] != 1 {
+		t.Fatalf("reset email wasn't enqueued: %v", kinds)
+	}
 
-	err = us.ResetPassword(user.Email, "newpassword", user.ResetCode)
+	err = us.ResetPassword(ctx, user.Email, "newpassword", user.ResetCode, Client{})
 	if err != nil {
 		t.Fatalf("ResetPassword: %v", err)
 	}
 
 }
+
+func TestAdminActions(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	err = us.ForceConfirm(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ForceConfirm: %v", err)
+	}
+
+	err = us.DisableUser(ctx, "test@test.com", "spam")
+	if err != nil {
+		t.Fatalf("DisableUser: %v", err)
+	}
+
+	_, _, err = us.Login(ctx, "test@test.com", "password", Client{})
+	if !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("Login: wanted %v but got %v", ErrAccountDisabled, err)
+	}
+
+	err = us.EnableUser(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("EnableUser: %v", err)
+	}
+
+	_, _, err = us.Login(ctx, "test@test.com", "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	admin, err := us.IsAdmin(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("IsAdmin: %v", err)
+	}
+	if admin {
+		t.Fatalf("user is admin: wanted %v but got %v", false, admin)
+	}
+
+	users, total, err := us.ListUsers(ctx, repository.ListOptions{})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+	if total != 1 || len(users) != 1 {
+		t.Fatalf("ListUsers: wanted %v users but got %v", 1, total)
+	}
+
+	err = us.DeleteUser(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+
+	_, err = us.GetUser(ctx, "test@test.com")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("GetUser: wanted %v but got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.CreateUser(ctx, NewUser{Email: "admin@test.com", Name: "admin", Password: "password", Role: repository.RoleAdmin, Confirmed: true})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := ur.FindByEmail(ctx, "admin@test.com")
+	if err != nil {
+		t.Fatalf("FindByEmail: %v", err)
+	}
+	if user.Role != repository.RoleAdmin || !user.Confirmed || user.ConfirmationCode != "" {
+		t.Fatalf("created user doesn't match: got %+v", user)
+	}
+	// confirmed users aren't sent a confirmation email
+	kinds := outboxKinds(ur, user.Email)
+	if kinds[email.KindConfirmation] != 0 || kinds[webhook.EventUserCreated] != 1 || kinds[webhook.EventUserConfirmed] != 1 {
+		t.Fatalf("outbox doesn't match: got %v", kinds)
+	}
+	if _, _, err := us.Login(ctx, user.Email, "password", Client{}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+}
+
+func TestSetPassword(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	newConfirmedUser(t, us, "test@test.com")
+	us.SendReset(ctx, "test@test.com")
+
+	if err := us.SetPassword(ctx, "test@test.com", "new password"); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	if _, _, err := us.Login(ctx, "test@test.com", "password", Client{}); err == nil {
+		t.Fatalf("Login: old password still works")
+	}
+	if _, _, err := us.Login(ctx, "test@test.com", "new password", Client{}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	// a pending reset code can't change the password again
+	if user, _ := ur.FindByEmail(ctx, "test@test.com"); user.ResetCode != "" {
+		t.Fatalf("reset code doesn't match: wanted %q but got %q", "", user.ResetCode)
+	}
+
+	if err := us.SetPassword(ctx, "missing@test.com", "password"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("SetPassword error doesn't match: wanted %v but got %v", repository.ErrUserNotFound, err)
+	}
+}
+
+func TestSuspension(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	err = us.ForceConfirm(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ForceConfirm: %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	err = us.SuspendUser(ctx, "test@test.com", "abuse", &past)
+	if err == nil {
+		t.Fatalf("SuspendUser: wanted error for suspension in the past")
+	}
+
+	future := time.Now().Add(time.Hour)
+	err = us.SuspendUser(ctx, "test@test.com", "abuse", &future)
+	if err != nil {
+		t.Fatalf("SuspendUser: %v", err)
+	}
+
+	_, _, err = us.Login(ctx, "test@test.com", "password", Client{})
+	if !errors.Is(err, ErrAccountSuspended) {
+		t.Fatalf("Login: wanted %v but got %v", ErrAccountSuspended, err)
+	}
+
+	// without the password the suspension isn't revealed
+	_, _, err = us.Login(ctx, "test@test.com", "wrong", Client{})
+	if !errors.Is(err, ErrInvalidCredentials) || strings.Contains(err.Error(), "suspended") {
+		t.Fatalf("Login: wanted %v but got %v", ErrInvalidCredentials, err)
+	}
+	_, _, err = us.Login(ctx, "missing@test.com", "password", Client{})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login: wanted %v but got %v", ErrInvalidCredentials, err)
+	}
+
+	err = us.CheckStatus(ctx, "test@test.com")
+	if !errors.Is(err, ErrAccountSuspended) {
+		t.Fatalf("CheckStatus: wanted %v but got %v", ErrAccountSuspended, err)
+	}
+
+	// suspensions lift automatically once they expire
+	user, _ := ur.FindByEmail(ctx, "test@test.com")
+	user.SuspendedUntil = &past
+	ur.Save(ctx, &user)
+
+	_, _, err = us.Login(ctx, "test@test.com", "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	err = us.CheckStatus(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("CheckStatus: %v", err)
+	}
+}
+
+func TestAccountDeletion(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+
+	_, err = us.ScheduleDeletion(ctx, "test@test.com", "wrong")
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ScheduleDeletion error doesn't match: wanted %v but got %v", ErrInvalidCredentials, err)
+	}
+
+	deletionAt, err := us.ScheduleDeletion(ctx, "test@test.com", "password")
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+
+	err = us.CheckStatus(ctx, "test@test.com")
+	if !errors.Is(err, ErrAccountPendingDeletion) {
+		t.Fatalf("CheckStatus: wanted %v but got %v", ErrAccountPendingDeletion, err)
+	}
+
+	export, err := us.ExportUser(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ExportUser: %v", err)
+	}
+	if export.Profile.Email != "test@test.com" || export.Account.DeletionAt == nil {
+		t.Fatalf("ExportUser: unexpected export %+v", export)
+	}
+
+	purged, err := us.PurgeDeletedUsers(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("PurgeDeletedUsers: wanted %v purged but got %v", 0, purged)
+	}
+
+	// unknown emails and wrong passwords are rejected alike
+	for _, test := range []struct{ email, password string }{
+		{"unknown@test.com", "password"},
+		{"test@test.com", "wrong"},
+	} {
+		err = us.CancelDeletion(ctx, test.email, test.password)
+		if !errors.Is(err, ErrInvalidCredentials) || err.Error() != ErrInvalidCredentials.Error() {
+			t.Fatalf("CancelDeletion error doesn't match: wanted %v but got %v", ErrInvalidCredentials, err)
+		}
+	}
+
+	err = us.CancelDeletion(ctx, "test@test.com", "password")
+	if err != nil {
+		t.Fatalf("CancelDeletion: %v", err)
+	}
+
+	err = us.CheckStatus(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("CheckStatus: %v", err)
+	}
+
+	deletionAt, err = us.ScheduleDeletion(ctx, "test@test.com", "password")
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+
+	purged, err = us.PurgeDeletedUsers(ctx, deletionAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("PurgeDeletedUsers: wanted %v purged but got %v", 1, purged)
+	}
+
+	_, err = ur.FindByEmail(ctx, "test@test.com")
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("FindByEmail: wanted %v but got %v", repository.ErrUserNotFound, err)
+	}
+	// the deletion event doesn't carry the erased user's name
+	messages, _ := ur.ListOutboxMessages(ctx, "test@test.com")
+	if len(messages) != 1 || messages[0].Kind != webhook.EventUserDeleted || messages[0].Name != "" {
+		t.Fatalf("deletion event doesn't match: got %+v", messages)
+	}
+
+}
+
+func TestScheduleDeletionRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	_, refreshToken, err := us.Login(ctx, user.Email, "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	_, rotated, err := us.Refresh(ctx, user.Email, refreshToken, Client{})
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if _, err := us.ScheduleDeletion(ctx, user.Email, "password"); err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if user, _ := ur.FindByEmail(ctx, user.Email); len(user.Sessions) != 0 {
+		t.Fatalf("sessions weren't revoked: %+v", user.Sessions)
+	}
+
+	// neither the current nor the rotated refresh token work after the deletion is cancelled
+	if err := us.CancelDeletion(ctx, user.Email, "password"); err != nil {
+		t.Fatalf("CancelDeletion: %v", err)
+	}
+	for _, token := range []string{refreshToken, rotated} {
+		if _, _, err := us.Refresh(ctx, user.Email, token, Client{}); err == nil {
+			t.Fatalf("Refresh: wanted an error for a revoked refresh token")
+		}
+	}
+}
+
+// purgedElsewhere is a repository where another replica always deletes users first.
+type purgedElsewhere struct {
+	repository.UserRepository
+}
+
+func (r purgedElsewhere) Delete(ctx context.Context, email string, outbox ...repository.OutboxMessage) error {
+	r.UserRepository.Delete(ctx, email)
+	return repository.ErrUserNotFound
+}
+
+func TestPurgeDeletedUsersRace(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, purgedElsewhere{ur})
+	newConfirmedUser(t, us, "test@test.com")
+
+	deletionAt, err := us.ScheduleDeletion(ctx, "test@test.com", "password")
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	purged, err := us.PurgeDeletedUsers(ctx, deletionAt.Add(time.Second))
+	if err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+	if purged != 0 {
+		t.Fatalf("PurgeDeletedUsers: wanted %v purged but got %v", 0, purged)
+	}
+}
+
+func TestResendConfirmation(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+
+	err := us.ResendConfirmation(ctx, "none@test.com")
+	if err != nil {
+		t.Fatalf("ResendConfirmation: %v", err)
+	}
+
+	err = us.Signup(ctx, "test@test.com", "test", "password")
+	if err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	user, _ := ur.FindByEmail(ctx, "test@test.com")
+	oldCode := user.ConfirmationCode
+
+	// resends within the cooldown are ignored
+	err = us.ResendConfirmation(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ResendConfirmation: %v", err)
+	}
+	user, _ = ur.FindByEmail(ctx, "test@test.com")
+	if user.ConfirmationCode != oldCode {
+		t.Fatalf("confirmation code changed within cooldown")
+	}
+
+	user.ConfirmationSent = time.Now().Add(-confirmationResendCooldown)
+	ur.Save(ctx, &user)
+
+	err = us.ResendConfirmation(ctx, "test@test.com")
+	if err != nil {
+		t.Fatalf("ResendConfirmation: %v", err)
+	}
+	user, _ = ur.FindByEmail(ctx, "test@test.com")
+	if user.ConfirmationCode == oldCode {
+		t.Fatalf("confirmation code wasn't regenerated")
+	}
+	if kinds := outboxKinds(ur, user.Email); kinds[email.KindConfirmation] != 2 {
+		t.Fatalf("confirmation email wasn't enqueued again: %v", kinds)
+	}
+
+	err = us.Confirm(ctx, "test@test.com", oldCode)
+	if err == nil {
+		t.Fatalf("Confirm: wanted error for old confirmation code")
+	}
+
+	err = us.Confirm(ctx, "test@test.com", user.ConfirmationCode)
+	if err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+}
+
+func TestServiceCancel(t *testing.T) {
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	newConfirmedUser(t, us, "test@test.com")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := us.Signup(ctx, "new@test.com", "test", "password"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Signup error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+	if _, _, err := us.Login(ctx, "test@test.com", "password", Client{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Login error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+	if _, err := ur.FindByEmail(context.Background(), "new@test.com"); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("canceled Signup created the user")
+	}
+}
+
+func TestServiceAudit(t *testing.T) {
+	ur, _ := repository.NewMap()
+	sink, _ := audit.NewMemory()
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	us, err := New(ur, nil, sink, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := audit.WithRequest(context.Background(), audit.Request{IP: "10.0.0.1", UserAgent: "test", RequestID: "req-1"})
+	if err := us.Signup(ctx, "test@test.com", "test", "password"); err != nil {
+		t.Fatalf("Signup: %v", err)
+	}
+	if _, _, err := us.Login(ctx, "test@test.com", "password", Client{}); err == nil {
+		t.Fatalf("Login: unconfirmed user logged in")
+	}
+	// admins act on other users
+	if err := us.SendReset(audit.WithActor(ctx, "admin@test.com"), "test@test.com"); err != nil {
+		t.Fatalf("SendReset: %v", err)
+	}
+
+	events, total, err := sink.List(context.Background(), audit.ListOptions{Subject: "test@test.com"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("total doesn't match: wanted %v but got %v", 3, total)
+	}
+	want := map[string]audit.Event{
+		audit.TypeSignup:         {Actor: "test@test.com", Outcome: audit.OutcomeSuccess},
+		audit.TypeLogin:          {Actor: "test@test.com", Outcome: audit.OutcomeFailure, Reason: ErrNotConfirmed.Error()},
+		audit.TypeResetRequested: {Actor: "admin@test.com", Outcome: audit.OutcomeSuccess},
+	}
+	for _, event := range events {
+		w := want[event.Type]
+		if event.Actor != w.Actor || event.Outcome != w.Outcome || event.Reason != w.Reason {
+			t.Fatalf("%s event doesn't match: wanted %+v but got %+v", event.Type, w, event)
+		}
+		if event.IP != "10.0.0.1" || event.UserAgent != "test" || event.RequestID != "req-1" {
+			t.Fatalf("%s event request doesn't match: got %+v", event.Type, event)
+		}
+	}
+}
+
+func TestAccountErasure(t *testing.T) {
+	ur, _ := repository.NewMap()
+	sink, _ := audit.NewMemory()
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	us, err := New(ur, nil, sink, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	ctx := audit.WithRequest(context.Background(), audit.Request{IP: "10.0.0.1", UserAgent: "test"})
+	user := newConfirmedUser(t, us, "test@test.com")
+	if _, _, err := us.Login(ctx, user.Email, "password", Client{IP: "10.0.0.1", UserAgent: "test"}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	err = ur.CreateWebhookDeliveries(ctx, []repository.WebhookDelivery{{SubscriptionID: "sub", EventType: "user.created", Subject: user.Email}})
+	if err != nil {
+		t.Fatalf("CreateWebhookDeliveries: %v", err)
+	}
+
+	export, err := us.ExportUser(ctx, user.Email)
+	if err != nil {
+		t.Fatalf("ExportUser: %v", err)
+	}
+	if len(export.Emails) == 0 || len(export.WebhookDeliveries) != 1 || len(export.AuditEvents) == 0 {
+		t.Fatalf("ExportUser: unexpected export %+v", export)
+	}
+	for _, msg := range export.Emails {
+		if _, ok := msg.Data["code"]; ok {
+			t.Fatalf("exported %s email has a code: %+v", msg.Kind, msg)
+		}
+	}
+
+	deletionAt, err := us.ScheduleDeletion(ctx, user.Email, "password")
+	if err != nil {
+		t.Fatalf("ScheduleDeletion: %v", err)
+	}
+	if _, err := us.PurgeDeletedUsers(ctx, deletionAt.Add(time.Second)); err != nil {
+		t.Fatalf("PurgeDeletedUsers: %v", err)
+	}
+
+	if kinds := outboxKinds(ur, user.Email); len(kinds) != 1 {
+		t.Fatalf("outbox wasn't erased: %v", kinds)
+	}
+	deliveries, _ := ur.ListUserWebhookDeliveries(ctx, user.Email)
+	if len(deliveries) != 0 {
+		t.Fatalf("webhook deliveries weren't erased: %+v", deliveries)
+	}
+	// only the event of the deletion itself keeps the email
+	events, _, _ := sink.List(ctx, audit.ListOptions{Subject: user.Email})
+	if len(events) != 1 || events[0].Type != audit.TypeDeleted {
+		t.Fatalf("audit events weren't anonymized: %+v", events)
+	}
+	events, _, _ = sink.List(ctx, audit.ListOptions{})
+	for _, event := range events {
+		if event.Type != audit.TypeDeleted && (!strings.HasPrefix(event.Subject, "deleted:") || event.IP != "") {
+			t.Fatalf("%s event wasn't anonymized: %+v", event.Type, event)
+		}
+	}
+}
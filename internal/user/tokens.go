@@ -0,0 +1,248 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrUnknownAudience = errors.New("unknown token audience")
+	ErrSessionExpired  = errors.New("session expired, login again")
+	ErrTokenRevoked    = errors.New("token was revoked, login again")
+)
+
+// policy returns the token policy of audience, the default audience if it's empty.
+func (s Service) policy(audience string) (string, config.TokenPolicy, error) {
+	if audience == "" {
+		audience = s.tokens.DefaultAudience
+	}
+	policy, ok := s.tokens.Policy(audience)
+	if !ok {
+		return "", config.TokenPolicy{}, fmt.Errorf("%w: %s", ErrUnknownAudience, audience)
+	}
+	return audience, policy, nil
+}
+
+// refreshGracePeriod is how long a rotated refresh token still refreshes its session,
+// so concurrent refreshes with the same token aren't mistaken for reuse.
+const refreshGracePeriod = 10 * time.Second
+
+const (
+	tokenAccess  = "access"
+	tokenRefresh = "refresh"
+)
+
+// Claims are the claims of the tokens issued by the service.
+type Claims struct {
+	jwt.StandardClaims
+	// Type is "access" or "refresh", tokens issued before it existed are refresh tokens if they have an id.
+	Type string `json:"typ,omitempty"`
+	// Generation is the user's token generation when the token was issued.
+	Generation int `json:"gen,omitempty"`
+}
+
+func (c Claims) tokenType() string {
+	switch {
+	case c.Type != "":
+		return c.Type
+	case c.Id != "":
+		return tokenRefresh
+	}
+	return tokenAccess
+}
+
+// sessionError returns ErrSessionExpired if the session outlived the policy at now.
+func sessionError(session repository.Session, policy config.TokenPolicy, now time.Time) error {
+	if policy.MaxSessionLifetime > 0 && !session.StartedAt.IsZero() && !now.Before(session.StartedAt.Add(policy.MaxSessionLifetime)) {
+		return ErrSessionExpired
+	}
+	if policy.IdleTimeout > 0 && !session.RefreshedAt.IsZero() && now.Sub(session.RefreshedAt) > policy.IdleTimeout {
+		return ErrSessionExpired
+	}
+	return nil
+}
+
+// findSession returns the user's session on audience and the key it's stored under.
+// Sessions from before audiences were tracked belong to the default audience.
+func (s Service) findSession(user repository.User, audience string) (string, repository.Session, bool) {
+	if session, ok := user.Sessions[audience]; ok {
+		return audience, session, true
+	}
+	if session, ok := user.Sessions[""]; ok && audience == s.tokens.DefaultAudience {
+		return "", session, true
+	}
+	return "", repository.Session{}, false
+}
+
+// revokeTokens signs the user out of every session and revokes the access tokens issued so far.
+func revokeTokens(user *repository.User) {
+	user.Sessions = nil
+	user.TokenGeneration++
+}
+
+// setSession stores the user's session on audience, replacing the one it had.
+func setSession(user *repository.User, audience string, session repository.Session) {
+	if user.Sessions == nil {
+		user.Sessions = repository.Sessions{}
+	}
+	user.Sessions[audience] = session
+}
+
+// issueTokens signs an access and refresh token for the user's session on audience,
+// neither outlives the session's max lifetime.
+func (s Service) issueTokens(user repository.User, audience string, session repository.Session, policy config.TokenPolicy, now time.Time) (string, string, error) {
+	accessExpiry := now.Add(policy.AccessTTL)
+	refreshExpiry := now.Add(policy.RefreshTTL)
+	if policy.MaxSessionLifetime > 0 {
+		sessionEnd := session.StartedAt.Add(policy.MaxSessionLifetime)
+		if accessExpiry.After(sessionEnd) {
+			accessExpiry = sessionEnd
+		}
+		if refreshExpiry.After(sessionEnd) {
+			refreshExpiry = sessionEnd
+		}
+	}
+
+	tokenClaims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: accessExpiry.Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    s.tokens.Issuer,
+			Subject:   user.Email,
+		},
+		Type:       tokenAccess,
+		Generation: user.TokenGeneration,
+	}
+	signedToken, err := s.sign(tokenClaims)
+	if err != nil {
+		return "", "", err
+	}
+
+	// the unique id keeps rotated refresh tokens from ever repeating
+	refreshTokenClaims := &Claims{
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: refreshExpiry.Unix(),
+			Id:        generateCode(),
+			IssuedAt:  now.Unix(),
+			Issuer:    s.tokens.Issuer,
+			Subject:   user.Email,
+		},
+		Type:       tokenRefresh,
+		Generation: user.TokenGeneration,
+	}
+	signedRefreshToken, err := s.sign(refreshTokenClaims)
+	if err != nil {
+		return "", "", err
+	}
+	return signedToken, signedRefreshToken, nil
+}
+
+// sign signs claims with the active key of the keyring, or the secret without a keyring.
+func (s Service) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if len(s.keyring.Keys) == 0 {
+		return token.SignedString(s.secret)
+	}
+	key, err := s.keyring.Active()
+	if err != nil {
+		return "", err
+	}
+	token.Header["kid"] = key.ID
+	return token.SignedString([]byte(key.Secret))
+}
+
+// verificationKey returns the key that signed token, tokens without a kid were signed by the secret.
+func (s Service) verificationKey(token *jwt.Token) (interface{}, error) {
+	if token.Method != jwt.SigningMethodHS256 {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if len(s.secret) == 0 {
+			return nil, errors.New("missing key id")
+		}
+		return s.secret, nil
+	}
+	key, ok := s.keyring.Find(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return []byte(key.Secret), nil
+}
+
+// ParseToken verifies the signature, expiry, issuer and audience of an access token issued by the service.
+func (s Service) ParseToken(tokenString string) (*jwt.Token, Claims, error) {
+	return s.parse(tokenString, tokenAccess)
+}
+
+// ParseRefreshToken is ParseToken for refresh tokens, they're only accepted by Refresh.
+func (s Service) ParseRefreshToken(tokenString string) (*jwt.Token, Claims, error) {
+	return s.parse(tokenString, tokenRefresh)
+}
+
+func (s Service) parse(tokenString, tokenType string) (*jwt.Token, Claims, error) {
+	claims := Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, &claims, s.verificationKey)
+	if err != nil {
+		return nil, claims, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !claims.VerifyIssuer(s.tokens.Issuer, true) {
+		return nil, claims, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.tokenType() != tokenType {
+		return nil, claims, fmt.Errorf("%w: expected %s token but got %s token", ErrInvalidToken, tokenType, claims.tokenType())
+	}
+	// tokens issued before audiences were configurable have none, they belonged to the default audience
+	if claims.Audience == "" {
+		claims.Audience = s.tokens.DefaultAudience
+	}
+	if !s.tokens.ValidAudience(claims.Audience) {
+		return nil, claims, fmt.Errorf("%w: unexpected audience %q", ErrInvalidToken, claims.Audience)
+	}
+	return token, claims, nil
+}
+
+// CheckToken returns an error if the user of the token isn't allowed to authenticate,
+// or ErrTokenRevoked if their tokens were revoked after it was issued.
+func (s Service) CheckToken(ctx context.Context, claims Claims) error {
+	user, err := s.userRepository.FindByEmail(ctx, claims.Subject)
+	if err != nil {
+		return err
+	}
+	if err := statusError(user); err != nil {
+		return err
+	}
+	if claims.Generation != user.TokenGeneration {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// IssueAccessToken signs an access token for email without logging in, for debugging.
+// The user's session and refresh token are left alone.
+func (s Service) IssueAccessToken(ctx context.Context, email, audience string) (string, error) {
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return "", err
+	}
+	if err := statusError(user); err != nil {
+		return "", err
+	}
+	audience, policy, err := s.policy(audience)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token, _, err := s.issueTokens(user, audience, repository.Session{StartedAt: now}, policy, now)
+	return token, err
+}
@@ -0,0 +1,346 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/config"
+	"github.com/broswen/mimoto/internal/keys"
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/golang-jwt/jwt"
+)
+
+func newTokenTestService(t *testing.T, ur repository.UserRepository) Service {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	cfg.Tokens.Issuer = "https://auth.example.com"
+	cfg.Tokens.Audiences = map[string]config.TokenPolicy{
+		"mobile": {AccessTTL: time.Hour, RefreshTTL: 90 * 24 * time.Hour, MaxSessionLifetime: 24 * time.Hour, IdleTimeout: time.Hour},
+	}
+	us, err := New(ur, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return us
+}
+
+func TestTokenPolicy(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	token, refreshToken, err := us.Login(ctx, user.Email, "password", Client{Audience: "mobile"})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	_, claims, err := us.ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Issuer != "https://auth.example.com" || claims.Audience != "mobile" {
+		t.Fatalf("claims don't match: wanted %v but got %v", "https://auth.example.com mobile", claims.Issuer+" "+claims.Audience)
+	}
+	if ttl := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second; ttl != time.Hour {
+		t.Fatalf("access token ttl doesn't match: wanted %v but got %v", time.Hour, ttl)
+	}
+
+	// refresh tokens don't outlive the max session lifetime
+	_, claims, err = us.ParseRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("ParseRefreshToken: %v", err)
+	}
+	if ttl := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second; ttl > 24*time.Hour {
+		t.Fatalf("refresh token ttl doesn't match: wanted %v but got %v", 24*time.Hour, ttl)
+	}
+
+	token, _, err = us.Login(ctx, user.Email, "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	_, claims, err = us.ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Audience != "mimoto" {
+		t.Fatalf("default audience doesn't match: wanted %v but got %v", "mimoto", claims.Audience)
+	}
+
+	// logging in on another audience leaves the mobile session alone
+	if _, _, err := us.Refresh(ctx, user.Email, refreshToken, Client{}); err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	_, _, err = us.Login(ctx, user.Email, "password", Client{Audience: "unknown"})
+	if !errors.Is(err, ErrUnknownAudience) {
+		t.Fatalf("Login error doesn't match: wanted %v but got %v", ErrUnknownAudience, err)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+
+	sign := func(claims jwt.StandardClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("SignedString: %v", err)
+		}
+		return token
+	}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name   string
+		claims jwt.StandardClaims
+		valid  bool
+	}{
+		{"valid", jwt.StandardClaims{Issuer: "https://auth.example.com", Audience: "mobile", ExpiresAt: expiresAt}, true},
+		{"wrong issuer", jwt.StandardClaims{Issuer: "mimoto", Audience: "mobile", ExpiresAt: expiresAt}, false},
+		{"unknown audience", jwt.StandardClaims{Issuer: "https://auth.example.com", Audience: "web", ExpiresAt: expiresAt}, false},
+		{"legacy token without audience", jwt.StandardClaims{Issuer: "https://auth.example.com", ExpiresAt: expiresAt}, true},
+		{"expired", jwt.StandardClaims{Issuer: "https://auth.example.com", Audience: "mobile", ExpiresAt: time.Now().Add(-time.Hour).Unix()}, false},
+	}
+	for _, test := range tests {
+		_, _, err := us.ParseToken(sign(test.claims))
+		if valid := err == nil; valid != test.valid {
+			t.Fatalf("%s: valid doesn't match: wanted %v but got %v (%v)", test.name, test.valid, valid, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: error doesn't match: wanted %v but got %v", test.name, ErrInvalidToken, err)
+		}
+	}
+
+	_, claims, err := us.ParseToken(sign(jwt.StandardClaims{Issuer: "https://auth.example.com", Subject: "test@test.com", ExpiresAt: expiresAt}))
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Audience != "mimoto" {
+		t.Fatalf("legacy audience doesn't match: wanted %v but got %v", "mimoto", claims.Audience)
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Issuer: "https://auth.example.com", Audience: "mobile"}).SignedString([]byte("other"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if _, _, err := us.ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseToken error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+}
+
+func TestTokenTypes(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	token, refreshToken, err := us.Login(ctx, user.Email, "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, _, err := us.ParseToken(refreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseToken error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+	if _, _, err := us.ParseRefreshToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseRefreshToken error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+	if _, _, err := us.Refresh(ctx, user.Email, token, Client{}); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Refresh error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+
+	// tokens from before the type claim are refresh tokens if they have an id
+	legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Issuer: "https://auth.example.com", Id: "1"}).SignedString([]byte("secret"))
+	if _, _, err := us.ParseToken(legacy); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseToken error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+	if _, _, err := us.ParseRefreshToken(legacy); err != nil {
+		t.Fatalf("ParseRefreshToken: %v", err)
+	}
+}
+
+func TestTokenRevocation(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	login := func() Claims {
+		t.Helper()
+		token, _, err := us.Login(ctx, user.Email, "password", Client{})
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		_, claims, err := us.ParseToken(token)
+		if err != nil {
+			t.Fatalf("ParseToken: %v", err)
+		}
+		if err := us.CheckToken(ctx, claims); err != nil {
+			t.Fatalf("CheckToken: %v", err)
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		revoke func() error
+	}{
+		{"logout", func() error { return us.Logout(ctx, user.Email) }},
+		{"password reset", func() error { return us.SetPassword(ctx, user.Email, "password") }},
+		{"suspended", func() error { return us.SuspendUser(ctx, user.Email, "", nil) }},
+	}
+	for _, test := range tests {
+		claims := login()
+		if err := test.revoke(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		us.EnableUser(ctx, user.Email)
+		// access tokens issued before are revoked, not just the refresh token
+		if err := us.CheckToken(ctx, claims); !errors.Is(err, ErrTokenRevoked) {
+			t.Fatalf("%s: CheckToken error doesn't match: wanted %v but got %v", test.name, ErrTokenRevoked, err)
+		}
+	}
+	login()
+}
+
+func TestSessionExpiry(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	tests := []struct {
+		name        string
+		startedAt   time.Duration
+		refreshedAt time.Duration
+		err         error
+	}{
+		{"active", -time.Hour, -time.Minute, nil},
+		{"idle", -3 * time.Hour, -2 * time.Hour, ErrSessionExpired},
+		{"max lifetime", -25 * time.Hour, -time.Minute, ErrSessionExpired},
+	}
+	for _, test := range tests {
+		_, refreshToken, err := us.Login(ctx, user.Email, "password", Client{Audience: "mobile"})
+		if err != nil {
+			t.Fatalf("%s: Login: %v", test.name, err)
+		}
+		user, _ = ur.FindByEmail(ctx, user.Email)
+		session := user.Sessions["mobile"]
+		session.StartedAt = time.Now().Add(test.startedAt)
+		session.RefreshedAt = time.Now().Add(test.refreshedAt)
+		user.Sessions["mobile"] = session
+		ur.Save(ctx, &user)
+
+		_, _, err = us.Refresh(ctx, user.Email, refreshToken, Client{})
+		if !errors.Is(err, test.err) {
+			t.Fatalf("%s: Refresh error doesn't match: wanted %v but got %v", test.name, test.err, err)
+		}
+		if test.err != nil {
+			// the expired session is revoked
+			user, _ = ur.FindByEmail(ctx, user.Email)
+			if _, ok := user.Sessions["mobile"]; ok {
+				t.Fatalf("%s: session wasn't revoked", test.name)
+			}
+		}
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	var keyring keys.Keyring
+	first, _ := keyring.Rotate(time.Now(), 2)
+	if err := keyring.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.Secret = "secret"
+	cfg.Tokens.KeysFile = path
+	us, err := New(ur, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	newConfirmedUser(t, us, "test@test.com")
+
+	oldToken, _, err := us.Login(ctx, "test@test.com", "password", Client{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	token, _, err := us.ParseToken(oldToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if token.Header["kid"] != first.ID {
+		t.Fatalf("kid doesn't match: wanted %v but got %v", first.ID, token.Header["kid"])
+	}
+
+	// tokens signed by the secret before the keyring was set up still verify
+	secretToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{Issuer: "mimoto", Audience: "mimoto"}).SignedString([]byte("secret"))
+	if _, _, err := us.ParseToken(secretToken); err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+
+	// after a rotation new tokens are signed by the new key and the previous key still verifies
+	second, _ := keyring.Rotate(time.Now(), 1)
+	keyring.Save(path)
+	us, err = New(ur, nil, nil, cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	newToken, err := us.IssueAccessToken(ctx, "test@test.com", "")
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	token, _, err = us.ParseToken(newToken)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if token.Header["kid"] != second.ID {
+		t.Fatalf("kid doesn't match: wanted %v but got %v", second.ID, token.Header["kid"])
+	}
+	// only one key was kept, so the first key was dropped
+	if _, _, err := us.ParseToken(oldToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ParseToken error doesn't match: wanted %v but got %v", ErrInvalidToken, err)
+	}
+
+	cfg.Tokens.KeysFile = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := New(ur, nil, nil, cfg); err == nil {
+		t.Fatalf("New: missing keyring didn't fail")
+	}
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTokenTestService(t, ur)
+	newConfirmedUser(t, us, "test@test.com")
+
+	token, err := us.IssueAccessToken(ctx, "test@test.com", "mobile")
+	if err != nil {
+		t.Fatalf("IssueAccessToken: %v", err)
+	}
+	_, claims, err := us.ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if claims.Subject != "test@test.com" || claims.Audience != "mobile" {
+		t.Fatalf("claims don't match: wanted %v but got %v", "test@test.com mobile", claims.Subject+" "+claims.Audience)
+	}
+	// the user's session is left alone
+	if user, _ := ur.FindByEmail(ctx, "test@test.com"); len(user.Sessions) != 0 {
+		t.Fatalf("sessions don't match: wanted none but got %v", user.Sessions)
+	}
+
+	if _, err := us.IssueAccessToken(ctx, "test@test.com", "unknown"); !errors.Is(err, ErrUnknownAudience) {
+		t.Fatalf("IssueAccessToken error doesn't match: wanted %v but got %v", ErrUnknownAudience, err)
+	}
+	us.DisableUser(ctx, "test@test.com", "spam")
+	if _, err := us.IssueAccessToken(ctx, "test@test.com", ""); !errors.Is(err, ErrAccountDisabled) {
+		t.Fatalf("IssueAccessToken error doesn't match: wanted %v but got %v", ErrAccountDisabled, err)
+	}
+}
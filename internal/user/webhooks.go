@@ -0,0 +1,29 @@
+package user
+
+import (
+	"encoding/json"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
+)
+
+// webhookEvent builds an outbox message that publishes eventType about the user to webhook subscriptions.
+func webhookEvent(eventType string, user repository.User, data map[string]string) repository.OutboxMessage {
+	b, _ := json.Marshal(data)
+	return repository.OutboxMessage{
+		IdempotencyKey: eventType + ":" + generateCode(),
+		Kind:           eventType,
+		Name:           user.Name,
+		Email:          user.Email,
+		Payload:        string(b),
+	}
+}
+
+// sessionRevokedEvents returns the webhook event of revoking the user's sessions, if they had any.
+// It must be called before the sessions are cleared.
+func sessionRevokedEvents(user repository.User, reason string) []repository.OutboxMessage {
+	if len(user.Sessions) == 0 {
+		return nil
+	}
+	return []repository.OutboxMessage{webhookEvent(webhook.EventSessionRevoked, user, map[string]string{"reason": reason})}
+}
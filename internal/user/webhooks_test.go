@@ -0,0 +1,48 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/broswen/mimoto/internal/webhook"
+)
+
+func TestWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	ur, _ := repository.NewMap()
+	us := newTestService(t, ur)
+	user := newConfirmedUser(t, us, "test@test.com")
+
+	// logging out without a session doesn't revoke anything
+	if err := us.Logout(ctx, user.Email); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if _, _, err := us.Login(ctx, user.Email, "password", Client{}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if err := us.Logout(ctx, user.Email); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+
+	kinds := outboxKinds(ur, user.Email)
+	for _, kind := range []string{webhook.EventUserCreated, webhook.EventUserConfirmed, webhook.EventSessionRevoked} {
+		if kinds[kind] != 1 {
+			t.Fatalf("%s events don't match: wanted %v but got %v", kind, 1, kinds[kind])
+		}
+	}
+	for _, msg := range ur.OutboxMessages() {
+		if msg.Kind == webhook.EventSessionRevoked && msg.Payload != `{"reason":"logout"}` {
+			t.Fatalf("session.revoked payload doesn't match: wanted %v but got %v", `{"reason":"logout"}`, msg.Payload)
+		}
+	}
+
+	// deleting the user erases their outbox, except for the event telling subscribers about it
+	if err := us.DeleteUser(ctx, user.Email); err != nil {
+		t.Fatalf("DeleteUser: %v", err)
+	}
+	kinds = outboxKinds(ur, user.Email)
+	if len(kinds) != 1 || kinds[webhook.EventUserDeleted] != 1 {
+		t.Fatalf("outbox doesn't match: wanted only %v but got %v", webhook.EventUserDeleted, kinds)
+	}
+}
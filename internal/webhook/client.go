@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddress = errors.New("webhook address isn't allowed")
+
+// NewClient returns a client that refuses to connect to private, loopback and link-local addresses,
+// unless they're in allowedNetworks, so subscriptions can't reach internal services.
+// Addresses are checked when dialing, after DNS resolution and on every redirect.
+func NewClient(allowedNetworks []string) (*http.Client, error) {
+	var allowed []netip.Prefix
+	for _, network := range allowedNetworks {
+		if addr, err := netip.ParseAddr(network); err == nil {
+			// a single IP is a network of one address
+			allowed = append(allowed, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook allowed network %q: %w", network, err)
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+			}
+			addr := addrPort.Addr().Unmap()
+			if !internal(addr) {
+				return nil
+			}
+			for _, prefix := range allowed {
+				if prefix.Contains(addr) {
+					return nil
+				}
+			}
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would dial the subscriber on our behalf, out of reach of the check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport}, nil
+}
+
+// internal reports whether addr is only reachable from inside the network mimoto runs in.
+func internal(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsUnspecified()
+}
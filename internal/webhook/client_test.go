@@ -0,0 +1,56 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client, err := NewClient(nil)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if _, err := client.Post(srv.URL, "application/json", nil); !errors.Is(err, ErrForbiddenAddress) {
+		t.Fatalf("expected ErrForbiddenAddress for a loopback subscriber, got %v", err)
+	}
+
+	client, err = NewClient([]string{"127.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	resp, err := client.Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatalf("expected an allowed loopback subscriber, got %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := NewClient([]string{"intranet"}); err == nil {
+		t.Fatal("expected an error for an invalid allowed network")
+	}
+}
+
+func TestInternal(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"127.0.0.1":       true,
+		"169.254.169.254": true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"93.184.216.34":   false,
+		"2606:4700::1111": false,
+	} {
+		if got := internal(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("internal(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
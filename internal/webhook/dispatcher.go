@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+type Options struct {
+	// BatchSize is the most deliveries claimed by each dispatch.
+	BatchSize int
+	// MaxAttempts is the number of failed attempts before a delivery is given up on.
+	MaxAttempts int
+	// BaseBackoff is doubled after every failed attempt, up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a claimed delivery is hidden from other dispatchers.
+	Lease time.Duration
+	// Timeout is how long a subscriber gets to respond.
+	Timeout time.Duration
+}
+
+var DefaultOptions = Options{
+	BatchSize:   50,
+	MaxAttempts: 10,
+	BaseBackoff: 30 * time.Second,
+	MaxBackoff:  6 * time.Hour,
+	Lease:       5 * time.Minute,
+	Timeout:     10 * time.Second,
+}
+
+type Stats struct {
+	Delivered uint64
+	Retried   uint64
+	Dead      uint64
+}
+
+type counters struct {
+	delivered uint64
+	retried   uint64
+	dead      uint64
+}
+
+// Dispatcher POSTs the deliveries queued by Publish and Replay to their subscriptions.
+type Dispatcher struct {
+	repository repository.WebhookRepository
+	client     *http.Client
+	options    Options
+	counters   *counters
+}
+
+func NewDispatcher(webhookRepository repository.WebhookRepository, client *http.Client, options Options) (Dispatcher, error) {
+	if options.BatchSize < 1 || options.MaxAttempts < 1 || options.BaseBackoff <= 0 || options.MaxBackoff < options.BaseBackoff || options.Lease <= options.Timeout || options.Timeout <= 0 {
+		return Dispatcher{}, fmt.Errorf("invalid webhook options: %+v", options)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return Dispatcher{
+		repository: webhookRepository,
+		client:     client,
+		options:    options,
+		counters:   &counters{},
+	}, nil
+}
+
+// DispatchOnce attempts the deliveries due at now and returns how many were claimed.
+// It stops when ctx is done, leaving the unattempted deliveries for the next dispatch.
+func (d Dispatcher) DispatchOnce(ctx context.Context, now time.Time) (int, error) {
+	deliveries, err := d.repository.ClaimWebhookDeliveries(ctx, now, d.options.Lease, d.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range deliveries {
+		status, err := d.deliver(ctx, delivery, now)
+		// interrupted deliveries are claimed again once their lease expires, without using up an attempt
+		if ctx.Err() != nil {
+			return len(deliveries), ctx.Err()
+		}
+		delivery.Attempts++
+		delivery.ResponseStatus = status
+		if err != nil {
+			delivery.LastError = err.Error()
+			if delivery.Attempts >= d.options.MaxAttempts || errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+				delivery.Status = repository.WebhookDead
+				atomic.AddUint64(&d.counters.dead, 1)
+			} else {
+				delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+				atomic.AddUint64(&d.counters.retried, 1)
+			}
+		} else {
+			deliveredAt := now
+			delivery.Status = repository.WebhookDelivered
+			delivery.DeliveredAt = &deliveredAt
+			delivery.LastError = ""
+			atomic.AddUint64(&d.counters.delivered, 1)
+		}
+
+		// the delivery is gone if its user was erased during it
+		if err := d.repository.SaveWebhookDelivery(ctx, &delivery); err != nil && !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+			return len(deliveries), err
+		}
+	}
+	return len(deliveries), nil
+}
+
+// backoff returns the delay before the next attempt after attempts failed attempts.
+func (d Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.options.BaseBackoff
+	for i := 1; i < attempts && delay < d.options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.options.MaxBackoff {
+		delay = d.options.MaxBackoff
+	}
+	return delay
+}
+
+// deliver POSTs the signed payload and returns the response status, any non 2xx status is a failure.
+func (d Dispatcher) deliver(ctx context.Context, delivery repository.WebhookDelivery, now time.Time) (int, error) {
+	sub, err := d.repository.FindWebhookSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.options.Timeout)
+	defer cancel()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "mimoto-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, now, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d Dispatcher) Stats() Stats {
+	return Stats{
+		Delivered: atomic.LoadUint64(&d.counters.delivered),
+		Retried:   atomic.LoadUint64(&d.counters.retried),
+		Dead:      atomic.LoadUint64(&d.counters.dead),
+	}
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+// receiver is a subscriber that fails the first failures requests and records the rest.
+type receiver struct {
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+}
+
+var testOptions = Options{
+	BatchSize:   10,
+	MaxAttempts: 3,
+	BaseBackoff: time.Second,
+	MaxBackoff:  time.Minute,
+	Lease:       time.Minute,
+	Timeout:     time.Second,
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{failures: 1}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	mr, _ := repository.NewMap()
+	ws, _ := New(mr)
+	sub, _ := ws.CreateSubscription(ctx, srv.URL, []string{EventUserCreated})
+	if err := ws.Publish(ctx, Event{ID: "1", Type: EventUserCreated}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	d, err := NewDispatcher(mr, srv.Client(), testOptions)
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+
+	now := time.Now()
+	if _, err := d.DispatchOnce(ctx, now); err != nil {
+		t.Fatalf("DispatchOnce: %v", err)
+	}
+	deliveries, _, _ := mr.ListWebhookDeliveries(ctx, sub.ID, 0, 10)
+	if deliveries[0].Status != repository.WebhookPending || deliveries[0].ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("failed delivery doesn't match: got %+v", deliveries[0])
+	}
+
+	// retried after the backoff
+	if _, err := d.DispatchOnce(ctx, now.Add(time.Second)); err != nil {
+		t.Fatalf("DispatchOnce: %v", err)
+	}
+	deliveries, _, _ = mr.ListWebhookDeliveries(ctx, sub.ID, 0, 10)
+	if deliveries[0].Status != repository.WebhookDelivered || deliveries[0].Attempts != 2 || deliveries[0].DeliveredAt == nil {
+		t.Fatalf("delivery doesn't match: got %+v", deliveries[0])
+	}
+	if stats := d.Stats(); stats.Delivered != 1 || stats.Retried != 1 {
+		t.Fatalf("stats don't match: got %+v", stats)
+	}
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("requests don't match: wanted %v but got %v", 1, len(rc.requests))
+	}
+	r := rc.requests[0]
+	if r.Header.Get(EventHeader) != EventUserCreated || r.Header.Get(DeliveryHeader) != deliveries[0].ID {
+		t.Fatalf("headers don't match: got %v", r.Header)
+	}
+	if err := Verify(sub.Secret, r.Header.Get(SignatureHeader), rc.bodies[0], time.Now(), 5*time.Minute); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if string(rc.bodies[0]) != deliveries[0].Payload {
+		t.Fatalf("body doesn't match: wanted %v but got %v", deliveries[0].Payload, string(rc.bodies[0]))
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	ctx := context.Background()
+	rc := &receiver{failures: 10}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	mr, _ := repository.NewMap()
+	ws, _ := New(mr)
+	sub, _ := ws.CreateSubscription(ctx, srv.URL, []string{EventUserCreated})
+	gone, _ := ws.CreateSubscription(ctx, srv.URL, []string{EventUserCreated})
+	ws.Publish(ctx, Event{ID: "1", Type: EventUserCreated})
+	ws.DeleteSubscription(ctx, gone.ID)
+	d, _ := NewDispatcher(mr, srv.Client(), testOptions)
+
+	now := time.Now()
+	for i := 0; i < testOptions.MaxAttempts; i++ {
+		if _, err := d.DispatchOnce(ctx, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("DispatchOnce: %v", err)
+		}
+	}
+
+	for _, id := range []string{sub.ID, gone.ID} {
+		deliveries, _, _ := mr.ListWebhookDeliveries(ctx, id, 0, 10)
+		if deliveries[0].Status != repository.WebhookDead {
+			t.Fatalf("delivery status doesn't match: wanted %v but got %+v", repository.WebhookDead, deliveries[0])
+		}
+	}
+	// deliveries to deleted subscriptions aren't retried
+	deliveries, _, _ := mr.ListWebhookDeliveries(ctx, gone.ID, 0, 10)
+	if deliveries[0].Attempts != 1 {
+		t.Fatalf("attempts don't match: wanted %v but got %v", 1, deliveries[0].Attempts)
+	}
+}
+
+func TestDispatcherCancel(t *testing.T) {
+	mr, _ := repository.NewMap()
+	ws, _ := New(mr)
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client going away once the body is read
+		io.ReadAll(r.Body)
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	sub, _ := ws.CreateSubscription(context.Background(), srv.URL, []string{EventUserCreated})
+	ws.Publish(context.Background(), Event{ID: "1", Type: EventUserCreated})
+	d, _ := NewDispatcher(mr, srv.Client(), testOptions)
+
+	if _, err := d.DispatchOnce(ctx, time.Now()); err != context.Canceled {
+		t.Fatalf("DispatchOnce error doesn't match: wanted %v but got %v", context.Canceled, err)
+	}
+	// interrupted deliveries don't use up an attempt
+	deliveries, _, _ := mr.ListWebhookDeliveries(context.Background(), sub.ID, 0, 10)
+	if deliveries[0].Attempts != 0 {
+		t.Fatalf("attempts don't match: wanted %v but got %v", 0, deliveries[0].Attempts)
+	}
+}
@@ -0,0 +1,36 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	now := time.Unix(1633046400, 0)
+	body := []byte(`{"id":"1"}`)
+	header := Sign("secret", now, body)
+
+	if err := Verify("secret", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+	}{
+		{"wrong secret", "other", header, body, now},
+		{"tampered body", "secret", header, []byte(`{"id":"2"}`), now},
+		{"too old", "secret", header, body, now.Add(time.Hour)},
+		{"missing signature", "secret", "t=1633046400", body, now},
+		{"malformed", "secret", "t=now,v1=zz", body, now},
+	}
+	for _, test := range tests {
+		if err := Verify(test.secret, test.header, test.body, test.now, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("Verify %s error doesn't match: wanted %v but got %v", test.name, ErrInvalidSignature, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+	"github.com/gofrs/uuid"
+)
+
+const (
+	EventUserCreated       = "user.created"
+	EventUserConfirmed     = "user.confirmed"
+	EventUserPasswordReset = "user.password_reset"
+	EventUserDeleted       = "user.deleted"
+	EventSessionRevoked    = "session.revoked"
+)
+
+var events = []string{EventUserCreated, EventUserConfirmed, EventUserPasswordReset, EventUserDeleted, EventSessionRevoked}
+
+// IsEvent reports whether kind is a webhook event rather than an email.
+func IsEvent(kind string) bool {
+	for _, event := range events {
+		if kind == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON body POSTed to subscriptions.
+type Event struct {
+	ID        string            `json:"id"`
+	Type      string            `json:"type"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Data      map[string]string `json:"data"`
+	// Subject is the email of the account the event is about, it's kept with the deliveries so they can be exported and erased.
+	Subject string `json:"-"`
+}
+
+type WebhookService interface {
+	// Publish queues a delivery of event to every subscription to its type.
+	Publish(ctx context.Context, event Event) error
+
+	CreateSubscription(ctx context.Context, url string, events []string) (repository.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]repository.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]repository.WebhookDelivery, int64, error)
+	// Replay queues a new delivery of the event of a past delivery.
+	Replay(ctx context.Context, deliveryID string) (repository.WebhookDelivery, error)
+}
+
+type Service struct {
+	repository repository.WebhookRepository
+}
+
+func New(webhookRepository repository.WebhookRepository) (Service, error) {
+	return Service{
+		repository: webhookRepository,
+	}, nil
+}
+
+func subscribed(sub repository.WebhookSubscription, eventType string) bool {
+	for _, event := range strings.Split(sub.Events, ",") {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Service) Publish(ctx context.Context, event Event) error {
+	subs, err := s.repository.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]repository.WebhookDelivery, 0)
+	for _, sub := range subs {
+		if !subscribed(sub, event.Type) {
+			continue
+		}
+		deliveries = append(deliveries, repository.WebhookDelivery{
+			IdempotencyKey: sub.ID + ":" + event.ID,
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Subject:        event.Subject,
+			Payload:        string(payload),
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.repository.CreateWebhookDeliveries(ctx, deliveries)
+}
+
+// generateSecret returns a random signing secret.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// CreateSubscription returns the subscription with its secret, which isn't shown again.
+func (s Service) CreateSubscription(ctx context.Context, rawURL string, eventTypes []string) (repository.WebhookSubscription, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return repository.WebhookSubscription{}, fmt.Errorf("invalid webhook url %q, must be an http or https url", rawURL)
+	}
+	if len(eventTypes) == 0 {
+		return repository.WebhookSubscription{}, errors.New("missing webhook events")
+	}
+	for _, eventType := range eventTypes {
+		if !IsEvent(eventType) {
+			return repository.WebhookSubscription{}, fmt.Errorf("unknown webhook event %q, must be one of: %s", eventType, strings.Join(events, ", "))
+		}
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return repository.WebhookSubscription{}, fmt.Errorf("generate webhook secret: %w", err)
+	}
+	sub := repository.WebhookSubscription{
+		URL:    rawURL,
+		Secret: secret,
+		Events: strings.Join(eventTypes, ","),
+	}
+	if err := s.repository.CreateWebhookSubscription(ctx, &sub); err != nil {
+		return repository.WebhookSubscription{}, err
+	}
+	return sub, nil
+}
+
+func (s Service) ListSubscriptions(ctx context.Context) ([]repository.WebhookSubscription, error) {
+	return s.repository.ListWebhookSubscriptions(ctx)
+}
+
+func (s Service) DeleteSubscription(ctx context.Context, id string) error {
+	return s.repository.DeleteWebhookSubscription(ctx, id)
+}
+
+func (s Service) ListDeliveries(ctx context.Context, subscriptionID string, offset, limit int) ([]repository.WebhookDelivery, int64, error) {
+	if _, err := s.repository.FindWebhookSubscription(ctx, subscriptionID); err != nil {
+		return nil, 0, err
+	}
+	return s.repository.ListWebhookDeliveries(ctx, subscriptionID, offset, limit)
+}
+
+// Replay sends the same payload with the same event id, so receivers can tell it's a duplicate.
+func (s Service) Replay(ctx context.Context, deliveryID string) (repository.WebhookDelivery, error) {
+	original, err := s.repository.FindWebhookDelivery(ctx, deliveryID)
+	if err != nil {
+		return repository.WebhookDelivery{}, err
+	}
+	if _, err := s.repository.FindWebhookSubscription(ctx, original.SubscriptionID); err != nil {
+		return repository.WebhookDelivery{}, err
+	}
+
+	id, _ := uuid.NewV4()
+	replay := repository.WebhookDelivery{
+		ID:             id.String(),
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		EventType:      original.EventType,
+		Subject:        original.Subject,
+		Payload:        original.Payload,
+		ReplayOf:       original.ID,
+	}
+	if err := s.repository.CreateWebhookDeliveries(ctx, []repository.WebhookDelivery{replay}); err != nil {
+		return repository.WebhookDelivery{}, err
+	}
+	return s.repository.FindWebhookDelivery(ctx, replay.ID)
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/broswen/mimoto/internal/repository"
+)
+
+func TestCreateSubscription(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	ws, _ := New(mr)
+
+	sub, err := ws.CreateSubscription(ctx, "https://example.com/hook", []string{EventUserCreated, EventUserDeleted})
+	if err != nil {
+		t.Fatalf("CreateSubscription: %v", err)
+	}
+	if sub.Secret == "" || sub.Events != "user.created,user.deleted" {
+		t.Fatalf("subscription doesn't match: got %+v", sub)
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		events []string
+	}{
+		{"relative url", "/hook", []string{EventUserCreated}},
+		{"ftp url", "ftp://example.com/hook", []string{EventUserCreated}},
+		{"no events", "https://example.com/hook", nil},
+		{"unknown event", "https://example.com/hook", []string{"user.updated"}},
+	}
+	for _, test := range tests {
+		if _, err := ws.CreateSubscription(ctx, test.url, test.events); err == nil {
+			t.Fatalf("CreateSubscription %s: didn't fail", test.name)
+		}
+	}
+}
+
+func TestPublishAndReplay(t *testing.T) {
+	ctx := context.Background()
+	mr, _ := repository.NewMap()
+	ws, _ := New(mr)
+	created, _ := ws.CreateSubscription(ctx, "https://example.com/created", []string{EventUserCreated})
+	deleted, _ := ws.CreateSubscription(ctx, "https://example.com/deleted", []string{EventUserDeleted})
+
+	event := Event{ID: "1", Type: EventUserCreated, CreatedAt: time.Now(), Data: map[string]string{"email": "test@test.com"}}
+	// publishing the same event again is a no-op
+	for i := 0; i < 2; i++ {
+		if err := ws.Publish(ctx, event); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	deliveries, total, err := ws.ListDeliveries(ctx, created.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("ListDeliveries: %v", err)
+	}
+	if total != 1 || deliveries[0].EventID != "1" {
+		t.Fatalf("deliveries don't match: got %+v", deliveries)
+	}
+	if _, total, _ := ws.ListDeliveries(ctx, deleted.ID, 0, 10); total != 0 {
+		t.Fatalf("unsubscribed deliveries don't match: wanted %v but got %v", 0, total)
+	}
+
+	replay, err := ws.Replay(ctx, deliveries[0].ID)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if replay.ID == deliveries[0].ID || replay.ReplayOf != deliveries[0].ID || replay.Payload != deliveries[0].Payload || replay.Status != repository.WebhookPending {
+		t.Fatalf("replay doesn't match: got %+v", replay)
+	}
+
+	if _, err := ws.Replay(ctx, "missing"); !errors.Is(err, repository.ErrWebhookDeliveryNotFound) {
+		t.Fatalf("Replay error doesn't match: wanted %v but got %v", repository.ErrWebhookDeliveryNotFound, err)
+	}
+	if _, _, err := ws.ListDeliveries(ctx, "missing", 0, 10); !errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+		t.Fatalf("ListDeliveries error doesn't match: wanted %v but got %v", repository.ErrWebhookSubscriptionNotFound, err)
+	}
+}